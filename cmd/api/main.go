@@ -2,77 +2,226 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"flag"
 	"log"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/onnwee/mandalay/internal/api"
 	"github.com/onnwee/mandalay/internal/store"
 )
 
 func main() {
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file; serves HTTPS with HTTP/2 when set with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	flag.Parse()
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be set together")
+	}
+
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
+	var logLevel slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := logLevel.UnmarshalText([]byte(v)); err != nil {
+			log.Fatalf("Invalid LOG_LEVEL: %v", err)
+		}
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	slog.SetDefault(logger)
+
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		log.Fatal("DATABASE_URL environment variable not set")
 	}
 
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, dbURL)
+	config, err := store.ParsePoolConfig(dbURL, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.AfterConnect = store.PrepareStatements
+
+	retry, err := store.ParseConnectRetry(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pool, err := store.ConnectWithRetry(ctx, config, retry)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+		log.Fatal(err)
 	}
 	defer pool.Close()
 
 	// Initialize store
 	placemarkStore := store.NewPlacemarkStore(pool)
 
+	cacheSize := 1000
+	if v := os.Getenv("DETAIL_CACHE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid DETAIL_CACHE_SIZE: %v", err)
+		}
+		cacheSize = size
+	}
+	var cacheTTL time.Duration
+	if v := os.Getenv("DETAIL_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			log.Fatalf("Invalid DETAIL_CACHE_TTL %q: must be a duration such as 5m", v)
+		}
+		cacheTTL = ttl
+	}
+	placemarkStore.EnableDetailCache(cacheSize, cacheTTL)
+
+	listenCtx, stopListening := context.WithCancel(ctx)
+	defer stopListening()
+	go placemarkStore.ListenForChanges(listenCtx)
+
+	apiToken := os.Getenv("API_TOKEN")
+	if apiToken == "" {
+		log.Println("API_TOKEN not set; admin endpoints and write requests are disabled")
+	}
+
+	var limiter *api.RateLimiter
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil || rps < 0 || math.IsNaN(rps) || math.IsInf(rps, 0) {
+			log.Fatalf("Invalid RATE_LIMIT_RPS %q: must be a non-negative number", v)
+		}
+		burst := int(math.Ceil(2 * rps))
+		if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+			if burst, err = strconv.Atoi(v); err != nil || burst < 1 {
+				log.Fatalf("Invalid RATE_LIMIT_BURST %q: must be a positive integer", v)
+			}
+		}
+		if rps > 0 {
+			limiter = api.NewRateLimiter(rps, burst)
+			go limiter.Cleanup(listenCtx, time.Minute)
+		}
+	}
+
+	trustedProxies, err := api.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Streamed lists and exports can run far past WriteTimeout, so their
+	// routes get their own deadline.
+	streamWriteTimeout := 10 * time.Minute
+	if v := os.Getenv("STREAM_WRITE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid STREAM_WRITE_TIMEOUT %q: must be a duration such as 30m, or 0 for none", v)
+		}
+		streamWriteTimeout = d
+	}
+	stream := api.WriteTimeout(streamWriteTimeout)
+
 	// Initialize handlers
 	handlers := api.NewHandlers(placemarkStore)
+	if os.Getenv("REQUIRE_IF_MATCH") == "true" {
+		handlers.RequireIfMatch()
+	}
 
 	// Set up router
 	r := chi.NewRouter()
 
 	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:*", "http://127.0.0.1:*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	r.Use(api.RealIP(trustedProxies))
+	r.Use(api.RequestLogger(logger))
+	r.Use(middleware.Recoverer)
+	r.Use(api.Gzip(api.DefaultGzipMinSize))
+	r.Use(api.CORS(corsOrigins()))
 
 	// Routes
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-	})
+	r.Get("/health", handlers.Healthz)
+	r.Get("/healthz", handlers.Healthz)
+	r.Get("/readyz", handlers.Readyz)
 
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Get("/placemarks", handlers.ListPlacemarks)
+		if limiter != nil {
+			r.Use(limiter.Handler)
+		}
+		r.Use(api.RequireTokenFor(apiToken, tokenMethods()))
+
+		r.With(stream).Get("/placemarks", handlers.ListPlacemarks)
+		r.With(stream).Get("/placemarks.geojson", handlers.GetPlacemarksGeoJSON)
+		r.With(stream).Get("/placemarks.csv", handlers.ListPlacemarksCSV)
+		r.Get("/placemarks/duplicates", handlers.GetDuplicates)
+		r.Get("/placemarks/search", handlers.SearchPlacemarks)
+		r.Get("/placemarks/nearby", handlers.GetNearby)
+		r.Get("/placemarks/clusters", handlers.GetClusters)
+		r.Get("/tiles/{z}/{x}/{y}.mvt", handlers.GetTile)
 		r.Get("/placemarks/{id}", handlers.GetPlacemark)
+		r.Get("/placemarks/{id}/distance", handlers.GetPlacemarkDistance)
 		r.Get("/timeline", handlers.GetTimeline)
 		r.Get("/timeline/events", handlers.GetTimelineEvents)
+		r.Get("/timeline/nearest", handlers.GetNearestInTime)
+		r.Get("/timeline.ics", handlers.ExportICalendar)
 		r.Get("/spatial/bbox", handlers.GetPlacemarksInBBox)
+		r.Get("/spatial/stack", handlers.GetStack)
+		r.Get("/heatmap", handlers.GetHeatmap)
+		r.Get("/route", handlers.GetRoute)
+		r.Get("/styles", handlers.ListStyles)
+		r.Get("/styles/{id}", handlers.GetStyle)
+		r.Get("/styles/{id}/placemarks", handlers.GetStylePlacemarks)
 		r.Get("/folders", handlers.ListFolders)
+		r.Get("/folders/tree", handlers.GetFolderTree)
+		r.Get("/folders/{folder}/hull", handlers.GetFolderHull)
+		r.Get("/folders/{folder}/bounds", handlers.GetFolderBounds)
+		r.Get("/data/keys", handlers.ListDataKeys)
 		r.Get("/stats", handlers.GetStats)
+		r.Get("/stats/cache", handlers.GetCacheStats)
+		r.Get("/stats/timeline", handlers.GetTimelineHistogram)
+		r.With(stream).Get("/export.shp", handlers.ExportShapefile)
+		r.With(stream).Get("/export.csv", handlers.ExportCSV)
+		r.With(stream).Get("/export.geojson", handlers.ExportGeoJSON)
+		r.With(stream).Get("/export.ndjson", handlers.ExportNDJSON)
+		r.With(stream).Get("/export/kml", handlers.ExportKML)
+		r.With(stream).Get("/export.kml", handlers.ExportKML)
+		r.Get("/maintenance/geometry-report", handlers.GetGeometryReport)
+		r.Get("/imports", handlers.ListImports)
+		r.Get("/changes", handlers.GetChanges)
+
+		// Admin routes
+		r.Group(func(r chi.Router) {
+			r.Use(api.RequireToken(apiToken))
+			r.Delete("/sources/{label}", handlers.DeleteSource)
+			r.Post("/placemarks", handlers.CreatePlacemark)
+			r.Put("/placemarks/{id}", handlers.ReplacePlacemark)
+			r.Patch("/placemarks/{id}", handlers.UpdatePlacemark)
+			r.Delete("/placemarks/{id}", handlers.DeletePlacemark)
+			r.Patch("/placemarks/{id}/data", handlers.PatchPlacemarkData)
+			r.Post("/placemarks/{id}/merge", handlers.MergePlacemark)
+			r.Post("/validate", handlers.ValidateKML)
+		})
 	})
 
 	port := os.Getenv("PORT")
@@ -80,12 +229,22 @@ func main() {
 		port = "8080"
 	}
 
+	shutdownTimeout := 15 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid SHUTDOWN_TIMEOUT %q: must be a positive duration such as 30s", v)
+		}
+		shutdownTimeout = d
+	}
+
 	srv := &http.Server{
 		Addr:         ":" + port,
 		Handler:      r,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		TLSConfig:    tlsConfig,
 	}
 
 	// Graceful shutdown
@@ -93,21 +252,67 @@ func main() {
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Server starting on port %s", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// Certificates come from TLSConfig; net/http negotiates HTTP/2 over TLS.
+			log.Printf("Server starting on port %s (TLS)", port)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Server starting on port %s", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
 
 	<-done
-	log.Println("Server shutting down...")
+	// A second signal kills the process instead of waiting out the drain.
+	signal.Stop(done)
+	log.Printf("Server shutting down, waiting up to %s for in-flight requests...", shutdownTimeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+		srv.Close()
 	}
 
+	// Requests are finished (or abandoned), so nothing needs the pool any
+	// more; stop the change listener before closing it.
+	stopListening()
+	pool.Close()
+
 	log.Println("Server exited")
 }
+
+// tokenMethods reads API_TOKEN_METHODS, a comma-separated list of HTTP
+// methods that need the API token on every /api/v1 route.
+func tokenMethods() []string {
+	var methods []string
+	for _, m := range strings.Split(os.Getenv("API_TOKEN_METHODS"), ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	if len(methods) == 0 {
+		return api.DefaultTokenMethods
+	}
+	return methods
+}
+
+// corsOrigins reads the comma-separated CORS_ALLOWED_ORIGINS, falling back
+// to api.DefaultCORSOrigins when it is unset or empty.
+func corsOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return api.DefaultCORSOrigins
+	}
+	return origins
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// autoFolderConfig files unfoldered points under the region polygon that
+// contains them.
+type autoFolderConfig struct {
+	// RegionFolder holds the region polygons; each region's name becomes
+	// the folder.
+	RegionFolder string
+	// Default is the folder for points outside every region. Empty leaves
+	// them unfoldered.
+	Default string
+}
+
+func (c autoFolderConfig) enabled() bool {
+	return c.RegionFolder != ""
+}
+
+// assignFoldersFromRegions sets folder_path for each Point among ids that has
+// none, using the name of the smallest region polygon (from this import or an
+// earlier one) containing it, or the default. It returns how many points
+// were assigned.
+func assignFoldersFromRegions(ctx context.Context, tx pgx.Tx, ids []int, cfg autoFolderConfig) (int64, error) {
+	tag, err := tx.Exec(ctx, `
+		WITH assignments AS (
+			SELECT p.id, COALESCE(region.name, NULLIF($3, '')) AS folder
+			FROM placemarks p
+			LEFT JOIN LATERAL (
+				SELECT r.name
+				FROM placemarks r
+				WHERE r.geometry_type IN ('Polygon', 'MultiPolygon')
+				  AND $2 = ANY(r.folder_path)
+				  AND r.name <> ''
+				  AND ST_Contains(r.geom, p.geom)
+				ORDER BY ST_Area(r.geom), r.id
+				LIMIT 1
+			) region ON true
+			WHERE p.id = ANY($1)
+			  AND p.geometry_type = 'Point'
+			  AND COALESCE(cardinality(p.folder_path), 0) = 0
+		)
+		UPDATE placemarks p
+		SET folder_path = ARRAY[a.folder]
+		FROM assignments a
+		WHERE p.id = a.id AND a.folder IS NOT NULL
+	`, ids, cfg.RegionFolder, cfg.Default)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign folders from regions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
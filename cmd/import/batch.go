@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// batchRange is the half-open slice [start, end) of one batch.
+type batchRange struct {
+	start, end int
+}
+
+// batchBounds splits n placemarks into batches of size, the last one
+// holding the remainder. A size of zero or less, or at least n, gives a
+// single batch.
+func batchBounds(n, size int) []batchRange {
+	if size <= 0 || size >= n {
+		return []batchRange{{0, n}}
+	}
+	batches := make([]batchRange, 0, (n+size-1)/size)
+	for start := 0; start < n; start += size {
+		batches = append(batches, batchRange{start, min(start+size, n)})
+	}
+	return batches
+}
+
+// progressInterval is how many placemarks pass between progress lines.
+const progressInterval = 1000
+
+// importProgress logs how many placemarks have been processed, with the
+// rate so far and an estimate of the time left. Imports smaller than one
+// interval log nothing.
+type importProgress struct {
+	total, done int
+	next        int
+	started     time.Time
+}
+
+func newImportProgress(total int) *importProgress {
+	return &importProgress{total: total, next: progressInterval, started: time.Now()}
+}
+
+// advance records n more placemarks processed.
+func (p *importProgress) advance(n int) {
+	p.done += n
+	if p.done < p.next && !(p.done == p.total && p.total >= progressInterval) {
+		return
+	}
+	for p.next <= p.done {
+		p.next += progressInterval
+	}
+
+	elapsed := time.Since(p.started)
+	rate := float64(p.done) / elapsed.Seconds()
+	eta := time.Duration(0)
+	if rate > 0 {
+		eta = time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+	}
+	log.Printf("Processed %d/%d placemarks (%.0f/s, ETA %s)", p.done, p.total, rate, eta.Round(time.Second))
+}
+
+// dropExisting removes placemarks whose name and geometry exactly match a
+// stored placemark, returning the rest and how many were dropped. Stored
+// geometries changed by snapping or -force-dimension no longer match.
+func dropExisting(ctx context.Context, tx pgx.Tx, placemarks []kml.PlacemarkRecord) ([]kml.PlacemarkRecord, int, error) {
+	if len(placemarks) == 0 {
+		return placemarks, 0, nil
+	}
+
+	names := make([]string, len(placemarks))
+	wkts := make([]string, len(placemarks))
+	for i, pm := range placemarks {
+		names[i], wkts[i] = pm.Name, pm.GeomWKT
+	}
+
+	// ~= compares bounding boxes and can use the GIST index; = then checks
+	// the geometries are identical.
+	rows, err := tx.Query(ctx, `
+		SELECT u.i::int - 1
+		FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS u(name, wkt, i)
+		CROSS JOIN LATERAL (SELECT ST_GeomFromText(u.wkt, 4326) AS geom) g
+		WHERE EXISTS (
+			SELECT 1 FROM placemarks p
+			WHERE p.geom ~= g.geom AND p.geom = g.geom AND p.name = u.name
+		)
+	`, names, wkts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up existing placemarks: %w", err)
+	}
+	existing, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up existing placemarks: %w", err)
+	}
+	if len(existing) == 0 {
+		return placemarks, 0, nil
+	}
+
+	drop := make(map[int]bool, len(existing))
+	for _, i := range existing {
+		drop[i] = true
+	}
+	kept := make([]kml.PlacemarkRecord, 0, len(placemarks)-len(drop))
+	for i, pm := range placemarks {
+		if !drop[i] {
+			kept = append(kept, pm)
+		}
+	}
+	return kept, len(drop), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		n, size int
+		want    []batchRange
+	}{
+		{"no batching", 5, 0, []batchRange{{0, 5}}},
+		{"negative size", 5, -1, []batchRange{{0, 5}}},
+		{"size covers all", 5, 5, []batchRange{{0, 5}}},
+		{"size exceeds n", 5, 10, []batchRange{{0, 5}}},
+		{"even split", 6, 2, []batchRange{{0, 2}, {2, 4}, {4, 6}}},
+		{"remainder", 7, 3, []batchRange{{0, 3}, {3, 6}, {6, 7}}},
+		{"empty", 0, 3, []batchRange{{0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchBounds(tt.n, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchBounds(%d, %d) = %v, want %v", tt.n, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		advances []int
+		want     []string
+	}{
+		{"below one interval", 999, []int{500, 499}, nil},
+		{"each interval", 2500, []int{1000, 1000, 500}, []string{"1000/2500", "2000/2500", "2500/2500"}},
+		{"large step", 3500, []int{3200, 300}, []string{"3200/3500", "3500/3500"}},
+		{"small steps", 1500, []int{400, 400, 400, 300}, []string{"1200/1500", "1500/1500"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&buf)
+
+			p := newImportProgress(tt.total)
+			for _, n := range tt.advances {
+				p.advance(n)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if _, rest, ok := strings.Cut(line, "Processed "); ok {
+					got = append(got, strings.Fields(rest)[0])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("progress lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// copyPlacemarks bulk-loads placemarks with the COPY protocol. Ids are taken
+// from the placemarks sequence up front so extended data can be linked
+// without a round trip per row. Geometry can't be sent through binary COPY
+// as WKT, so rows go to a temporary staging table and are converted with
+// ST_GeomFromText in one INSERT ... SELECT, which also drops references to
+// styles that don't exist. Placemarks matching a stored content hash update
+// that row and keep its id, and their extended data is replaced, unless
+// nothing about them changed. It returns the ids written or found unchanged.
+func copyPlacemarks(ctx context.Context, tx pgx.Tx, placemarks []kml.PlacemarkRecord, opts importOptions) ([]int, upserted, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT nextval(pg_get_serial_sequence('placemarks', 'id'))::int FROM generate_series(1, $1)`,
+		len(placemarks))
+	if err != nil {
+		return nil, upserted{}, fmt.Errorf("failed to reserve placemark ids: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, upserted{}, fmt.Errorf("failed to reserve placemark ids: %w", err)
+	}
+
+	hashes := make([]string, len(placemarks))
+	for i, pm := range placemarks {
+		hashes[i] = contentHash(pm)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE placemark_staging (
+			id INTEGER,
+			name TEXT,
+			description TEXT,
+			description_raw TEXT,
+			style_id TEXT,
+			folder_path TEXT[],
+			geometry_type TEXT,
+			geom_wkt TEXT,
+			coordinates_raw TEXT,
+			gx_media_links TEXT[],
+			time_begin TIMESTAMPTZ,
+			time_end TIMESTAMPTZ,
+			track_times TIMESTAMPTZ[],
+			content_hash TEXT,
+			extended_data JSONB
+		) ON COMMIT DROP
+	`); err != nil {
+		return nil, upserted{}, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"placemark_staging"},
+		[]string{"id", "name", "description", "description_raw", "style_id", "folder_path", "geometry_type", "geom_wkt", "coordinates_raw", "gx_media_links", "time_begin", "time_end", "track_times", "content_hash", "extended_data"},
+		pgx.CopyFromSlice(len(placemarks), func(i int) ([]interface{}, error) {
+			pm := placemarks[i]
+			var mediaLinks []string
+			if len(pm.MediaLinks) > 0 {
+				mediaLinks = pm.MediaLinks
+			}
+			description, descriptionRaw := storedDescription(opts.DescriptionMode, opts.DescriptionFormat, pm.Description)
+			return []interface{}{
+				ids[i], pm.Name, description, descriptionRaw, nonEmpty(pm.StyleID), pm.FolderPath,
+				pm.GeometryType, pm.GeomWKT, pm.CoordinatesRaw, mediaLinks, pm.TimeBegin, pm.TimeEnd, pm.TrackTimes, hashes[i],
+				extendedDataJSON(pm),
+			}, nil
+		}))
+	if err != nil {
+		return nil, upserted{}, fmt.Errorf("failed to copy placemarks: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `
+		INSERT INTO placemarks
+		(id, name, description, description_raw, description_format, style_id, folder_path, geometry_type, geom, coordinates_raw, gx_media_links, source, time_begin, time_end, track_times, content_hash)
+		SELECT s.id, s.name, s.description, s.description_raw, $1, st.id, s.folder_path, s.geometry_type,
+		       ST_GeomFromText(s.geom_wkt, 4326), s.coordinates_raw, s.gx_media_links, $2, s.time_begin, s.time_end, s.track_times, s.content_hash
+		FROM placemark_staging s
+		LEFT JOIN styles st ON st.id = s.style_id
+		ORDER BY s.id
+	`+upsertOnHash(`(SELECT s.extended_data FROM placemark_staging s WHERE s.content_hash = EXCLUDED.content_hash)`)+`
+		RETURNING id, content_hash, (xmax = 0)
+	`, opts.DescriptionFormat, nonEmpty(opts.Source))
+	if err != nil {
+		return nil, upserted{}, fmt.Errorf("failed to insert placemarks: %w", err)
+	}
+	// Updated and unchanged rows keep their existing id, so the reserved one
+	// goes unused.
+	stored := make(map[string]int, len(placemarks))
+	var updatedIDs []int
+	for rows.Next() {
+		var id int
+		var hash string
+		var inserted bool
+		if err := rows.Scan(&id, &hash, &inserted); err != nil {
+			rows.Close()
+			return nil, upserted{}, fmt.Errorf("failed to insert placemarks: %w", err)
+		}
+		stored[hash] = id
+		if !inserted {
+			updatedIDs = append(updatedIDs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, upserted{}, fmt.Errorf("failed to insert placemarks: %w", err)
+	}
+
+	// Rows the upsert left alone aren't returned.
+	written := make(map[string]bool, len(stored))
+	var unchanged []string
+	for _, hash := range hashes {
+		if _, ok := stored[hash]; ok {
+			written[hash] = true
+		} else {
+			unchanged = append(unchanged, hash)
+		}
+	}
+	if len(unchanged) > 0 {
+		rows, err := tx.Query(ctx, `SELECT content_hash, id FROM placemarks WHERE content_hash = ANY($1)`, unchanged)
+		if err != nil {
+			return nil, upserted{}, fmt.Errorf("failed to look up unchanged placemarks: %w", err)
+		}
+		for rows.Next() {
+			var hash string
+			var id int
+			if err := rows.Scan(&hash, &id); err != nil {
+				rows.Close()
+				return nil, upserted{}, fmt.Errorf("failed to look up unchanged placemarks: %w", err)
+			}
+			stored[hash] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, upserted{}, fmt.Errorf("failed to look up unchanged placemarks: %w", err)
+		}
+	}
+	for i, hash := range hashes {
+		ids[i] = stored[hash]
+	}
+
+	if len(updatedIDs) > 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM placemark_data WHERE placemark_id = ANY($1)`, updatedIDs); err != nil {
+			return nil, upserted{}, fmt.Errorf("failed to replace extended data: %w", err)
+		}
+	}
+
+	var data [][]interface{}
+	for i, pm := range placemarks {
+		if !written[hashes[i]] {
+			continue
+		}
+		for key, value := range pm.ExtendedData {
+			data = append(data, []interface{}{ids[i], key, value})
+		}
+	}
+	if len(data) > 0 {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"placemark_data"},
+			[]string{"placemark_id", "key", "value"}, pgx.CopyFromRows(data)); err != nil {
+			return nil, upserted{}, fmt.Errorf("failed to copy extended data: %w", err)
+		}
+	}
+
+	return ids, upserted{Updated: len(updatedIDs), Unchanged: len(unchanged)}, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// upsertOnHash makes a re-imported placemark replace the stored row with
+// the same content hash instead of adding a duplicate. A thumbnail chosen
+// through the API is kept. The row is only written when a column or its
+// extended data would change, so an unchanged re-import leaves version and
+// updated_at alone and RETURNING skips it. extendedData is the SQL for the
+// incoming extended data as a jsonb object. (xmax = 0) in RETURNING tells a
+// fresh insert from an update.
+func upsertOnHash(extendedData string) string {
+	return `
+	ON CONFLICT (content_hash) DO UPDATE SET
+		description = EXCLUDED.description,
+		description_raw = EXCLUDED.description_raw,
+		description_format = EXCLUDED.description_format,
+		style_id = EXCLUDED.style_id,
+		folder_path = EXCLUDED.folder_path,
+		geometry_type = EXCLUDED.geometry_type,
+		geom = EXCLUDED.geom,
+		coordinates_raw = EXCLUDED.coordinates_raw,
+		gx_media_links = EXCLUDED.gx_media_links,
+		source = EXCLUDED.source,
+		time_begin = EXCLUDED.time_begin,
+		time_end = EXCLUDED.time_end,
+		track_times = EXCLUDED.track_times
+	WHERE (placemarks.description, placemarks.description_raw, placemarks.description_format,
+	       placemarks.style_id, placemarks.folder_path, placemarks.geometry_type, placemarks.geom,
+	       placemarks.coordinates_raw, placemarks.gx_media_links, placemarks.source,
+	       placemarks.time_begin, placemarks.time_end, placemarks.track_times,
+	       COALESCE((SELECT jsonb_object_agg(key, value) FROM placemark_data WHERE placemark_id = placemarks.id), '{}'))
+	IS DISTINCT FROM (EXCLUDED.description, EXCLUDED.description_raw, EXCLUDED.description_format,
+	       EXCLUDED.style_id, EXCLUDED.folder_path, EXCLUDED.geometry_type, EXCLUDED.geom,
+	       EXCLUDED.coordinates_raw, EXCLUDED.gx_media_links, EXCLUDED.source,
+	       EXCLUDED.time_begin, EXCLUDED.time_end, EXCLUDED.track_times,
+	       ` + extendedData + `)`
+}
+
+// extendedDataJSON is pm's extended data as the jsonb object upsertOnHash
+// compares against the stored rows.
+func extendedDataJSON(pm kml.PlacemarkRecord) map[string]string {
+	if pm.ExtendedData == nil {
+		return map[string]string{}
+	}
+	return pm.ExtendedData
+}
+
+// contentHash identifies a placemark by its name, geometry WKT, and folder
+// path as imported (after any geometry repair), before snapping or other
+// post-processing.
+func contentHash(pm kml.PlacemarkRecord) string {
+	// A JSON array keeps the fields unambiguous whatever they contain.
+	key, _ := json.Marshal([]interface{}{pm.Name, pm.GeomWKT, pm.FolderPath})
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// dedupePlacemarks keeps the first of placemarks sharing a content hash,
+// since one statement can't upsert the same row twice. It returns how many
+// were dropped.
+func dedupePlacemarks(placemarks []kml.PlacemarkRecord) ([]kml.PlacemarkRecord, int) {
+	seen := make(map[string]bool, len(placemarks))
+	kept := placemarks[:0:0]
+	for _, pm := range placemarks {
+		hash := contentHash(pm)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		kept = append(kept, pm)
+	}
+	return kept, len(placemarks) - len(kept)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+func TestContentHash(t *testing.T) {
+	base := kml.PlacemarkRecord{Name: "Stage", GeomWKT: "POINT(1 2)", FolderPath: []string{"Venues"}}
+	tests := []struct {
+		name string
+		pm   kml.PlacemarkRecord
+		same bool
+	}{
+		{"identical", base, true},
+		{"description ignored", kml.PlacemarkRecord{Name: "Stage", Description: "new", GeomWKT: "POINT(1 2)", FolderPath: []string{"Venues"}}, true},
+		{"style ignored", kml.PlacemarkRecord{Name: "Stage", StyleID: "s1", GeomWKT: "POINT(1 2)", FolderPath: []string{"Venues"}}, true},
+		{"name differs", kml.PlacemarkRecord{Name: "Gate", GeomWKT: "POINT(1 2)", FolderPath: []string{"Venues"}}, false},
+		{"geometry differs", kml.PlacemarkRecord{Name: "Stage", GeomWKT: "POINT(1 3)", FolderPath: []string{"Venues"}}, false},
+		{"folder differs", kml.PlacemarkRecord{Name: "Stage", GeomWKT: "POINT(1 2)", FolderPath: []string{"Other"}}, false},
+		{"folder split differs", kml.PlacemarkRecord{Name: "Stage", GeomWKT: "POINT(1 2)", FolderPath: []string{"Ven", "ues"}}, false},
+	}
+	want := contentHash(base)
+	if len(want) != 64 {
+		t.Fatalf("contentHash length = %d, want 64", len(want))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentHash(tt.pm) == want; got != tt.same {
+				t.Errorf("same hash = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+func TestDedupePlacemarks(t *testing.T) {
+	a := kml.PlacemarkRecord{Name: "A", GeomWKT: "POINT(0 0)", Description: "first"}
+	aAgain := kml.PlacemarkRecord{Name: "A", GeomWKT: "POINT(0 0)", Description: "second"}
+	b := kml.PlacemarkRecord{Name: "B", GeomWKT: "POINT(0 0)"}
+
+	tests := []struct {
+		name        string
+		in          []kml.PlacemarkRecord
+		wantNames   []string
+		wantDropped int
+	}{
+		{"empty", nil, nil, 0},
+		{"no duplicates", []kml.PlacemarkRecord{a, b}, []string{"A", "B"}, 0},
+		{"duplicate dropped", []kml.PlacemarkRecord{a, b, aAgain}, []string{"A", "B"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, dropped := dedupePlacemarks(tt.in)
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+			if len(kept) != len(tt.wantNames) {
+				t.Fatalf("kept %d placemarks, want %d", len(kept), len(tt.wantNames))
+			}
+			for i, pm := range kept {
+				if pm.Name != tt.wantNames[i] {
+					t.Errorf("kept[%d] = %q, want %q", i, pm.Name, tt.wantNames[i])
+				}
+				if pm.Name == "A" && pm.Description != "first" {
+					t.Errorf("kept the later duplicate: %q", pm.Description)
+				}
+			}
+		})
+	}
+}
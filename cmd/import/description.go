@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/onnwee/mandalay/internal/sanitize"
+)
+
+// Values of -description-mode: how descriptions are stored.
+const (
+	descriptionModeRaw      = "raw"
+	descriptionModeText     = "text"
+	descriptionModeSanitize = "sanitize"
+)
+
+func validDescriptionMode(mode string) bool {
+	switch mode {
+	case descriptionModeRaw, descriptionModeText, descriptionModeSanitize:
+		return true
+	}
+	return false
+}
+
+// storedDescription returns the description to store for mode, and the
+// source to keep in description_raw when that differs from it. Sanitizing
+// follows the API's safe mode, so Markdown has its HTML stripped rather
+// than cleaned.
+func storedDescription(mode, format, description string) (string, *string) {
+	var stored string
+	switch mode {
+	case descriptionModeText:
+		stored = sanitize.Text(description)
+	case descriptionModeSanitize:
+		stored = sanitize.ApplyFormat(sanitize.ModeSafe, format, description)
+	default:
+		return description, nil
+	}
+	if stored == description {
+		return stored, nil
+	}
+	return stored, &description
+}
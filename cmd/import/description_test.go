@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/onnwee/mandalay/internal/sanitize"
+)
+
+func TestValidDescriptionMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want bool
+	}{
+		{"raw", true},
+		{"text", true},
+		{"sanitize", true},
+		{"", false},
+		{"safe", false},
+		{"RAW", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if got := validDescriptionMode(tt.mode); got != tt.want {
+				t.Errorf("validDescriptionMode(%q) = %v, want %v", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoredDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		format      string
+		description string
+		want        string
+		wantRaw     bool
+	}{
+		{"raw keeps source", descriptionModeRaw, sanitize.FormatHTML, "<b>Hi</b><script>x</script>", "<b>Hi</b><script>x</script>", false},
+		{"text strips markup", descriptionModeText, sanitize.FormatHTML, "<b>Hi</b> there", "Hi there", true},
+		{"sanitize removes script", descriptionModeSanitize, sanitize.FormatHTML, "<b>Hi</b><script>x</script>", "<b>Hi</b>", true},
+		{"sanitize markdown strips html", descriptionModeSanitize, sanitize.FormatMarkdown, "**Hi** <i>x</i>", "**Hi** x", true},
+		{"unchanged keeps no raw", descriptionModeSanitize, sanitize.FormatHTML, "plain", "plain", false},
+		{"empty", descriptionModeText, sanitize.FormatHTML, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, raw := storedDescription(tt.mode, tt.format, tt.description)
+			if got != tt.want {
+				t.Errorf("stored = %q, want %q", got, tt.want)
+			}
+			if (raw != nil) != tt.wantRaw {
+				t.Fatalf("raw = %v, want set %v", raw, tt.wantRaw)
+			}
+			if raw != nil && *raw != tt.description {
+				t.Errorf("raw = %q, want %q", *raw, tt.description)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// importDiff compares parsed placemarks with the database by content hash.
+// A placemark is new when no stored row has its hash, changed when one does
+// but a field the import would overwrite differs, and unchanged otherwise.
+type importDiff struct {
+	New          int
+	Changed      int
+	Unchanged    int
+	NewNames     []string
+	ChangedNames []string
+}
+
+// storedPlacemark is what diffPlacemarks reads back for a matching hash.
+type storedPlacemark struct {
+	description       *string
+	descriptionFormat string
+	styleID           *string
+	mediaLinks        []string
+	source            *string
+	timeBegin         *time.Time
+	timeEnd           *time.Time
+	trackTimes        []time.Time
+	extendedData      map[string]string
+}
+
+// diffPlacemarks reports what importing placemarks with opts would change.
+// It only reads, so tx may be read-only. styleIDs are the styles the import
+// would write, since a placemark's style is only stored when it exists.
+// Placemarks should already be geometry-checked and deduplicated, as the
+// import would see them.
+func diffPlacemarks(ctx context.Context, tx pgx.Tx, placemarks []kml.PlacemarkRecord, styleIDs map[string]bool, opts importOptions) (importDiff, error) {
+	var diff importDiff
+	if len(placemarks) == 0 {
+		return diff, nil
+	}
+
+	hashes := make([]string, len(placemarks))
+	for i, pm := range placemarks {
+		hashes[i] = contentHash(pm)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT p.content_hash, p.description, p.description_format, p.style_id, p.gx_media_links,
+		       p.source, p.time_begin, p.time_end, p.track_times,
+		       COALESCE((SELECT jsonb_object_agg(key, value) FROM placemark_data WHERE placemark_id = p.id), '{}')
+		FROM placemarks p
+		WHERE p.content_hash = ANY($1)
+	`, hashes)
+	if err != nil {
+		return diff, fmt.Errorf("failed to query stored placemarks: %w", err)
+	}
+	stored := make(map[string]storedPlacemark)
+	for rows.Next() {
+		var (
+			hash string
+			sp   storedPlacemark
+		)
+		if err := rows.Scan(&hash, &sp.description, &sp.descriptionFormat, &sp.styleID, &sp.mediaLinks,
+			&sp.source, &sp.timeBegin, &sp.timeEnd, &sp.trackTimes, &sp.extendedData); err != nil {
+			rows.Close()
+			return diff, fmt.Errorf("failed to scan stored placemark: %w", err)
+		}
+		stored[hash] = sp
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return diff, fmt.Errorf("failed to query stored placemarks: %w", err)
+	}
+
+	for i, pm := range placemarks {
+		sp, ok := stored[hashes[i]]
+		switch {
+		case !ok:
+			diff.New++
+			diff.NewNames = append(diff.NewNames, pm.Name)
+		case placemarkChanged(pm, sp, styleIDs, opts):
+			diff.Changed++
+			diff.ChangedNames = append(diff.ChangedNames, pm.Name)
+		default:
+			diff.Unchanged++
+		}
+	}
+	return diff, nil
+}
+
+// placemarkChanged reports whether upserting pm would alter sp. The name,
+// geometry, and folder path are part of the hash, so they match already.
+func placemarkChanged(pm kml.PlacemarkRecord, sp storedPlacemark, styleIDs map[string]bool, opts importOptions) bool {
+	description, _ := storedDescription(opts.DescriptionMode, opts.DescriptionFormat, pm.Description)
+	var styleID string
+	if styleIDs[pm.StyleID] {
+		styleID = pm.StyleID
+	}
+	return deref(sp.description) != description ||
+		sp.descriptionFormat != opts.DescriptionFormat ||
+		deref(sp.styleID) != styleID ||
+		!slices.Equal(sp.mediaLinks, pm.MediaLinks) ||
+		deref(sp.source) != opts.Source ||
+		!sameTime(sp.timeBegin, pm.TimeBegin) ||
+		!sameTime(sp.timeEnd, pm.TimeEnd) ||
+		!slices.EqualFunc(sp.trackTimes, pm.TrackTimes, time.Time.Equal) ||
+		!maps.Equal(sp.extendedData, pm.ExtendedData)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
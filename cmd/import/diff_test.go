@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+func TestPlacemarkChanged(t *testing.T) {
+	begin := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	sameBegin := begin.In(time.FixedZone("CEST", 2*3600))
+	later := begin.Add(time.Hour)
+	desc := "<b>Stage</b>"
+	style := "stage"
+	source := "festival.kml"
+	opts := importOptions{Source: source, DescriptionFormat: "html", DescriptionMode: descriptionModeRaw}
+	styles := map[string]bool{"stage": true}
+
+	stored := func() storedPlacemark {
+		return storedPlacemark{
+			description:       &desc,
+			descriptionFormat: "html",
+			styleID:           &style,
+			mediaLinks:        []string{"https://example.com/a.jpg"},
+			source:            &source,
+			timeBegin:         &begin,
+			extendedData:      map[string]string{},
+		}
+	}
+	parsed := func() kml.PlacemarkRecord {
+		return kml.PlacemarkRecord{
+			Name:        "Stage",
+			Description: desc,
+			StyleID:     "stage",
+			MediaLinks:  []string{"https://example.com/a.jpg"},
+			TimeBegin:   &sameBegin,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		pm     func(*kml.PlacemarkRecord)
+		sp     func(*storedPlacemark)
+		opts   func(*importOptions)
+		styles map[string]bool
+		want   bool
+	}{
+		{name: "unchanged", want: false},
+		{name: "description", pm: func(pm *kml.PlacemarkRecord) { pm.Description = "new" }, want: true},
+		{name: "stored as text", opts: func(o *importOptions) { o.DescriptionMode = descriptionModeText }, want: true},
+		{name: "format", opts: func(o *importOptions) { o.DescriptionFormat = "markdown" }, want: true},
+		{name: "style missing from import", styles: map[string]bool{}, want: true},
+		{name: "unknown style matches none", pm: func(pm *kml.PlacemarkRecord) { pm.StyleID = "other" }, sp: func(sp *storedPlacemark) { sp.styleID = nil }, want: false},
+		{name: "media links", pm: func(pm *kml.PlacemarkRecord) { pm.MediaLinks = nil }, want: true},
+		{name: "source", opts: func(o *importOptions) { o.Source = "" }, want: true},
+		{name: "time end added", pm: func(pm *kml.PlacemarkRecord) { pm.TimeEnd = &later }, want: true},
+		{name: "time begin moved", pm: func(pm *kml.PlacemarkRecord) { pm.TimeBegin = &later }, want: true},
+		{name: "track times", pm: func(pm *kml.PlacemarkRecord) { pm.TrackTimes = []time.Time{begin} }, want: true},
+		{name: "extended data", pm: func(pm *kml.PlacemarkRecord) { pm.ExtendedData = map[string]string{"capacity": "500"} }, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, sp, o, s := parsed(), stored(), opts, styles
+			if tt.pm != nil {
+				tt.pm(&pm)
+			}
+			if tt.sp != nil {
+				tt.sp(&sp)
+			}
+			if tt.opts != nil {
+				tt.opts(&o)
+			}
+			if tt.styles != nil {
+				s = tt.styles
+			}
+			if got := placemarkChanged(pm, sp, s, o); got != tt.want {
+				t.Errorf("placemarkChanged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameTime(t *testing.T) {
+	a := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := a.In(time.FixedZone("EDT", -4*3600))
+	c := a.Add(time.Second)
+	tests := []struct {
+		name string
+		a, b *time.Time
+		want bool
+	}{
+		{"both nil", nil, nil, true},
+		{"one nil", &a, nil, false},
+		{"other nil", nil, &a, false},
+		{"same instant", &a, &b, true},
+		{"different", &a, &c, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameTime(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
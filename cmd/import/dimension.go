@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Geometry dimensions accepted by -force-dimension. An empty value keeps
+// each geometry as imported.
+const (
+	dimension2D = "2d"
+	dimension3D = "3d"
+)
+
+func validDimension(d string) bool {
+	return d == "" || d == dimension2D || d == dimension3D
+}
+
+// forceDimension coerces the geometries of ids to the requested dimension:
+// 2d drops Z (and M) with ST_Force2D, 3d adds Z = 0 where missing with
+// ST_Force3D. It returns how many geometries were changed.
+func forceDimension(ctx context.Context, tx pgx.Tx, ids []int, dimension string) (int64, error) {
+	var query string
+	switch dimension {
+	case dimension2D:
+		query = `UPDATE placemarks SET geom = ST_Force2D(geom)
+		         WHERE id = ANY($1) AND (ST_NDims(geom) > 2 OR ST_HasM(geom))`
+	case dimension3D:
+		query = `UPDATE placemarks SET geom = ST_Force3D(geom)
+		         WHERE id = ANY($1) AND NOT ST_HasZ(geom)`
+	default:
+		return 0, nil
+	}
+
+	tag, err := tx.Exec(ctx, query, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to force %s geometries: %w", dimension, err)
+	}
+	return tag.RowsAffected(), nil
+}
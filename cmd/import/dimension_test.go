@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestValidDimension(t *testing.T) {
+	tests := []struct {
+		dimension string
+		want      bool
+	}{
+		{"", true},
+		{"2d", true},
+		{"3d", true},
+		{"2D", false},
+		{"4d", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dimension, func(t *testing.T) {
+			if got := validDimension(tt.dimension); got != tt.want {
+				t.Errorf("validDimension(%q) = %v, want %v", tt.dimension, got, tt.want)
+			}
+		})
+	}
+}
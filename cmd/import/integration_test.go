@@ -0,0 +1,732 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/onnwee/mandalay/internal/kml"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+const fixtureKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document>
+	<Style id="stage"><IconStyle><color>ff0000ff</color><Icon><href>stage.png</href></Icon></IconStyle></Style>
+	<Folder><name>Venue</name>
+		<Placemark><name>Main Stage</name><description><![CDATA[<b>Headliner</b> tonight]]></description>
+			<styleUrl>#stage</styleUrl>
+			<ExtendedData><Data name="capacity"><value>500</value></Data></ExtendedData>
+			<TimeStamp><when>2017-10-01T21:00:00Z</when></TimeStamp>
+			<Point><coordinates>-115.17,36.09</coordinates></Point></Placemark>
+		<Placemark><name>Gate</name>
+			<ExtendedData><Data name="capacity"><value>50</value></Data></ExtendedData>
+			<Point><coordinates>-115.172,36.094</coordinates></Point></Placemark>
+		<Placemark><name>Fence</name>
+			<Polygon><outerBoundaryIs><LinearRing><coordinates>
+				-115.18,36.08 -115.17,36.08 -115.16,36.08 -115.16,36.09 -115.16,36.10
+				-115.17,36.10 -115.18,36.10 -115.18,36.09 -115.18,36.08
+			</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>
+	</Folder>
+	<Placemark><name>2017-10-02 Walkway</name>
+		<LineString><coordinates>-115.17,36.09 -115.16,36.1</coordinates></LineString></Placemark>
+</Document></kml>`
+
+// TestImportAndQuery imports fixtureKML into a migrated schema the way main
+// does, then runs the API store's queries over the result.
+func TestImportAndQuery(t *testing.T) {
+	ctx := context.Background()
+	config := testDatabase(t)
+	pool := testPool(t, config)
+	if _, err := migrate(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := kml.Parse(ctx, []byte(fixtureKML), kml.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readTx := readOnlyTx(t, ctx, pool)
+	placemarks, check, err := checkGeometries(ctx, readTx, parsed.Placemarks, false)
+	if err != nil {
+		t.Fatalf("checkGeometries: %v", err)
+	}
+	if len(placemarks) != 4 || len(check.Skipped) != 0 {
+		t.Fatalf("checkGeometries kept %d, skipped %d; want 4 and 0", len(placemarks), len(check.Skipped))
+	}
+	if err := importStyles(ctx, pool, parsed.Styles); err != nil {
+		t.Fatalf("importStyles: %v", err)
+	}
+	if err := linkHighlightStyles(ctx, pool, parsed.HighlightStyles); err != nil {
+		t.Fatalf("linkHighlightStyles: %v", err)
+	}
+	styleIDs := map[string]bool{"stage": true}
+
+	base := importOptions{Source: "fixture", DescriptionFormat: "html", DescriptionMode: descriptionModeRaw}
+	withRowByRow, withBatches, withSkip := base, base, base
+	withRowByRow.RowByRow = true
+	withBatches.BatchSize = 3
+	withSkip.SkipExisting = true
+
+	// Only Gate's extended data differs, which the upsert must still see.
+	changed := slices.Clone(placemarks)
+	for i := range changed {
+		if changed[i].Name == "Gate" {
+			changed[i].ExtendedData = map[string]string{"capacity": "60"}
+		}
+	}
+
+	var firstVersions map[int]rowVersion
+	imports := []struct {
+		name          string
+		placemarks    []kml.PlacemarkRecord
+		opts          importOptions
+		wantImported  int
+		wantUpdated   int
+		wantUnchanged int
+		wantExisting  int
+	}{
+		{"copy", placemarks, base, 4, 0, 0, 0},
+		{"row by row unchanged", placemarks, withRowByRow, 4, 0, 4, 0},
+		{"batched unchanged", placemarks, withBatches, 4, 0, 4, 0},
+		{"copy with changed extended data", changed, base, 4, 1, 3, 0},
+		{"row by row restoring extended data", placemarks, withRowByRow, 4, 1, 3, 0},
+		{"skip existing", placemarks, withSkip, 0, 0, 0, 4},
+	}
+	for _, tt := range imports {
+		result, err := importPlacemarks(ctx, pool, tt.placemarks, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: importPlacemarks: %v", tt.name, err)
+		}
+		if result.Imported != tt.wantImported || result.Updated != tt.wantUpdated ||
+			result.Unchanged != tt.wantUnchanged || result.Existing != tt.wantExisting {
+			t.Errorf("%s: imported %d, updated %d, unchanged %d, existing %d; want %d, %d, %d, %d", tt.name,
+				result.Imported, result.Updated, result.Unchanged, result.Existing,
+				tt.wantImported, tt.wantUpdated, tt.wantUnchanged, tt.wantExisting)
+		}
+
+		versions := storedVersions(t, ctx, pool)
+		if firstVersions == nil {
+			firstVersions = versions
+			continue
+		}
+		if tt.wantUpdated == 0 && tt.wantExisting == 0 && !maps.Equal(versions, firstVersions) {
+			t.Errorf("%s: an unchanged import rewrote rows: versions %v, want %v", tt.name, versions, firstVersions)
+		}
+	}
+	if gate := storedExtendedData(t, ctx, pool, "Gate"); !maps.Equal(gate, map[string]string{"capacity": "50"}) {
+		t.Errorf("Gate extended data = %v after restoring, want capacity 50", gate)
+	}
+
+	d, err := diffPlacemarks(ctx, readTx, placemarks, styleIDs, base)
+	if err != nil {
+		t.Fatalf("diffPlacemarks: %v", err)
+	}
+	if d.New != 0 || d.Changed != 0 || d.Unchanged != 4 {
+		t.Errorf("diff = %d new, %d changed, %d unchanged; want 0, 0, 4", d.New, d.Changed, d.Unchanged)
+	}
+	relabelled := base
+	relabelled.Source = "other"
+	if d, err = diffPlacemarks(ctx, readTx, placemarks, styleIDs, relabelled); err != nil || d.Changed != 4 {
+		t.Errorf("diff with a new source = %+v, %v; want 4 changed", d, err)
+	}
+
+	run := store.ImportRun{KMLPath: "fixture.kml", Imported: 4, Skipped: kml.TallySkips(nil), StartedAt: time.Now(), FinishedAt: time.Now()}
+	if err := store.RecordImportRun(ctx, pool, run); err != nil {
+		t.Fatalf("RecordImportRun: %v", err)
+	}
+	if err := store.NotifyChanges(ctx, pool); err != nil {
+		t.Fatalf("NotifyChanges: %v", err)
+	}
+
+	// The API's pool prepares its statements on connect, so it is opened
+	// once the schema exists.
+	apiConfig := config.Copy()
+	apiConfig.AfterConnect = store.PrepareStatements
+	s := store.NewPlacemarkStore(testPool(t, apiConfig))
+	testStoreQueries(t, ctx, s)
+}
+
+// readOnlyTx begins a read-only transaction on pool, as main does for the
+// geometry check and -diff, and rolls it back when the test ends.
+func readOnlyTx(t *testing.T, ctx context.Context, pool *pgxpool.Pool) pgx.Tx {
+	t.Helper()
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback(context.Background()) })
+	return tx
+}
+
+// rowVersion is a placemark's change tracking, which only a write moves.
+type rowVersion struct {
+	version   int64
+	updatedAt time.Time
+}
+
+// storedVersions reads every placemark's version and updated_at by id.
+func storedVersions(t *testing.T, ctx context.Context, pool *pgxpool.Pool) map[int]rowVersion {
+	t.Helper()
+	rows, err := pool.Query(ctx, `SELECT id, version, updated_at FROM placemarks`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make(map[int]rowVersion)
+	for rows.Next() {
+		var id int
+		var v rowVersion
+		if err := rows.Scan(&id, &v.version, &v.updatedAt); err != nil {
+			t.Fatal(err)
+		}
+		versions[id] = v
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+// storedExtendedData reads the extended data of the placemark named name.
+func storedExtendedData(t *testing.T, ctx context.Context, pool *pgxpool.Pool, name string) map[string]string {
+	t.Helper()
+	var data map[string]string
+	err := pool.QueryRow(ctx, `
+		SELECT COALESCE(jsonb_object_agg(d.key, d.value), '{}')
+		FROM placemarks p JOIN placemark_data d ON d.placemark_id = p.id
+		WHERE p.name = $1`, name).Scan(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// fenceVertices counts the points in the Fence polygon that list returns at
+// tolerance.
+func fenceVertices(t *testing.T, list func(tolerance float64) ([]store.Placemark, error), tolerance float64) int {
+	t.Helper()
+	placemarks, err := list(tolerance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range placemarks {
+		if p.Name != "Fence" {
+			continue
+		}
+		var polygon struct {
+			Coordinates [][][]float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal([]byte(p.Geometry), &polygon); err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for _, ring := range polygon.Coordinates {
+			count += len(ring)
+		}
+		return count
+	}
+	t.Fatal("Fence was not listed")
+	return 0
+}
+
+// datedEventNames lists the names of the events with a timestamp, in order.
+func datedEventNames(events []store.TimelineEvent) []string {
+	var names []string
+	for _, e := range events {
+		if e.Timestamp != nil {
+			names = append(names, e.Name)
+		}
+	}
+	return names
+}
+
+// testStoreQueries runs the store's queries against the imported fixture.
+func testStoreQueries(t *testing.T, ctx context.Context, s *store.PlacemarkStore) {
+	venue := store.BoundingBox{MinLon: -115.2, MinLat: 36.0, MaxLon: -115.1, MaxLat: 36.2}
+
+	var stageID int
+	t.Run("List", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			limit, offset int
+			filter        store.ListFilter
+			wantNames     []string
+			wantTotal     int
+		}{
+			{"all", 10, 0, store.ListFilter{}, []string{"Main Stage", "Gate", "Fence", "2017-10-02 Walkway"}, 4},
+			{"page past a full page", 2, 2, store.ListFilter{}, []string{"Fence", "2017-10-02 Walkway"}, 4},
+			{"folder", 10, 0, store.ListFilter{Folder: "Venue"}, []string{"Main Stage", "Gate", "Fence"}, 3},
+			{"geometry type", 10, 0, store.ListFilter{GeometryTypes: []string{"Polygon"}}, []string{"Fence"}, 1},
+			{"data", 10, 0, store.ListFilter{Data: []store.KVPair{{Key: "capacity", Value: "50"}}}, []string{"Gate"}, 1},
+			{"sorted by name", 10, 0, store.ListFilter{Sort: "name"}, []string{"2017-10-02 Walkway", "Fence", "Gate", "Main Stage"}, 4},
+			{"simplified", 10, 0, store.ListFilter{Tolerance: 0.001}, []string{"Main Stage", "Gate", "Fence", "2017-10-02 Walkway"}, 4},
+			{"past the end", 10, 10, store.ListFilter{}, nil, 4},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				placemarks, total, err := s.List(ctx, tt.limit, tt.offset, tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var names []string
+				for _, p := range placemarks {
+					names = append(names, p.Name)
+					if p.Name == "Main Stage" {
+						stageID = p.ID
+					}
+				}
+				if !slices.Equal(names, tt.wantNames) || total != tt.wantTotal {
+					t.Errorf("List = %v (total %d), want %v (total %d)", names, total, tt.wantNames, tt.wantTotal)
+				}
+			})
+		}
+	})
+	if stageID == 0 {
+		t.Fatal("Main Stage was not listed")
+	}
+
+	t.Run("simplification", func(t *testing.T) {
+		// Fence is a rectangle with a point midway along each side, so
+		// simplifying leaves only the corners.
+		paths := []struct {
+			name string
+			list func(tolerance float64) ([]store.Placemark, error)
+		}{
+			{"List", func(tolerance float64) ([]store.Placemark, error) {
+				placemarks, _, err := s.List(ctx, 10, 0, store.ListFilter{Tolerance: tolerance})
+				return placemarks, err
+			}},
+			{"ListAfter", func(tolerance float64) ([]store.Placemark, error) {
+				return s.ListAfter(ctx, 0, 10, store.ListFilter{Tolerance: tolerance})
+			}},
+			{"GetInBBox", func(tolerance float64) ([]store.Placemark, error) {
+				return s.GetInBBox(ctx, venue, 10, tolerance)
+			}},
+		}
+		for _, tt := range paths {
+			t.Run(tt.name, func(t *testing.T) {
+				full := fenceVertices(t, tt.list, 0)
+				simplified := fenceVertices(t, tt.list, 0.001)
+				if full != 9 || simplified != 5 {
+					t.Errorf("Fence has %d vertices, %d simplified; want 9 and 5", full, simplified)
+				}
+			})
+		}
+	})
+
+	t.Run("EachListed with data", func(t *testing.T) {
+		var data []store.KVPair
+		err := s.EachListed(ctx, 1, 0, store.ListFilter{}, true, func(p *store.Placemark) error {
+			data = p.ExtendedData
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 1 || data[0] != (store.KVPair{Key: "capacity", Value: "500"}) {
+			t.Errorf("extended data = %v, want capacity=500", data)
+		}
+	})
+
+	t.Run("exports", func(t *testing.T) {
+		at := func(day, hour int) *time.Time {
+			ts := time.Date(2017, 10, day, hour, 0, 0, 0, time.UTC)
+			return &ts
+		}
+		tests := []struct {
+			name        string
+			folder      string
+			window      store.TimeWindow
+			wantNames   []string
+			wantSources []string
+		}{
+			{"all", "", store.TimeWindow{},
+				[]string{"Main Stage", "Gate", "Fence", "2017-10-02 Walkway"},
+				[]string{store.TimestampFromColumn, "", "", store.TimestampFromName}},
+			{"folder", "Venue", store.TimeWindow{},
+				[]string{"Main Stage", "Gate", "Fence"},
+				[]string{store.TimestampFromColumn, "", ""}},
+			{"from a name date", "", store.TimeWindow{From: at(2, 0)},
+				[]string{"2017-10-02 Walkway"}, []string{store.TimestampFromName}},
+			{"to before the name date", "", store.TimeWindow{To: at(1, 23)},
+				[]string{"Main Stage"}, []string{store.TimestampFromColumn}},
+			{"empty window", "", store.TimeWindow{From: at(3, 0)}, nil, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				exports := []struct {
+					name string
+					each func(func(*store.Placemark) error) error
+				}{
+					{"EachPlacemark", func(fn func(*store.Placemark) error) error {
+						return s.EachPlacemark(ctx, tt.folder, tt.window, fn)
+					}},
+					{"EachPlacemarkWithData", func(fn func(*store.Placemark) error) error {
+						return s.EachPlacemarkWithData(ctx, tt.folder, tt.window, fn)
+					}},
+				}
+				for _, export := range exports {
+					var names, sources []string
+					err := export.each(func(p *store.Placemark) error {
+						names = append(names, p.Name)
+						sources = append(sources, p.TimestampSource)
+						return nil
+					})
+					if err != nil {
+						t.Fatalf("%s: %v", export.name, err)
+					}
+					// EachPlacemarkWithData orders by folder path first.
+					slices.Sort(names)
+					want := slices.Clone(tt.wantNames)
+					slices.Sort(want)
+					if !slices.Equal(names, want) {
+						t.Errorf("%s = %v, want %v", export.name, names, tt.wantNames)
+					}
+					if export.name == "EachPlacemark" && !slices.Equal(sources, tt.wantSources) {
+						t.Errorf("%s timestamp sources = %v, want %v", export.name, sources, tt.wantSources)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("GetByID", func(t *testing.T) {
+		p, err := s.GetByID(ctx, stageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != "Main Stage" || p.StyleID == nil || *p.StyleID != "stage" || p.Timestamp == nil {
+			t.Errorf("GetByID = %+v", p)
+		}
+		if _, err := s.GetByID(ctx, -1); !errors.Is(err, store.ErrPlacemarkNotFound) {
+			t.Errorf("GetByID(-1) error = %v, want ErrPlacemarkNotFound", err)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		results, total, err := s.Search(ctx, "headliner", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(results) != 1 || results[0].Name != "Main Stage" {
+			t.Errorf("Search = %+v (total %d), want Main Stage", results, total)
+		}
+	})
+
+	t.Run("GetTimeline", func(t *testing.T) {
+		// Walkway has no description, which must not drop it.
+		want := []string{"Main Stage", "2017-10-02 Walkway"}
+		events, err := s.GetTimeline(ctx, store.TimeWindow{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := datedEventNames(events); !slices.Equal(names, want) {
+			t.Errorf("GetTimeline dated events = %v, want %v", names, want)
+		}
+		events, err = s.GetTimelineInBBox(ctx, venue, store.TimeWindow{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := datedEventNames(events); !slices.Equal(names, want) {
+			t.Errorf("GetTimelineInBBox dated events = %v, want %v", names, want)
+		}
+	})
+
+	t.Run("GetTimelineHistogram", func(t *testing.T) {
+		h, err := s.GetTimelineHistogram(ctx, "day")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h.Buckets) != 2 {
+			t.Errorf("histogram buckets = %+v, want 2", h.Buckets)
+		}
+	})
+
+	t.Run("GetClusters", func(t *testing.T) {
+		clusters, err := s.GetClusters(ctx, venue, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		for _, c := range clusters {
+			count += c.Count
+		}
+		if count != 4 {
+			t.Errorf("clusters hold %d placemarks, want 4", count)
+		}
+	})
+
+	t.Run("GetFolderBounds", func(t *testing.T) {
+		bounds, err := s.GetFolderBounds(ctx, "Venue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// ST_Extent rounds outward to single precision.
+		want := store.BoundingBox{MinLon: -115.18, MinLat: 36.08, MaxLon: -115.16, MaxLat: 36.1}
+		if bounds == nil || math.Abs(bounds.MinLon-want.MinLon) > 1e-4 || math.Abs(bounds.MinLat-want.MinLat) > 1e-4 ||
+			math.Abs(bounds.MaxLon-want.MaxLon) > 1e-4 || math.Abs(bounds.MaxLat-want.MaxLat) > 1e-4 {
+			t.Errorf("GetFolderBounds = %+v, want about %+v", bounds, want)
+		}
+		if bounds, err := s.GetFolderBounds(ctx, "Nowhere"); err != nil || bounds != nil {
+			t.Errorf("GetFolderBounds(Nowhere) = %+v, %v; want nil", bounds, err)
+		}
+	})
+
+	t.Run("GetStats", func(t *testing.T) {
+		stats, err := s.GetStats(ctx, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats["total_placemarks"] != 4 {
+			t.Errorf("total_placemarks = %v, want 4", stats["total_placemarks"])
+		}
+		if bounds, _ := stats["bounds"].(*store.BoundingBox); bounds == nil {
+			t.Errorf("bounds = %v, want the dataset extent", stats["bounds"])
+		}
+	})
+
+	t.Run("ListDataKeys", func(t *testing.T) {
+		keys, err := s.ListDataKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != (store.DataKey{Key: "capacity", Count: 2}) {
+			t.Errorf("ListDataKeys = %+v, want capacity used twice", keys)
+		}
+	})
+
+	t.Run("EachPlacemarkRow", func(t *testing.T) {
+		var rows int
+		err := s.EachPlacemarkRow(ctx, store.ListFilter{}, func(*store.PlacemarkRow) error {
+			rows++
+			return nil
+		})
+		if err != nil || rows != 4 {
+			t.Errorf("EachPlacemarkRow = %d rows, %v; want 4", rows, err)
+		}
+	})
+
+	t.Run("GetTile", func(t *testing.T) {
+		tile, err := s.GetTile(ctx, 0, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tile) == 0 {
+			t.Error("tile 0/0/0 is empty")
+		}
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		before, err := s.GetByID(ctx, stageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, version, err := s.PatchExtendedData(ctx, stageID, map[string]string{"genre": "rock"}, []string{"capacity"}, &before.Version)
+		if err != nil {
+			t.Fatalf("PatchExtendedData: %v", err)
+		}
+		if len(data) != 1 || data[0] != (store.KVPair{Key: "genre", Value: "rock"}) || version == before.Version {
+			t.Errorf("PatchExtendedData = %v at version %d", data, version)
+		}
+		if _, _, err := s.PatchExtendedData(ctx, stageID, nil, nil, &before.Version); !errors.Is(err, store.ErrVersionMismatch) {
+			t.Errorf("stale PatchExtendedData error = %v, want ErrVersionMismatch", err)
+		}
+		s.InvalidatePlacemark(stageID)
+
+		edited := &store.Placemark{Name: "Main Stage", DescriptionFormat: "html", Geometry: `{"type":"Point","coordinates":[-115.171,36.091]}`}
+		if err := s.Update(ctx, stageID, edited, &version); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		after, err := s.GetByID(ctx, stageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !after.UpdatedAt.After(before.UpdatedAt) || after.Version == version {
+			t.Errorf("Update left updated_at %v and version %d", after.UpdatedAt, after.Version)
+		}
+
+		created := &store.Placemark{Name: "Bar", DescriptionFormat: "html", Geometry: `{"type":"Point","coordinates":[-115.175,36.095]}`}
+		if err := s.Create(ctx, created); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := s.Delete(ctx, created.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		changes, err := s.GetChangedSince(ctx, before.Version, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes.Placemarks) == 0 || len(changes.Deleted) != 1 || changes.Deleted[0].ID != created.ID {
+			t.Errorf("GetChangedSince = %d upserts, deletions %+v", len(changes.Placemarks), changes.Deleted)
+		}
+	})
+}
+
+// TestDescriptionRaw imports descriptions as text and checks that GetByID
+// returns the source alongside, and only when it differs.
+func TestDescriptionRaw(t *testing.T) {
+	ctx := context.Background()
+	config := testDatabase(t)
+	pool := testPool(t, config)
+	if _, err := migrate(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := kml.Parse(ctx, []byte(fixtureKML), kml.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := importOptions{DescriptionFormat: "html", DescriptionMode: descriptionModeText}
+	result, err := importPlacemarks(ctx, pool, parsed.Placemarks, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 4 {
+		t.Fatalf("imported %d placemarks, want 4", result.Imported)
+	}
+
+	apiConfig := config.Copy()
+	apiConfig.AfterConnect = store.PrepareStatements
+	s := store.NewPlacemarkStore(testPool(t, apiConfig))
+
+	tests := []struct {
+		name            string
+		wantDescription string
+		wantRaw         string
+	}{
+		{"Main Stage", "Headliner tonight", "<b>Headliner</b> tonight"},
+		{"Gate", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var id int
+			if err := pool.QueryRow(ctx, `SELECT id FROM placemarks WHERE name = $1`, tt.name).Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			p, err := s.GetByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Description != tt.wantDescription || deref(p.DescriptionRaw) != tt.wantRaw {
+				t.Errorf("description %q, raw %q; want %q, %q", p.Description, deref(p.DescriptionRaw), tt.wantDescription, tt.wantRaw)
+			}
+		})
+	}
+}
+
+const postProcessKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document>
+	<Folder><name>Venue</name>
+		<Placemark><name>Fence</name>
+			<Polygon><outerBoundaryIs><LinearRing><coordinates>
+				-115.18,36.08 -115.16,36.08 -115.16,36.10 -115.18,36.10 -115.18,36.08
+			</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>
+	</Folder>
+	<Folder><name>Paths</name>
+		<Placemark><name>Promenade</name>
+			<LineString><coordinates>-115.15,36.08 -115.15,36.10</coordinates></LineString></Placemark>
+	</Folder>
+	<Folder><name>Broken</name>
+		<Placemark><name>Bowtie</name>
+			<Polygon><outerBoundaryIs><LinearRing><coordinates>
+				0,0 1,1 1,0 0,1 0,0
+			</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>
+	</Folder>
+	<Placemark><name>Stray</name><Point><coordinates>-115.17,36.085</coordinates></Point></Placemark>
+	<Placemark><name>Kiosk</name><Point><coordinates>-115.15005,36.09</coordinates></Point></Placemark>
+	<Placemark><name>Outside</name><Point><coordinates>-115.0,36.0</coordinates></Point></Placemark>
+</Document></kml>`
+
+// TestImportPostProcessing covers geometry repair and the steps run after
+// the insert: -snap-to, -auto-folder-from, and -force-dimension, then
+// -build-routing when pgRouting is installed.
+func TestImportPostProcessing(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t, testDatabase(t))
+	if _, err := migrate(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := kml.Parse(ctx, []byte(postProcessKML), kml.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The parser never writes a ring this short, but PostGIS must reject it
+	// without failing the check.
+	unparsable := kml.PlacemarkRecord{Name: "Sliver", GeometryType: "Polygon", GeomWKT: "POLYGON((0 0,1 1,0 0))"}
+	readTx := readOnlyTx(t, ctx, pool)
+	placemarks, check, err := checkGeometries(ctx, readTx, append(slices.Clone(parsed.Placemarks), unparsable), false)
+	if err != nil {
+		t.Fatalf("checkGeometries: %v", err)
+	}
+	if check.Repaired != 1 || len(placemarks) != 6 || len(check.Skipped) != 1 || check.Skipped[0].Name != "Sliver" {
+		t.Fatalf("checkGeometries repaired %d, kept %d and skipped %v; want 1, 6 and Sliver", check.Repaired, len(placemarks), check.Skipped)
+	}
+	if _, _, err := checkGeometries(ctx, readTx, parsed.Placemarks, true); err == nil {
+		t.Error("strict checkGeometries accepted the bowtie")
+	}
+
+	opts := importOptions{
+		DescriptionFormat: "html",
+		DescriptionMode:   descriptionModeRaw,
+		Snap:              snapConfig{Folder: "Paths", Tolerance: 20},
+		AutoFolder:        autoFolderConfig{RegionFolder: "Venue", Default: "Elsewhere"},
+		Dimension:         dimension3D,
+	}
+	result, err := importPlacemarks(ctx, pool, placemarks, opts)
+	if err != nil {
+		t.Fatalf("importPlacemarks: %v", err)
+	}
+	if result.Snapped != 1 || result.AutoFoldered != 3 || result.Coerced != 6 {
+		t.Errorf("snapped %d, auto-foldered %d, coerced %d; want 1, 3, 6", result.Snapped, result.AutoFoldered, result.Coerced)
+	}
+
+	tests := []struct {
+		name       string
+		wantFolder string
+		wantLon    float64
+	}{
+		{"Stray", "Fence", -115.17},
+		{"Kiosk", "Elsewhere", -115.15},
+		{"Outside", "Elsewhere", -115.0},
+	}
+	for _, tt := range tests {
+		var folder []string
+		var lon float64
+		var dims int
+		if err := pool.QueryRow(ctx, `SELECT folder_path, ST_X(geom), ST_NDims(geom) FROM placemarks WHERE name = $1`, tt.name).
+			Scan(&folder, &lon, &dims); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !slices.Equal(folder, []string{tt.wantFolder}) || math.Abs(lon-tt.wantLon) > 1e-9 || dims != 3 {
+			t.Errorf("%s: folder %v, lon %v, %d dims; want [%s], %v, 3", tt.name, folder, lon, dims, tt.wantFolder, tt.wantLon)
+		}
+	}
+	var original string
+	if err := pool.QueryRow(ctx, `
+		SELECT d.value FROM placemark_data d JOIN placemarks p ON p.id = d.placemark_id
+		WHERE p.name = 'Kiosk' AND d.key = $1
+	`, originalCoordinatesKey).Scan(&original); err != nil || original != "-115.15005,36.09" {
+		t.Errorf("Kiosk original coordinates = %q, %v; want -115.15005,36.09", original, err)
+	}
+
+	edges, err := buildRoutingTopology(ctx, pool)
+	if err != nil && strings.Contains(err.Error(), "pgrouting") {
+		t.Skipf("pgRouting unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("buildRoutingTopology: %v", err)
+	}
+	if edges != 1 {
+		t.Errorf("built %d routing edges, want 1", edges)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// maxLinkedDocumentBytes caps the size of a document fetched for a
+// NetworkLink.
+const maxLinkedDocumentBytes = 256 << 20
+
+// linkFollower fetches the KML and KMZ documents NetworkLinks point to.
+type linkFollower struct {
+	client   *http.Client
+	opts     kml.Options
+	maxDepth int
+	timeout  time.Duration
+	// seen holds every URL fetched, so a cycle of links stops at the first
+	// repeat rather than at maxDepth.
+	seen map[string]bool
+
+	Followed int
+	Failed   int
+}
+
+func newLinkFollower(opts kml.Options, maxDepth int, timeout time.Duration) *linkFollower {
+	return &linkFollower{
+		client:   &http.Client{},
+		opts:     opts,
+		maxDepth: maxDepth,
+		timeout:  timeout,
+		seen:     make(map[string]bool),
+	}
+}
+
+// follow fetches parsed's network links over HTTP and merges what they
+// contain into it, under each link's folder path, then does the same for
+// the links in those documents down to maxDepth. base resolves relative
+// hrefs; it is nil for a local file, whose relative links are not followed.
+// A link that can't be fetched or parsed is logged and skipped.
+func (f *linkFollower) follow(ctx context.Context, parsed *kml.Result, base *url.URL) {
+	f.followLinks(ctx, parsed, parsed.NetworkLinks, base, nil, 1)
+}
+
+func (f *linkFollower) followLinks(ctx context.Context, into *kml.Result, links []kml.LinkRef, base *url.URL, prefix []string, depth int) {
+	for _, link := range links {
+		path := append(append([]string(nil), prefix...), link.LinkedPath()...)
+		if depth > f.maxDepth {
+			log.Printf("Not following network link %q in %v: deeper than -link-depth %d", link.Href, path, f.maxDepth)
+			f.Failed++
+			continue
+		}
+
+		target, err := resolveLink(base, link.Href)
+		if err != nil {
+			log.Printf("Not following network link %q in %v: %v", link.Href, path, err)
+			f.Failed++
+			continue
+		}
+		if f.seen[target.String()] {
+			continue
+		}
+		f.seen[target.String()] = true
+
+		linked, err := f.fetch(ctx, target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to follow network link %s: %v", target, err)
+			f.Failed++
+			continue
+		}
+		f.Followed++
+
+		into.Merge(linked, path)
+		f.followLinks(ctx, into, linked.NetworkLinks, target, path, depth+1)
+	}
+}
+
+// resolveLink resolves href against base, accepting only http and https.
+func resolveLink(base *url.URL, href string) (*url.URL, error) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("invalid href: %w", err)
+	}
+	if base != nil {
+		ref = base.ResolveReference(ref)
+	}
+	if ref.Scheme != "http" && ref.Scheme != "https" {
+		return nil, fmt.Errorf("only http and https links are followed")
+	}
+	return ref, nil
+}
+
+// fetch downloads and parses one linked document within f.timeout.
+func (f *linkFollower) fetch(ctx context.Context, target *url.URL) (*kml.Result, error) {
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLinkedDocumentBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > maxLinkedDocumentBytes {
+		return nil, fmt.Errorf("document exceeds %d bytes", maxLinkedDocumentBytes)
+	}
+	return kml.Parse(ctx, data, f.opts)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+func TestResolveLink(t *testing.T) {
+	base, _ := url.Parse("https://example.com/maps/root.kml")
+	tests := []struct {
+		name    string
+		base    *url.URL
+		href    string
+		want    string
+		wantErr bool
+	}{
+		{"absolute", base, "http://other.example/a.kml", "http://other.example/a.kml", false},
+		{"relative", base, "stages.kml", "https://example.com/maps/stages.kml", false},
+		{"parent", base, "../lots.kmz", "https://example.com/lots.kmz", false},
+		{"relative without base", nil, "stages.kml", "", true},
+		{"file scheme", base, "file:///etc/passwd", "", true},
+		{"invalid", base, "http://%zz", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLink(tt.base, tt.href)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveLink(%q) error = %v, wantErr %v", tt.href, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("resolveLink(%q) = %s, want %s", tt.href, got, tt.want)
+			}
+		})
+	}
+}
+
+func linkDoc(body string) string {
+	return `<?xml version="1.0"?><kml xmlns="http://www.opengis.net/kml/2.2"><Document>` + body + `</Document></kml>`
+}
+
+func TestLinkFollowerFollow(t *testing.T) {
+	docs := map[string]string{
+		"/stages.kml": linkDoc(`
+			<Placemark><name>Main Stage</name><Point><coordinates>1,2</coordinates></Point></Placemark>
+			<NetworkLink><name>Back</name><Link><href>root.kml</href></Link></NetworkLink>
+			<NetworkLink><name>Deeper</name><Link><href>deeper.kml</href></Link></NetworkLink>`),
+		"/root.kml": linkDoc(`
+			<NetworkLink><name>Stages</name><Link><href>stages.kml</href></Link></NetworkLink>`),
+		"/deeper.kml": linkDoc(`
+			<Placemark><name>Deep</name><Point><coordinates>3,4</coordinates></Point></Placemark>
+			<NetworkLink><name>Deepest</name><Link><href>deepest.kml</href></Link></NetworkLink>`),
+		"/deepest.kml": linkDoc(`
+			<Placemark><name>Too Deep</name><Point><coordinates>5,6</coordinates></Point></Placemark>`),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+
+	root, _ := url.Parse(srv.URL + "/root.kml")
+	parsed := &kml.Result{NetworkLinks: []kml.LinkRef{
+		{Name: "Venue", Href: srv.URL + "/root.kml"},
+		{Name: "Missing", Href: "missing.kml"},
+	}}
+
+	f := newLinkFollower(kml.Options{}, 3, time.Second)
+	f.follow(context.Background(), parsed, root)
+
+	got := make(map[string][]string)
+	for _, pm := range parsed.Placemarks {
+		got[pm.Name] = pm.FolderPath
+	}
+	want := map[string][]string{
+		"Main Stage": {"Venue", "Stages"},
+		"Deep":       {"Venue", "Stages", "Deeper"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("placemarks = %v, want %v", got, want)
+	}
+	// root.kml, stages.kml, deeper.kml were fetched; the cycle back to
+	// root.kml was skipped, and missing.kml and the link past -link-depth
+	// failed.
+	if f.Followed != 3 || f.Failed != 2 {
+		t.Errorf("Followed = %d, Failed = %d, want 3 and 2", f.Followed, f.Failed)
+	}
+}
+
+func TestLinkFollowerFetchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "/garbage":
+			w.Write([]byte("not kml"))
+		}
+	}))
+	defer srv.Close()
+
+	f := newLinkFollower(kml.Options{}, 1, time.Second)
+	for _, path := range []string{"/error", "/garbage"} {
+		t.Run(path, func(t *testing.T) {
+			target, _ := url.Parse(srv.URL + path)
+			if _, err := f.fetch(context.Background(), target); err == nil {
+				t.Errorf("fetch(%s) succeeded, want an error", path)
+			}
+		})
+	}
+}
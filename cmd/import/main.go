@@ -2,148 +2,122 @@ package main
 
 import (
 	"context"
-	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/onnwee/mandalay/internal/kml"
+	"github.com/onnwee/mandalay/internal/sanitize"
+	"github.com/onnwee/mandalay/internal/store"
 )
 
-// KML namespace structures
-type KML struct {
-	XMLName  xml.Name `xml:"kml"`
-	Document Document `xml:"Document"`
-}
-
-type Document struct {
-	Name        string   `xml:"name"`
-	Description string   `xml:"description"`
-	Styles      []Style  `xml:"Style"`
-	StyleMaps   []StyleMap `xml:"StyleMap"`
-	Folders     []Folder `xml:"Folder"`
-	Placemarks  []Placemark `xml:"Placemark"`
-}
-
-type Style struct {
-	ID          string      `xml:"id,attr"`
-	IconStyle   *IconStyle  `xml:"IconStyle"`
-	LabelStyle  *LabelStyle `xml:"LabelStyle"`
-	LineStyle   *LineStyle  `xml:"LineStyle"`
-	PolyStyle   *PolyStyle  `xml:"PolyStyle"`
-}
-
-type StyleMap struct {
-	ID string `xml:"id,attr"`
-}
-
-type IconStyle struct {
-	Scale float64 `xml:"scale"`
-	Icon  *Icon   `xml:"Icon"`
-}
-
-type Icon struct {
-	Href string `xml:"href"`
-}
-
-type LabelStyle struct {
-	Scale float64 `xml:"scale"`
-}
-
-type LineStyle struct {
-	Color string  `xml:"color"`
-	Width float64 `xml:"width"`
-}
-
-type PolyStyle struct {
-	Color string `xml:"color"`
-}
-
-type Folder struct {
-	Name       string      `xml:"name"`
-	Placemarks []Placemark `xml:"Placemark"`
-	Folders    []Folder    `xml:"Folder"`
-}
-
-type Placemark struct {
-	Name         string        `xml:"name"`
-	Description  string        `xml:"description"`
-	StyleURL     string        `xml:"styleUrl"`
-	Point        *Point        `xml:"Point"`
-	LineString   *LineString   `xml:"LineString"`
-	Polygon      *Polygon      `xml:"Polygon"`
-	ExtendedData *ExtendedData `xml:"ExtendedData"`
-}
-
-type Point struct {
-	Coordinates string `xml:"coordinates"`
-}
-
-type LineString struct {
-	Coordinates string `xml:"coordinates"`
-}
-
-type Polygon struct {
-	OuterBoundary OuterBoundary   `xml:"outerBoundaryIs"`
-	InnerBoundary []InnerBoundary `xml:"innerBoundaryIs"`
-}
-
-type OuterBoundary struct {
-	LinearRing LinearRing `xml:"LinearRing"`
-}
-
-type InnerBoundary struct {
-	LinearRing LinearRing `xml:"LinearRing"`
-}
-
-type LinearRing struct {
-	Coordinates string `xml:"coordinates"`
-}
-
-type ExtendedData struct {
-	Data []Data `xml:"Data"`
-}
-
-type Data struct {
-	Name  string `xml:"name,attr"`
-	Value string `xml:"value"`
-}
-
-// Database record structures
-type PlacemarkRecord struct {
-	Name           string
-	Description    string
-	StyleID        string
-	FolderPath     []string
-	GeometryType   string
-	GeomWKT        string
-	CoordinatesRaw string
-	MediaLinks     []string
-	ExtendedData   map[string]string
-}
-
 func main() {
 	kmlPath := flag.String("kml", "data/raw/doc.kml", "Path to KML file")
 	truncate := flag.Bool("truncate", false, "Truncate existing data before import")
 	dryRun := flag.Bool("dry-run", false, "Parse KML and print summary without database operations")
+	diff := flag.Bool("diff", false, "Compare the KML with the database by content hash and report new, changed, and unchanged placemarks without writing")
+	diffNames := flag.Bool("diff-names", false, "With -diff, also list the names of new and changed placemarks")
 	limit := flag.Int("limit", 0, "Limit number of placemarks to import (0 = no limit)")
+	skipLog := flag.String("skip-log", "", "Write one JSON line per skipped placemark to this file")
+	reportSkipped := flag.String("report-skipped", "", "Write a CSV of the placemarks skipped for invalid geometry, with their names and reasons, to this file")
+	decimalComma := flag.Bool("decimal-comma", false, "Treat commas inside coordinate ordinates as decimal separators")
+	altitude := flag.Bool("altitude", false, "Keep KML altitudes, storing Z geometries for placemarks with any non-zero altitude")
+	source := flag.String("source", "", "Dataset/source label stored on every imported placemark")
+	unnamed := flag.String("unnamed", kml.UnnamedKeep, "How to handle placemarks with empty names: keep, skip, synthesize, or coords")
+	timeout := flag.Duration("timeout", 0, "Abort the import after this long, rolling back (0 = no timeout)")
+	snapFolder := flag.String("snap-to", "", "Snap Point placemarks to the nearest LineString in this folder")
+	buildRouting := flag.Bool("build-routing", false, "Rebuild the pgRouting network from LineString placemarks after import (requires the pgrouting extension)")
+	snapTolerance := flag.Float64("snap-tolerance", 0, "Maximum snapping distance in meters (required with -snap-to)")
+	descriptionFormat := flag.String("description-format", sanitize.FormatHTML, "Format of placemark descriptions: html or markdown")
+	descriptionMode := flag.String("description-mode", descriptionModeRaw, "How to store descriptions: raw, text (tags stripped), or sanitize (allowlist-sanitized HTML); the source is kept in description_raw")
+	forceDim := flag.String("force-dimension", "", "Coerce imported geometries to 2d (drop altitude) or 3d (add Z = 0); default keeps them as parsed")
+	autoFolderFrom := flag.String("auto-folder-from", "", "File unfoldered points under the name of the containing region polygon from this folder")
+	autoFolderDefault := flag.String("auto-folder-default", "", "Folder for unfoldered points in no region (with -auto-folder-from; default leaves them unfoldered)")
+	useCopy := flag.Bool("copy", true, "Bulk-load placemarks with COPY; -copy=false inserts one row at a time")
+	batchSize := flag.Int("batch-size", 0, "Commit placemarks in transactions of this many (0 = one transaction for the whole import)")
+	skipExisting := flag.Bool("skip-existing", false, "Don't insert placemarks whose name and geometry match one already in the database")
+	strict := flag.Bool("strict", false, "Abort on geometry PostGIS finds invalid instead of repairing it with ST_MakeValid")
+	checkMedia := flag.Bool("check-media", false, "Request every media link (HEAD) and report the ones that don't answer or return an error status")
+	followLinks := flag.Bool("follow-links", false, "Fetch the documents NetworkLinks point to over HTTP and import their placemarks under the link's folder")
+	linkDepth := flag.Int("link-depth", 3, "How many levels of NetworkLinks -follow-links follows")
+	linkTimeout := flag.Duration("link-timeout", 30*time.Second, "Timeout for each document fetched by -follow-links")
 	flag.Parse()
 
+	if !kml.ValidUnnamedMode(*unnamed) {
+		log.Fatalf("Invalid -unnamed value %q (expected keep, skip, synthesize, or coords)", *unnamed)
+	}
+
+	if !validDimension(*forceDim) {
+		log.Fatalf("Invalid -force-dimension value %q (expected 2d or 3d)", *forceDim)
+	}
+
+	if *descriptionFormat != sanitize.FormatHTML && *descriptionFormat != sanitize.FormatMarkdown {
+		log.Fatalf("Invalid -description-format value %q (expected html or markdown)", *descriptionFormat)
+	}
+
+	if !validDescriptionMode(*descriptionMode) {
+		log.Fatalf("Invalid -description-mode value %q (expected raw, text, or sanitize)", *descriptionMode)
+	}
+
+	if *diff && *dryRun {
+		log.Fatal("-diff reads the database; use it instead of -dry-run")
+	}
+
+	snap := snapConfig{Folder: *snapFolder, Tolerance: *snapTolerance}
+	if snap.enabled() && snap.Tolerance <= 0 {
+		log.Fatal("-snap-to requires a positive -snap-tolerance in meters")
+	}
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// Cancel on SIGINT/SIGTERM and, optionally, after -timeout
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	startedAt := time.Now()
+
 	// Parse KML
-	placemarks, styles, err := parseKML(*kmlPath)
+	opts := kml.Options{DecimalComma: *decimalComma, Altitude: *altitude}
+	// Stop reading at -limit, unless unnamed placemarks are dropped later
+	// and more have to be read to fill it.
+	if *unnamed != kml.UnnamedSkip {
+		opts.Limit = *limit
+	}
+	parsed, err := kml.ParseFile(ctx, *kmlPath, opts)
 	if err != nil {
 		log.Fatalf("Failed to parse KML: %v", err)
 	}
+	if *followLinks && len(parsed.NetworkLinks) > 0 {
+		follower := newLinkFollower(opts, *linkDepth, *linkTimeout)
+		follower.follow(ctx, parsed, nil)
+		if err := ctx.Err(); err != nil {
+			log.Fatalf("Failed to follow network links: %v", err)
+		}
+		fmt.Printf("Followed %d network links (%d not followed)\n", follower.Followed, follower.Failed)
+	} else if len(parsed.NetworkLinks) > 0 {
+		fmt.Printf("Network links not followed: %d (use -follow-links)\n", len(parsed.NetworkLinks))
+	}
+	styles, skipped := parsed.Styles, parsed.Skipped
+
+	placemarks, unnamedCount, unnamedSkipped := kml.ApplyUnnamedPolicy(parsed.Placemarks, *unnamed, opts)
+	skipped = append(skipped, unnamedSkipped...)
 
 	if *limit > 0 && len(placemarks) > *limit {
 		placemarks = placemarks[:*limit]
@@ -152,8 +126,37 @@ func main() {
 	// Print summary
 	summary := summarize(styles, placemarks)
 	fmt.Println(summary)
+	if unnamedCount > 0 {
+		fmt.Printf("Unnamed placemarks (%s): %d\n", *unnamed, unnamedCount)
+	}
+	printSkipped(os.Stdout, skipped, *skipLog)
+	if parsed.InvalidCoordinates > 0 {
+		fmt.Printf("Unparseable coordinates: %d\n", parsed.InvalidCoordinates)
+	}
+	if len(parsed.Warnings) > 0 {
+		fmt.Printf("Geometry warnings: %d\n", len(parsed.Warnings))
+	}
+	if len(parsed.Assets) > 0 {
+		fmt.Printf("KMZ assets: %d\n", len(parsed.Assets))
+	}
+
+	if *checkMedia {
+		dead := checkMediaLinks(ctx, placemarks, 10*time.Second)
+		if err := ctx.Err(); err != nil {
+			log.Fatalf("Failed to check media links: %v", err)
+		}
+		for _, link := range dead {
+			log.Printf("Dead media link %s (%s), used by %q", link.URL, link.Reason, link.Placemarks)
+		}
+		fmt.Printf("Dead media links: %d\n", len(dead))
+	}
 
+	// Geometry validity needs PostGIS, so a dry run's skip log and report
+	// are written now and a real import's once the geometries have been
+	// checked.
 	if *dryRun {
+		writeSkipLogIfSet(*skipLog, skipped)
+		writeSkipReportIfSet(*reportSkipped, skipped)
 		return
 	}
 
@@ -163,227 +166,165 @@ func main() {
 		log.Fatal("DATABASE_URL environment variable not set")
 	}
 
-	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, dbURL)
+	config, err := store.ParsePoolConfig(dbURL, os.Getenv)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+		log.Fatal(err)
 	}
-	defer pool.Close()
-
-	// Run migrations
-	if err := ensureSchema(ctx, pool); err != nil {
-		log.Fatalf("Failed to create schema: %v", err)
+	retry, err := store.ParseConnectRetry(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	if *truncate {
-		if err := truncateData(ctx, pool); err != nil {
-			log.Fatalf("Failed to truncate data: %v", err)
-		}
+	pool, err := store.ConnectWithRetry(ctx, config, retry)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer pool.Close()
 
-	// Import data
-	if err := importStyles(ctx, pool, styles); err != nil {
-		log.Fatalf("Failed to import styles: %v", err)
-	}
+	// A diff leaves the database as it is, schema included.
+	if !*diff {
+		applied, err := migrate(ctx, pool)
+		if err != nil {
+			log.Fatalf("Failed to migrate schema: %v", err)
+		}
+		if applied > 0 {
+			fmt.Printf("Applied %d schema migrations\n", applied)
+		}
 
-	if err := importPlacemarks(ctx, pool, placemarks); err != nil {
-		log.Fatalf("Failed to import placemarks: %v", err)
+		if *truncate {
+			if err := truncateData(ctx, pool); err != nil {
+				log.Fatalf("Failed to truncate data: %v", err)
+			}
+		}
 	}
 
-	fmt.Printf("\nImported %d placemarks into PostgreSQL\n", len(placemarks))
-}
-
-func parseKML(path string) ([]PlacemarkRecord, []Style, error) {
-	file, err := os.Open(path)
+	// The geometry check and -diff only read, so a read-only role or
+	// replica will do for a diff.
+	readTx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open KML file: %w", err)
+		log.Fatalf("Failed to begin geometry check: %v", err)
 	}
-	defer file.Close()
+	defer readTx.Rollback(context.WithoutCancel(ctx))
 
-	data, err := io.ReadAll(file)
+	placemarks, check, err := checkGeometries(ctx, readTx, placemarks, *strict)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read KML file: %w", err)
+		log.Fatalf("Geometry check failed: %v", err)
 	}
-
-	var kml KML
-	if err := xml.Unmarshal(data, &kml); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse KML XML: %w", err)
+	skipped = append(skipped, check.Skipped...)
+	if check.Repaired > 0 {
+		fmt.Printf("Repaired invalid geometries: %d\n", check.Repaired)
 	}
-
-	var placemarks []PlacemarkRecord
-
-	// Process top-level placemarks
-	for _, pm := range kml.Document.Placemarks {
-		if rec := processPlacemark(pm, []string{}); rec != nil {
-			placemarks = append(placemarks, *rec)
-		}
+	if len(check.Skipped) > 0 {
+		fmt.Printf("Skipped invalid geometries: %d\n", len(check.Skipped))
 	}
+	writeSkipLogIfSet(*skipLog, skipped)
+	writeSkipReportIfSet(*reportSkipped, skipped)
 
-	// Process folders recursively
-	for _, folder := range kml.Document.Folders {
-		placemarks = append(placemarks, processFolderPlacemarks(folder, []string{})...)
+	placemarks, duplicates := dedupePlacemarks(placemarks)
+	if duplicates > 0 {
+		fmt.Printf("Duplicate placemarks (same name, geometry, and folder) dropped: %d\n", duplicates)
 	}
 
-	return placemarks, kml.Document.Styles, nil
-}
-
-func processFolderPlacemarks(folder Folder, parentPath []string) []PlacemarkRecord {
-	var placemarks []PlacemarkRecord
-
-	folderPath := append(parentPath, folder.Name)
+	importOpts := importOptions{
+		Source:            *source,
+		DescriptionFormat: *descriptionFormat,
+		DescriptionMode:   *descriptionMode,
+		Snap:              snap,
+		Dimension:         *forceDim,
+		AutoFolder:        autoFolderConfig{RegionFolder: *autoFolderFrom, Default: *autoFolderDefault},
+		RowByRow:          !*useCopy,
+		BatchSize:         *batchSize,
+		SkipExisting:      *skipExisting,
+	}
 
-	for _, pm := range folder.Placemarks {
-		if rec := processPlacemark(pm, folderPath); rec != nil {
-			placemarks = append(placemarks, *rec)
+	if *diff {
+		styleIDs := make(map[string]bool, len(styles))
+		for _, style := range styles {
+			styleIDs[style.ID] = true
+		}
+		d, err := diffPlacemarks(ctx, readTx, placemarks, styleIDs, importOpts)
+		if err != nil {
+			log.Fatalf("Diff failed: %v", err)
 		}
+		fmt.Printf("\nCompared with the database: %d new, %d changed, %d unchanged\n", d.New, d.Changed, d.Unchanged)
+		if *diffNames {
+			for _, name := range d.NewNames {
+				fmt.Printf("  new: %s\n", name)
+			}
+			for _, name := range d.ChangedNames {
+				fmt.Printf("  changed: %s\n", name)
+			}
+		}
+		return
 	}
+	readTx.Rollback(ctx)
 
-	// Process nested folders
-	for _, subfolder := range folder.Folders {
-		placemarks = append(placemarks, processFolderPlacemarks(subfolder, folderPath)...)
+	// Import data
+	if err := importStyles(ctx, pool, styles); err != nil {
+		log.Fatalf("Failed to import styles: %v", err)
 	}
-
-	return placemarks
-}
-
-func processPlacemark(pm Placemark, folderPath []string) *PlacemarkRecord {
-	var geomType, geomWKT, coordsRaw string
-
-	if pm.Point != nil {
-		geomType = "Point"
-		coordsRaw = strings.TrimSpace(pm.Point.Coordinates)
-		geomWKT = buildPointWKT(coordsRaw)
-	} else if pm.LineString != nil {
-		geomType = "LineString"
-		coordsRaw = strings.TrimSpace(pm.LineString.Coordinates)
-		geomWKT = buildLineStringWKT(coordsRaw)
-	} else if pm.Polygon != nil {
-		geomType = "Polygon"
-		coordsRaw = strings.TrimSpace(pm.Polygon.OuterBoundary.LinearRing.Coordinates)
-		geomWKT = buildPolygonWKT(pm.Polygon)
-	} else {
-		return nil
+	if err := linkHighlightStyles(ctx, pool, parsed.HighlightStyles); err != nil {
+		log.Fatalf("Failed to link highlight styles: %v", err)
 	}
 
-	if geomWKT == "" {
-		return nil
+	result, err := importPlacemarks(ctx, pool, placemarks, importOpts)
+	if err != nil {
+		if result.Committed > 0 {
+			log.Printf("%d placemarks from earlier batches were committed; rerun with -skip-existing to resume", result.Committed)
+		}
+		if ctx.Err() != nil {
+			log.Fatalf("Import cancelled (%v) after %d of %d placemarks; transaction rolled back", ctx.Err(), result.Imported, len(placemarks))
+		}
+		log.Fatalf("Failed to import placemarks: %v", err)
 	}
 
-	styleID := strings.TrimPrefix(pm.StyleURL, "#")
-
-	extData := make(map[string]string)
-	var mediaLinks []string
-
-	if pm.ExtendedData != nil {
-		for _, data := range pm.ExtendedData.Data {
-			if data.Name == "gx_media_links" {
-				mediaLinks = append(mediaLinks, data.Value)
-			} else {
-				extData[data.Name] = data.Value
-			}
+	if *buildRouting {
+		edges, err := buildRoutingTopology(ctx, pool)
+		if err != nil {
+			log.Fatalf("Failed to build routing network: %v", err)
 		}
+		fmt.Printf("Built routing network with %d edges\n", edges)
 	}
 
-	return &PlacemarkRecord{
-		Name:           strings.TrimSpace(pm.Name),
-		Description:    strings.TrimSpace(pm.Description),
-		StyleID:        styleID,
-		FolderPath:     folderPath,
-		GeometryType:   geomType,
-		GeomWKT:        geomWKT,
-		CoordinatesRaw: coordsRaw,
-		MediaLinks:     mediaLinks,
-		ExtendedData:   extData,
+	run := store.ImportRun{
+		KMLPath:    *kmlPath,
+		Imported:   result.Imported,
+		Skipped:    kml.TallySkips(skipped),
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
 	}
-}
-
-func parseCoordinates(coordsText string) [][2]float64 {
-	var coords [][2]float64
-	parts := strings.Fields(strings.TrimSpace(coordsText))
-
-	for _, part := range parts {
-		vals := strings.Split(part, ",")
-		if len(vals) < 2 {
-			continue
-		}
-
-		var lon, lat float64
-		if _, err := fmt.Sscanf(vals[0], "%f", &lon); err != nil {
-			continue
-		}
-		if _, err := fmt.Sscanf(vals[1], "%f", &lat); err != nil {
-			continue
-		}
-
-		coords = append(coords, [2]float64{lon, lat})
+	if *source != "" {
+		run.Source = source
 	}
-
-	return coords
-}
-
-func buildPointWKT(coordsText string) string {
-	coords := parseCoordinates(coordsText)
-	if len(coords) == 0 {
-		return ""
+	if err := store.RecordImportRun(ctx, pool, run); err != nil {
+		log.Printf("Failed to record import run: %v", err)
 	}
-	return fmt.Sprintf("POINT(%f %f)", coords[0][0], coords[0][1])
-}
 
-func buildLineStringWKT(coordsText string) string {
-	coords := parseCoordinates(coordsText)
-	if len(coords) < 2 {
-		return ""
+	if err := store.NotifyChanges(ctx, pool); err != nil {
+		log.Printf("Failed to notify API servers of changes: %v", err)
 	}
 
-	var points []string
-	for _, c := range coords {
-		points = append(points, fmt.Sprintf("%f %f", c[0], c[1]))
+	fmt.Printf("\nImported %d placemarks into PostgreSQL\n", result.Imported)
+	if result.Updated > 0 {
+		fmt.Printf("Updated %d placemarks already imported from this data\n", result.Updated)
 	}
-
-	return fmt.Sprintf("LINESTRING(%s)", strings.Join(points, ", "))
-}
-
-func buildPolygonWKT(polygon *Polygon) string {
-	outer := parseCoordinates(polygon.OuterBoundary.LinearRing.Coordinates)
-	if len(outer) < 3 {
-		return ""
+	if result.Unchanged > 0 {
+		fmt.Printf("Left %d placemarks unchanged\n", result.Unchanged)
 	}
-
-	// Ensure ring is closed
-	if outer[0] != outer[len(outer)-1] {
-		outer = append(outer, outer[0])
+	if *skipExisting {
+		fmt.Printf("Skipped %d placemarks already in the database\n", result.Existing)
 	}
-
-	var outerPoints []string
-	for _, c := range outer {
-		outerPoints = append(outerPoints, fmt.Sprintf("%f %f", c[0], c[1]))
+	if snap.enabled() {
+		fmt.Printf("Snapped %d points to %q within %gm\n", result.Snapped, snap.Folder, snap.Tolerance)
 	}
-
-	rings := []string{fmt.Sprintf("(%s)", strings.Join(outerPoints, ", "))}
-
-	// Process inner rings (holes)
-	for _, inner := range polygon.InnerBoundary {
-		innerCoords := parseCoordinates(inner.LinearRing.Coordinates)
-		if len(innerCoords) < 3 {
-			continue
-		}
-
-		if innerCoords[0] != innerCoords[len(innerCoords)-1] {
-			innerCoords = append(innerCoords, innerCoords[0])
-		}
-
-		var innerPoints []string
-		for _, c := range innerCoords {
-			innerPoints = append(innerPoints, fmt.Sprintf("%f %f", c[0], c[1]))
-		}
-
-		rings = append(rings, fmt.Sprintf("(%s)", strings.Join(innerPoints, ", ")))
+	if *autoFolderFrom != "" {
+		fmt.Printf("Auto-assigned folders to %d points from regions in %q\n", result.AutoFoldered, *autoFolderFrom)
+	}
+	if *forceDim != "" {
+		fmt.Printf("Coerced %d geometries to %s\n", result.Coerced, *forceDim)
 	}
-
-	return fmt.Sprintf("POLYGON(%s)", strings.Join(rings, ", "))
 }
 
-func summarize(styles []Style, placemarks []PlacemarkRecord) string {
+func summarize(styles []kml.Style, placemarks []kml.PlacemarkRecord) string {
 	typeCounts := make(map[string]int)
 	for _, pm := range placemarks {
 		typeCounts[pm.GeometryType]++
@@ -400,52 +341,23 @@ func summarize(styles []Style, placemarks []PlacemarkRecord) string {
 	return sb.String()
 }
 
-func ensureSchema(ctx context.Context, pool *pgxpool.Pool) error {
-	schema := `
-		CREATE EXTENSION IF NOT EXISTS postgis;
-
-		CREATE TABLE IF NOT EXISTS styles (
-			id TEXT PRIMARY KEY,
-			icon_href TEXT,
-			icon_scale DOUBLE PRECISION,
-			label_scale DOUBLE PRECISION,
-			raw_xml TEXT
-		);
-
-		CREATE TABLE IF NOT EXISTS placemarks (
-			id SERIAL PRIMARY KEY,
-			name TEXT NOT NULL,
-			description TEXT,
-			style_id TEXT REFERENCES styles(id),
-			folder_path TEXT[],
-			geometry_type TEXT NOT NULL,
-			geom GEOMETRY(GEOMETRY, 4326) NOT NULL,
-			coordinates_raw TEXT,
-			gx_media_links TEXT[],
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);
-
-		CREATE TABLE IF NOT EXISTS placemark_data (
-			id SERIAL PRIMARY KEY,
-			placemark_id INTEGER REFERENCES placemarks(id) ON DELETE CASCADE,
-			key TEXT,
-			value TEXT
-		);
-
-		CREATE INDEX IF NOT EXISTS placemarks_geom_gix ON placemarks USING GIST (geom);
-		CREATE INDEX IF NOT EXISTS placemarks_folder_gin ON placemarks USING GIN (folder_path);
-	`
-
-	_, err := pool.Exec(ctx, schema)
-	return err
-}
-
 func truncateData(ctx context.Context, pool *pgxpool.Pool) error {
-	_, err := pool.Exec(ctx, "TRUNCATE placemark_data, placemarks RESTART IDENTITY CASCADE")
+	// TRUNCATE skips row triggers, so tombstone existing rows first to keep
+	// delta-sync clients in step.
+	_, err := pool.Exec(ctx, `
+		INSERT INTO placemark_tombstones (placemark_id)
+		SELECT id FROM placemarks
+		ON CONFLICT (placemark_id) DO UPDATE
+		SET version = nextval('placemark_version_seq'), deleted_at = NOW()
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(ctx, "TRUNCATE placemark_data, placemarks RESTART IDENTITY CASCADE")
 	return err
 }
 
-func importStyles(ctx context.Context, pool *pgxpool.Pool, styles []Style) error {
+func importStyles(ctx context.Context, pool *pgxpool.Pool, styles []kml.Style) error {
 	if len(styles) == 0 {
 		return nil
 	}
@@ -453,8 +365,8 @@ func importStyles(ctx context.Context, pool *pgxpool.Pool, styles []Style) error
 	batch := &pgx.Batch{}
 
 	for _, style := range styles {
-		var iconHref *string
-		var iconScale, labelScale *float64
+		var iconHref, labelColor, lineColor, polyColor *string
+		var iconScale, labelScale, lineWidth *float64
 
 		if style.IconStyle != nil {
 			iconScale = &style.IconStyle.Scale
@@ -465,17 +377,31 @@ func importStyles(ctx context.Context, pool *pgxpool.Pool, styles []Style) error
 
 		if style.LabelStyle != nil {
 			labelScale = &style.LabelStyle.Scale
+			labelColor = nonEmpty(style.LabelStyle.Color)
+		}
+
+		if style.LineStyle != nil {
+			lineColor = nonEmpty(style.LineStyle.Color)
+			lineWidth = &style.LineStyle.Width
+		}
+
+		if style.PolyStyle != nil {
+			polyColor = nonEmpty(style.PolyStyle.Color)
 		}
 
 		batch.Queue(
-			`INSERT INTO styles (id, icon_href, icon_scale, label_scale, raw_xml)
-			 VALUES ($1, $2, $3, $4, $5)
+			`INSERT INTO styles (id, icon_href, icon_scale, label_scale, label_color, line_color, line_width, poly_color, raw_xml)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 			 ON CONFLICT (id) DO UPDATE SET
 			   icon_href = EXCLUDED.icon_href,
 			   icon_scale = EXCLUDED.icon_scale,
 			   label_scale = EXCLUDED.label_scale,
+			   label_color = EXCLUDED.label_color,
+			   line_color = EXCLUDED.line_color,
+			   line_width = EXCLUDED.line_width,
+			   poly_color = EXCLUDED.poly_color,
 			   raw_xml = EXCLUDED.raw_xml`,
-			style.ID, iconHref, iconScale, labelScale, "",
+			style.ID, iconHref, iconScale, labelScale, labelColor, lineColor, lineWidth, polyColor, "",
 		)
 	}
 
@@ -491,17 +417,22 @@ func importStyles(ctx context.Context, pool *pgxpool.Pool, styles []Style) error
 	return nil
 }
 
-func importPlacemarks(ctx context.Context, pool *pgxpool.Pool, placemarks []PlacemarkRecord) error {
-	if len(placemarks) == 0 {
-		return nil
-	}
+// upserted counts the placemarks an import path matched to stored rows by
+// content hash: Updated were rewritten, Unchanged were left as stored.
+type upserted struct {
+	Updated   int
+	Unchanged int
+}
 
-	tx, err := pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
+// insertPlacemarks is the row-by-row import path: one upsert per placemark
+// and one INSERT per extended-data value, replacing the extended data of
+// stored placemarks that changed. It returns the ids of the placemarks
+// fully written or found unchanged before finishing or failing.
+func insertPlacemarks(ctx context.Context, tx pgx.Tx, placemarks []kml.PlacemarkRecord, opts importOptions, progress *importProgress) ([]int, upserted, error) {
+	source := nonEmpty(opts.Source)
 
+	ids := make([]int, 0, len(placemarks))
+	var counts upserted
 	for _, pm := range placemarks {
 		var styleID *string
 		if pm.StyleID != "" {
@@ -518,19 +449,40 @@ func importPlacemarks(ctx context.Context, pool *pgxpool.Pool, placemarks []Plac
 			mediaLinks = pm.MediaLinks
 		}
 
+		description, descriptionRaw := storedDescription(opts.DescriptionMode, opts.DescriptionFormat, pm.Description)
+
+		hash := contentHash(pm)
 		var placemarkID int
+		var inserted bool
 		err := tx.QueryRow(
 			ctx,
 			`INSERT INTO placemarks
-			 (name, description, style_id, folder_path, geometry_type, geom, coordinates_raw, gx_media_links)
-			 VALUES ($1, $2, $3, $4, $5, ST_GeomFromText($6, 4326), $7, $8)
-			 RETURNING id`,
-			pm.Name, pm.Description, styleID, pm.FolderPath, pm.GeometryType,
-			pm.GeomWKT, pm.CoordinatesRaw, mediaLinks,
-		).Scan(&placemarkID)
-
+			 (name, description, description_raw, description_format, style_id, folder_path, geometry_type, geom, coordinates_raw, gx_media_links, source, time_begin, time_end, track_times, content_hash)
+			 VALUES ($1, $2, $15, $3, $4, $5, $6, ST_GeomFromText($7, 4326), $8, $9, $10, $11, $12, $13, $14)`+
+				upsertOnHash(`$16::jsonb`)+`
+			 RETURNING id, (xmax = 0)`,
+			pm.Name, description, opts.DescriptionFormat, styleID, pm.FolderPath, pm.GeometryType,
+			pm.GeomWKT, pm.CoordinatesRaw, mediaLinks, source, pm.TimeBegin, pm.TimeEnd, pm.TrackTimes,
+			hash, descriptionRaw, extendedDataJSON(pm),
+		).Scan(&placemarkID, &inserted)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The stored row already matches.
+			if err := tx.QueryRow(ctx, `SELECT id FROM placemarks WHERE content_hash = $1`, hash).Scan(&placemarkID); err != nil {
+				return ids, counts, fmt.Errorf("failed to look up unchanged placemark: %w", err)
+			}
+			ids = append(ids, placemarkID)
+			counts.Unchanged++
+			progress.advance(1)
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("failed to insert placemark: %w", err)
+			return ids, counts, fmt.Errorf("failed to insert placemark: %w", err)
+		}
+		if !inserted {
+			if _, err := tx.Exec(ctx, `DELETE FROM placemark_data WHERE placemark_id = $1`, placemarkID); err != nil {
+				return ids, counts, fmt.Errorf("failed to replace extended data: %w", err)
+			}
 		}
 
 		// Insert extended data
@@ -541,10 +493,190 @@ func importPlacemarks(ctx context.Context, pool *pgxpool.Pool, placemarks []Plac
 				placemarkID, key, value,
 			)
 			if err != nil {
-				return fmt.Errorf("failed to insert extended data: %w", err)
+				return ids, counts, fmt.Errorf("failed to insert extended data: %w", err)
 			}
 		}
+		ids = append(ids, placemarkID)
+		if !inserted {
+			counts.Updated++
+		}
+		progress.advance(1)
+	}
+
+	return ids, counts, nil
+}
+
+// linkHighlightStyles records each StyleMap's highlight style on its normal
+// style. Pairs naming a style that was not imported are ignored.
+func linkHighlightStyles(ctx context.Context, pool *pgxpool.Pool, highlights map[string]string) error {
+	if len(highlights) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for normalID, highlightID := range highlights {
+		batch.Queue(
+			`UPDATE styles SET highlight_style_id = $2
+			 WHERE id = $1 AND EXISTS (SELECT 1 FROM styles WHERE id = $2)`,
+			normalID, highlightID,
+		)
+	}
+
+	br := pool.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for range highlights {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("failed to link highlight style: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// nonEmpty returns a pointer to the trimmed value, or nil when it is blank.
+func nonEmpty(s string) *string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// importOptions controls how importPlacemarks stores placemarks.
+type importOptions struct {
+	// Source labels every placemark when non-empty.
+	Source string
+	// DescriptionFormat is recorded on every placemark (html or markdown).
+	DescriptionFormat string
+	// DescriptionMode is the -description-mode descriptions are stored in.
+	DescriptionMode string
+	Snap            snapConfig
+	// Dimension, when set, forces every geometry to 2d or 3d.
+	Dimension  string
+	AutoFolder autoFolderConfig
+	// RowByRow uses one INSERT per row instead of COPY.
+	RowByRow bool
+	// BatchSize, when positive, commits placemarks in transactions of this
+	// many instead of one.
+	BatchSize int
+	// SkipExisting leaves out placemarks whose name and geometry match one
+	// already stored.
+	SkipExisting bool
+}
+
+// importResult reports what importPlacemarks did.
+type importResult struct {
+	// Imported counts placemarks inserted before finishing or failing;
+	// Committed counts those whose batch was committed.
+	// Updated counts those that replaced a stored placemark with the same
+	// content hash, and Unchanged those that matched one exactly.
+	Imported     int
+	Committed    int
+	Updated      int
+	Unchanged    int
+	Existing     int
+	Snapped      int64
+	AutoFoldered int64
+	Coerced      int64
+}
+
+// importPlacemarks inserts placemarks, tagging each with the source label
+// and description format, then snaps points, assigns folders from regions,
+// and forces the geometry dimension when enabled. Without a batch size this
+// is one transaction and nothing is committed on failure. With one, each
+// batch is committed as it goes and the follow-up steps run over every
+// imported placemark in the last batch's transaction, so a failure keeps
+// the earlier batches (result.Committed); rerun with SkipExisting to carry
+// on from there.
+func importPlacemarks(ctx context.Context, pool *pgxpool.Pool, placemarks []kml.PlacemarkRecord, opts importOptions) (importResult, error) {
+	var result importResult
+	if len(placemarks) == 0 {
+		return result, nil
+	}
+
+	progress := newImportProgress(len(placemarks))
+	batches := batchBounds(len(placemarks), opts.BatchSize)
+	var ids []int
+	for i, b := range batches {
+		last := i == len(batches)-1
+		if err := importBatch(ctx, pool, placemarks[b.start:b.end], &ids, last, opts, progress, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// importBatch inserts one batch in its own transaction, appending the new
+// ids to ids. The last batch also runs the follow-up steps over all of ids.
+func importBatch(ctx context.Context, pool *pgxpool.Pool, batch []kml.PlacemarkRecord, ids *[]int, last bool, opts importOptions, progress *importProgress, result *importResult) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Roll back even when ctx has been cancelled.
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	if opts.SkipExisting {
+		var existing int
+		batch, existing, err = dropExisting(ctx, tx, batch)
+		if err != nil {
+			return err
+		}
+		result.Existing += existing
+		progress.advance(existing)
 	}
 
-	return tx.Commit(ctx)
+	var batchIDs []int
+	var counts upserted
+	if opts.RowByRow {
+		batchIDs, counts, err = insertPlacemarks(ctx, tx, batch, opts, progress)
+	} else {
+		batchIDs, counts, err = copyPlacemarks(ctx, tx, batch, opts)
+		if err == nil {
+			progress.advance(len(batchIDs))
+		}
+	}
+	result.Imported += len(batchIDs)
+	result.Updated += counts.Updated
+	result.Unchanged += counts.Unchanged
+	if err != nil {
+		return err
+	}
+	*ids = append(*ids, batchIDs...)
+
+	if last {
+		if err := postProcess(ctx, tx, *ids, opts, result); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit placemarks: %w", err)
+	}
+	result.Committed = result.Imported
+	return nil
+}
+
+// postProcess snaps, assigns folders, and forces dimensions for ids.
+func postProcess(ctx context.Context, tx pgx.Tx, ids []int, opts importOptions, result *importResult) error {
+	var err error
+	if opts.Snap.enabled() {
+		result.Snapped, err = snapPoints(ctx, tx, ids, opts.Snap)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Regions are looked up after snapping, against the final positions.
+	if opts.AutoFolder.enabled() {
+		result.AutoFoldered, err = assignFoldersFromRegions(ctx, tx, ids, opts.AutoFolder)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Coerce last so snapped points end up in the requested dimension too.
+	result.Coerced, err = forceDimension(ctx, tx, ids, opts.Dimension)
+	return err
 }
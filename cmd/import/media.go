@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// mediaCheckWorkers is how many media links -check-media requests at once.
+const mediaCheckWorkers = 8
+
+// deadMediaLink is a media link -check-media could not reach.
+type deadMediaLink struct {
+	URL string
+	// Placemarks names the placemarks that use the link.
+	Placemarks []string
+	Reason     string
+}
+
+// checkMediaLinks requests every distinct media link in placemarks with
+// HEAD, falling back to GET for servers that refuse HEAD, and returns the
+// ones that fail or answer with an error status, sorted by URL. Each request
+// is bounded by timeout.
+func checkMediaLinks(ctx context.Context, placemarks []kml.PlacemarkRecord, timeout time.Duration) []deadMediaLink {
+	users := make(map[string][]string)
+	for _, pm := range placemarks {
+		for _, link := range pm.MediaLinks {
+			users[link] = append(users[link], pm.Name)
+		}
+	}
+
+	links := make(chan string)
+	var mu sync.Mutex
+	var dead []deadMediaLink
+	var wg sync.WaitGroup
+	client := &http.Client{Timeout: timeout}
+	for range mediaCheckWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range links {
+				if err := checkMediaLink(ctx, client, link); err != nil {
+					mu.Lock()
+					dead = append(dead, deadMediaLink{URL: link, Placemarks: users[link], Reason: err.Error()})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for link := range users {
+		if ctx.Err() != nil {
+			break
+		}
+		links <- link
+	}
+	close(links)
+	wg.Wait()
+
+	sort.Slice(dead, func(i, j int) bool { return dead[i].URL < dead[j].URL })
+	return dead
+}
+
+func checkMediaLink(ctx context.Context, client *http.Client, link string) error {
+	status, err := requestStatus(ctx, client, http.MethodHead, link)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = requestStatus(ctx, client, http.MethodGet, link)
+	}
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return fmt.Errorf("status %d %s", status, http.StatusText(status))
+	}
+	return nil
+}
+
+// requestStatus sends one request and returns the response status without
+// reading the body.
+func requestStatus(ctx context.Context, client *http.Client, method, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+func TestCheckMediaLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.jpg":
+		case "/get-only.jpg":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/gone.jpg":
+			w.WriteHeader(http.StatusGone)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	placemarks := []kml.PlacemarkRecord{
+		{Name: "Stage", MediaLinks: []string{srv.URL + "/ok.jpg", srv.URL + "/gone.jpg"}},
+		{Name: "Gate", MediaLinks: []string{srv.URL + "/get-only.jpg", srv.URL + "/gone.jpg"}},
+		{Name: "Lot", MediaLinks: []string{srv.URL + "/missing.jpg"}},
+		{Name: "Bar", MediaLinks: []string{"http://%zz"}},
+	}
+	dead := checkMediaLinks(context.Background(), placemarks, time.Second)
+
+	var urls []string
+	for _, d := range dead {
+		urls = append(urls, d.URL)
+		if d.Reason == "" {
+			t.Errorf("%s has no reason", d.URL)
+		}
+	}
+	want := []string{"http://%zz", srv.URL + "/gone.jpg", srv.URL + "/missing.jpg"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Fatalf("dead links = %v, want %v", urls, want)
+	}
+	if users := dead[1].Placemarks; !reflect.DeepEqual(users, []string{"Stage", "Gate"}) {
+		t.Errorf("gone.jpg used by %v, want [Stage Gate]", users)
+	}
+	if dead[1].Reason != "status 410 Gone" {
+		t.Errorf("gone.jpg reason = %q, want %q", dead[1].Reason, "status 410 Gone")
+	}
+}
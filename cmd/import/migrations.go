@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrations are the schema changes, applied in order; a migration's
+// version is its position in the list, counting from 1. Append new ones
+// and never edit or reorder those already released. They all use IF NOT
+// EXISTS (or check first), because databases created before
+// schema_migrations existed already have some of them without a record.
+var migrations = []string{
+	`
+		CREATE EXTENSION IF NOT EXISTS postgis;
+
+		CREATE TABLE IF NOT EXISTS styles (
+			id TEXT PRIMARY KEY,
+			icon_href TEXT,
+			icon_scale DOUBLE PRECISION,
+			label_scale DOUBLE PRECISION,
+			raw_xml TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS placemarks (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT,
+			style_id TEXT REFERENCES styles(id),
+			folder_path TEXT[],
+			geometry_type TEXT NOT NULL,
+			geom GEOMETRY(GEOMETRY, 4326) NOT NULL,
+			coordinates_raw TEXT,
+			gx_media_links TEXT[],
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS placemark_data (
+			id SERIAL PRIMARY KEY,
+			placemark_id INTEGER REFERENCES placemarks(id) ON DELETE CASCADE,
+			key TEXT,
+			value TEXT
+		);
+
+		CREATE INDEX IF NOT EXISTS placemarks_geom_gix ON placemarks USING GIST (geom);
+		CREATE INDEX IF NOT EXISTS placemarks_folder_gin ON placemarks USING GIN (folder_path);
+	`,
+	`
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS source TEXT;
+		CREATE INDEX IF NOT EXISTS placemarks_source_idx ON placemarks (source);
+	`,
+	`
+		ALTER TABLE styles ADD COLUMN IF NOT EXISTS label_color TEXT;
+		ALTER TABLE styles ADD COLUMN IF NOT EXISTS line_color TEXT;
+		ALTER TABLE styles ADD COLUMN IF NOT EXISTS line_width DOUBLE PRECISION;
+		ALTER TABLE styles ADD COLUMN IF NOT EXISTS poly_color TEXT;
+		ALTER TABLE styles ADD COLUMN IF NOT EXISTS highlight_style_id TEXT REFERENCES styles(id) ON DELETE SET NULL;
+	`,
+	`
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS thumbnail_url TEXT;
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS description_format TEXT NOT NULL DEFAULT 'html';
+	`,
+	`
+		-- KML <TimeStamp> (begin only) or <TimeSpan>.
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS time_begin TIMESTAMPTZ;
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS time_end TIMESTAMPTZ;
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS track_times TIMESTAMPTZ[];
+		CREATE INDEX IF NOT EXISTS placemarks_time_begin_idx ON placemarks (time_begin);
+	`,
+	`
+		-- Hash of name, geometry WKT, and folder path as parsed; re-imports
+		-- upsert on it. NULL for placemarks created through the API.
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS content_hash TEXT;
+		CREATE UNIQUE INDEX IF NOT EXISTS placemarks_content_hash_key ON placemarks (content_hash);
+	`,
+	`
+		-- Full-text search over name (weighted higher) and description. The
+		-- configuration must match store.searchConfig.
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS search_tsv tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+			setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+		) STORED;
+		CREATE INDEX IF NOT EXISTS placemarks_search_gin ON placemarks USING GIN (search_tsv);
+	`,
+	`
+		-- Delta sync: every insert/update takes a new version from one
+		-- sequence, and deletes leave a tombstone with a version of its own.
+		CREATE SEQUENCE IF NOT EXISTS placemark_version_seq;
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT nextval('placemark_version_seq');
+		CREATE INDEX IF NOT EXISTS placemarks_version_idx ON placemarks (version);
+
+		CREATE TABLE IF NOT EXISTS placemark_tombstones (
+			placemark_id INTEGER PRIMARY KEY,
+			version BIGINT NOT NULL DEFAULT nextval('placemark_version_seq'),
+			deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS placemark_tombstones_version_idx ON placemark_tombstones (version);
+
+		CREATE OR REPLACE FUNCTION placemarks_track_version() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'UPDATE' THEN
+				NEW.version := nextval('placemark_version_seq');
+				NEW.updated_at := NOW();
+				RETURN NEW;
+			ELSIF TG_OP = 'INSERT' THEN
+				DELETE FROM placemark_tombstones WHERE placemark_id = NEW.id;
+				RETURN NEW;
+			END IF;
+			INSERT INTO placemark_tombstones (placemark_id) VALUES (OLD.id)
+			ON CONFLICT (placemark_id) DO UPDATE
+			SET version = nextval('placemark_version_seq'), deleted_at = NOW();
+			RETURN OLD;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE TRIGGER placemarks_version_update
+			BEFORE UPDATE ON placemarks
+			FOR EACH ROW EXECUTE FUNCTION placemarks_track_version();
+		CREATE OR REPLACE TRIGGER placemarks_version_insert_delete
+			AFTER INSERT OR DELETE ON placemarks
+			FOR EACH ROW EXECUTE FUNCTION placemarks_track_version();
+	`,
+	`
+		-- updated_at is set on insert by default and on update by the trigger
+		-- above. When the column is first added, existing rows are backfilled
+		-- from created_at with triggers off so versions aren't bumped.
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'placemarks' AND column_name = 'updated_at'
+			) THEN
+				ALTER TABLE placemarks ADD COLUMN updated_at TIMESTAMPTZ;
+				ALTER TABLE placemarks DISABLE TRIGGER USER;
+				UPDATE placemarks SET updated_at = created_at;
+				ALTER TABLE placemarks ENABLE TRIGGER USER;
+				ALTER TABLE placemarks ALTER COLUMN updated_at SET DEFAULT NOW(), ALTER COLUMN updated_at SET NOT NULL;
+			END IF;
+		END;
+		$$;
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS import_runs (
+			id SERIAL PRIMARY KEY,
+			kml_path TEXT NOT NULL,
+			source TEXT,
+			imported INTEGER NOT NULL,
+			skipped JSONB NOT NULL DEFAULT '{}',
+			started_at TIMESTAMPTZ NOT NULL,
+			finished_at TIMESTAMPTZ NOT NULL
+		);
+	`,
+	`
+		-- The source description, when -description-mode stored a stripped
+		-- or sanitized form in description.
+		ALTER TABLE placemarks ADD COLUMN IF NOT EXISTS description_raw TEXT;
+	`,
+}
+
+// migrate brings the schema up to date, applying every migration not yet
+// recorded in schema_migrations in one transaction, and returns how many
+// it applied. An advisory lock keeps concurrent importers from racing.
+func migrate(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+		return 0, fmt.Errorf("failed to lock schema_migrations: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return 0, fmt.Errorf("database schema version %d is newer than this importer's %d", current, len(migrations))
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+			return 0, fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			return 0, fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit migrations: %w", err)
+	}
+	return len(migrations) - current, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+// testDatabase returns a pool config whose connections work in a fresh
+// schema of the PostGIS database at DATABASE_URL, dropped when the test
+// ends. Tests that need a database skip without it.
+func testDatabase(t *testing.T) *pgxpool.Config {
+	t.Helper()
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("mandalay_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	config, err := store.ParsePoolConfig(url, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PostGIS stays in public, where CREATE EXTENSION IF NOT EXISTS finds it.
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+	return config
+}
+
+func testPool(t *testing.T, config *pgxpool.Config) *pgxpool.Pool {
+	t.Helper()
+	pool, err := store.Connect(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestMigrateTwice(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t, testDatabase(t))
+
+	tests := []struct {
+		name        string
+		wantApplied int
+	}{
+		{"fresh database", len(migrations)},
+		{"already migrated", 0},
+	}
+	for _, tt := range tests {
+		applied, err := migrate(ctx, pool)
+		if err != nil {
+			t.Fatalf("%s: migrate: %v", tt.name, err)
+		}
+		if applied != tt.wantApplied {
+			t.Errorf("%s: applied %d migrations, want %d", tt.name, applied, tt.wantApplied)
+		}
+
+		rows, err := pool.Query(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var versions []int
+		for rows.Next() {
+			var v int
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			versions = append(versions, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != len(migrations) {
+			t.Fatalf("%s: recorded versions %v, want 1..%d", tt.name, versions, len(migrations))
+		}
+		for i, v := range versions {
+			if v != i+1 {
+				t.Errorf("%s: recorded versions %v, want 1..%d", tt.name, versions, len(migrations))
+				break
+			}
+		}
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t, testDatabase(t))
+
+	if _, err := migrate(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, len(migrations)+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrate(ctx, pool); err == nil {
+		t.Error("migrate accepted a schema newer than its migrations")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// routingTolerance is the distance in degrees (about a meter) within which
+// line endpoints are joined into one network vertex.
+const routingTolerance = 0.00001
+
+// buildRoutingTopology rebuilds routing_edges from every LineString placemark
+// and runs pgr_createTopology over it, returning the number of edges. The
+// API's /route endpoint reads these tables.
+func buildRoutingTopology(ctx context.Context, pool *pgxpool.Pool) (int64, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	_, err = tx.Exec(ctx, `
+		CREATE EXTENSION IF NOT EXISTS pgrouting;
+
+		DROP TABLE IF EXISTS routing_edges_vertices_pgr;
+		DROP TABLE IF EXISTS routing_edges;
+
+		CREATE TABLE routing_edges AS
+		SELECT
+			id::bigint AS id,
+			id AS placemark_id,
+			geom AS the_geom,
+			ST_Length(geom::geography) AS cost,
+			NULL::bigint AS source,
+			NULL::bigint AS target
+		FROM placemarks
+		WHERE geometry_type = 'LineString';
+
+		ALTER TABLE routing_edges ADD PRIMARY KEY (id);
+		CREATE INDEX routing_edges_geom_gix ON routing_edges USING GIST (the_geom);
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create routing edges: %w", err)
+	}
+
+	var status string
+	if err := tx.QueryRow(ctx, "SELECT pgr_createTopology('routing_edges', $1, 'the_geom', 'id')", routingTolerance).Scan(&status); err != nil {
+		return 0, fmt.Errorf("failed to create topology: %w", err)
+	}
+	if status != "OK" {
+		return 0, fmt.Errorf("pgr_createTopology returned %s", status)
+	}
+
+	var edges int64
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM routing_edges").Scan(&edges); err != nil {
+		return 0, fmt.Errorf("failed to count routing edges: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit routing network: %w", err)
+	}
+	return edges, nil
+}
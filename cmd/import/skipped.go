@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/onnwee/mandalay/internal/kml"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+// printSkipped prints how many placemarks were skipped and why, and where
+// to find them by name.
+func printSkipped(w io.Writer, skipped []kml.SkippedPlacemark, skipLog string) {
+	if len(skipped) == 0 {
+		return
+	}
+	hint := " (use -skip-log to list them)"
+	if skipLog != "" {
+		hint = ""
+	}
+	fmt.Fprintf(w, "Skipped placemarks: %d%s\n", len(skipped), hint)
+	counts := kml.TallySkips(skipped)
+	for _, reason := range kml.SkipReasons {
+		if counts[reason] > 0 {
+			fmt.Fprintf(w, "  %s: %d\n", reason, counts[reason])
+		}
+	}
+}
+
+// writeSkipLog writes skipped placemarks to path as JSON lines.
+func writeSkipLog(path string, skipped []kml.SkippedPlacemark) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create skip log: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, skip := range skipped {
+		if err := encoder.Encode(skip); err != nil {
+			return fmt.Errorf("failed to write skip log entry: %w", err)
+		}
+	}
+
+	return file.Close()
+}
+
+// writeSkipLogIfSet writes the skip log when -skip-log was given, exiting on
+// failure.
+func writeSkipLogIfSet(path string, skipped []kml.SkippedPlacemark) {
+	if path == "" {
+		return
+	}
+	if err := writeSkipLog(path, skipped); err != nil {
+		log.Fatalf("Failed to write skip log: %v", err)
+	}
+	fmt.Printf("Wrote skip log to %s\n", path)
+}
+
+// Columns of the -report-skipped CSV.
+var skipReportColumns = []string{"name", "reason", "folder_path", "coordinates_raw"}
+
+// writeSkipReport writes the placemarks skipped for their geometry to w as
+// CSV, in the order they were skipped, and returns how many it wrote.
+func writeSkipReport(w io.Writer, skipped []kml.SkippedPlacemark) (int, error) {
+	cw := csv.NewWriter(w)
+	cw.Write(skipReportColumns)
+	written := 0
+	for _, skip := range skipped {
+		if !skip.Reason.Geometry() {
+			continue
+		}
+		cw.Write([]string{
+			skip.Name,
+			string(skip.Reason),
+			strings.Join(skip.FolderPath, store.FolderPathSeparator),
+			skip.CoordinatesRaw,
+		})
+		written++
+	}
+	cw.Flush()
+	return written, cw.Error()
+}
+
+// writeSkipReportIfSet writes the skip report when -report-skipped was
+// given, exiting on failure.
+func writeSkipReportIfSet(path string, skipped []kml.SkippedPlacemark) {
+	if path == "" {
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("Failed to create skip report: %v", err)
+	}
+	written, err := writeSkipReport(file, skipped)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		log.Fatalf("Failed to write skip report: %v", err)
+	}
+	fmt.Printf("Wrote %d placemarks skipped for invalid geometry to %s\n", written, path)
+}
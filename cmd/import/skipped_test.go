@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+var testSkips = []kml.SkippedPlacemark{
+	{Name: "Gate C", FolderPath: []string{"Venue"}, Reason: kml.SkipDegeneratePolygon, CoordinatesRaw: "-115.17,36.09 -115.17,36.09"},
+	{Name: "", FolderPath: []string{"Venue"}, Reason: kml.SkipEmptyName},
+	{Name: "Stage", Reason: kml.SkipNoGeometry},
+	{Name: "Tower", FolderPath: []string{"Venue", "North"}, Reason: kml.SkipDegeneratePolygon, CoordinatesRaw: "-115.1,36.1"},
+	{Name: "Lot", Reason: kml.SkipInvalidCoords, CoordinatesRaw: "north,east"},
+}
+
+func TestPrintSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		skipped []kml.SkippedPlacemark
+		skipLog string
+		want    string
+	}{
+		{"nothing skipped", nil, "", ""},
+		{"breakdown with hint", testSkips, "", "Skipped placemarks: 5 (use -skip-log to list them)\n" +
+			"  no_geometry: 1\n" +
+			"  invalid_coords: 1\n" +
+			"  empty_name: 1\n" +
+			"  degenerate_polygon: 2\n"},
+		{"breakdown with skip log", testSkips[:1], "skipped.jsonl", "Skipped placemarks: 1\n" +
+			"  degenerate_polygon: 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printSkipped(&buf, tt.skipped, tt.skipLog)
+			if buf.String() != tt.want {
+				t.Errorf("printSkipped wrote\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSkipReport(t *testing.T) {
+	var buf bytes.Buffer
+	written, err := writeSkipReport(&buf, testSkips)
+	if err != nil {
+		t.Fatalf("writeSkipReport: %v", err)
+	}
+	if written != 4 {
+		t.Errorf("wrote %d placemarks, want 4", written)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("report is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		skipReportColumns,
+		{"Gate C", "degenerate_polygon", "Venue", "-115.17,36.09 -115.17,36.09"},
+		{"Stage", "no_geometry", "", ""},
+		{"Tower", "degenerate_polygon", "Venue / North", "-115.1,36.1"},
+		{"Lot", "invalid_coords", "", "north,east"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("report = %q, want %q", records, want)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// originalCoordinatesKey is the extended-data key recording a snapped point's
+// coordinates before correction, as "lon,lat".
+const originalCoordinatesKey = "original_coordinates"
+
+// snapConfig moves imported points onto a reference line network.
+type snapConfig struct {
+	Folder    string
+	Tolerance float64 // meters
+}
+
+func (c snapConfig) enabled() bool {
+	return c.Folder != ""
+}
+
+// snapPoints moves each Point among ids to the closest position on the nearest
+// LineString in the reference folder, when one lies within the tolerance. The
+// reference lines may come from this import or an earlier one. It returns how
+// many points were moved.
+func snapPoints(ctx context.Context, tx pgx.Tx, ids []int, cfg snapConfig) (int64, error) {
+	tag, err := tx.Exec(ctx, `
+		WITH candidates AS (
+			SELECT p.id, p.geom AS original, nearest.geom AS line
+			FROM placemarks p
+			CROSS JOIN LATERAL (
+				SELECT r.geom
+				FROM placemarks r
+				WHERE r.geometry_type = 'LineString'
+				  AND $2 = ANY(r.folder_path)
+				  AND ST_DWithin(r.geom::geography, p.geom::geography, $3)
+				ORDER BY r.geom::geography <-> p.geom::geography
+				LIMIT 1
+			) nearest
+			WHERE p.id = ANY($1)
+			  AND p.geometry_type = 'Point'
+			  AND NOT ($2 = ANY(p.folder_path))
+		),
+		recorded AS (
+			INSERT INTO placemark_data (placemark_id, key, value)
+			SELECT id, $4, ST_X(original) || ',' || ST_Y(original)
+			FROM candidates
+		)
+		UPDATE placemarks p
+		SET geom = ST_ClosestPoint(c.line, c.original)
+		FROM candidates c
+		WHERE p.id = c.id
+	`, ids, cfg.Folder, cfg.Tolerance, originalCoordinatesKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to snap points: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
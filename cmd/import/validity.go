@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// geometryCheck reports what checkGeometries changed.
+type geometryCheck struct {
+	Repaired int
+	Skipped  []kml.SkippedPlacemark
+}
+
+// checkGeometries runs each placemark's WKT through PostGIS before import.
+// Geometries that fail ST_IsValid are replaced with their ST_MakeValid
+// repair, which may change the geometry type; ones PostGIS can't parse at
+// all (such as rings with too few points), or that repair to nothing, are
+// dropped. With strict set, the first invalid geometry is an error instead.
+// It only reads, so tx may be read-only.
+func checkGeometries(ctx context.Context, tx pgx.Tx, placemarks []kml.PlacemarkRecord, strict bool) ([]kml.PlacemarkRecord, geometryCheck, error) {
+	var check geometryCheck
+	if len(placemarks) == 0 {
+		return placemarks, check, nil
+	}
+
+	wkts := make([]string, len(placemarks))
+	for i, pm := range placemarks {
+		wkts[i] = pm.GeomWKT
+	}
+	unparsed, err := unparsableGeometries(ctx, tx, wkts)
+	if err != nil {
+		return nil, check, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT w.i::int - 1, t.g IS NOT NULL, COALESCE(ST_IsValidReason(t.g), ''),
+		       ST_AsText(r.fixed), substr(ST_GeometryType(r.fixed), 4), COALESCE(ST_IsEmpty(r.fixed), true)
+		FROM unnest($1::text[]) WITH ORDINALITY AS w(wkt, i)
+		CROSS JOIN LATERAL (
+			SELECT CASE WHEN w.i::int - 1 = ANY($2::int[]) THEN NULL ELSE ST_GeomFromText(w.wkt, 4326) END AS g
+		) t
+		CROSS JOIN LATERAL (SELECT ST_MakeValid(t.g) AS fixed) r
+		WHERE t.g IS NULL OR NOT ST_IsValid(t.g)
+		ORDER BY w.i
+	`, wkts, unparsed)
+	if err != nil {
+		return nil, check, fmt.Errorf("failed to check geometries: %w", err)
+	}
+	defer rows.Close()
+
+	drop := make(map[int]bool)
+	for rows.Next() {
+		var (
+			i                  int
+			parsed, empty      bool
+			reason             string
+			fixedWKT, geomType *string
+		)
+		if err := rows.Scan(&i, &parsed, &reason, &fixedWKT, &geomType, &empty); err != nil {
+			return nil, check, fmt.Errorf("failed to scan geometry check: %w", err)
+		}
+		pm := &placemarks[i]
+		if !parsed {
+			reason = "PostGIS could not parse the geometry"
+		}
+		if strict {
+			return nil, check, fmt.Errorf("placemark %q in %v has invalid geometry: %s", pm.Name, pm.FolderPath, reason)
+		}
+
+		if !parsed || empty || fixedWKT == nil {
+			log.Printf("Skipped placemark %q in %v: invalid geometry (%s)", pm.Name, pm.FolderPath, reason)
+			drop[i] = true
+			check.Skipped = append(check.Skipped, kml.SkippedPlacemark{
+				Name:           pm.Name,
+				FolderPath:     pm.FolderPath,
+				Reason:         kml.SkipInvalidGeometry,
+				CoordinatesRaw: pm.CoordinatesRaw,
+			})
+			continue
+		}
+
+		log.Printf("Repaired geometry of placemark %q in %v (%s); now %s", pm.Name, pm.FolderPath, reason, *geomType)
+		pm.GeomWKT = *fixedWKT
+		pm.GeometryType = *geomType
+		check.Repaired++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, check, fmt.Errorf("failed to check geometries: %w", err)
+	}
+
+	if len(drop) == 0 {
+		return placemarks, check, nil
+	}
+	kept := make([]kml.PlacemarkRecord, 0, len(placemarks)-len(drop))
+	for i, pm := range placemarks {
+		if !drop[i] {
+			kept = append(kept, pm)
+		}
+	}
+	return kept, check, nil
+}
+
+// unparsableGeometries returns the indexes of the wkts PostGIS rejects.
+// Parsing them all at once is tried first, under a savepoint; only when that
+// fails is each parsed under its own savepoint to find the culprits, since
+// a read-only transaction can't create a function to trap the error.
+func unparsableGeometries(ctx context.Context, tx pgx.Tx, wkts []string) ([]int, error) {
+	parses := func(query string, args ...interface{}) (bool, error) {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to check geometries: %w", err)
+		}
+		defer sp.Rollback(context.WithoutCancel(ctx))
+		if _, err := sp.Exec(ctx, query, args...); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to check geometries: %w", err)
+		}
+		return true, nil
+	}
+
+	ok, err := parses(`SELECT count(ST_GeomFromText(wkt, 4326)) FROM unnest($1::text[]) AS w(wkt)`, wkts)
+	if err != nil || ok {
+		return nil, err
+	}
+	var unparsed []int
+	for i, wkt := range wkts {
+		ok, err := parses(`SELECT ST_GeomFromText($1, 4326)`, wkt)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			unparsed = append(unparsed, i)
+		}
+	}
+	return unparsed, nil
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/cors"
+)
+
+// DefaultCORSOrigins allows local development servers on any port.
+var DefaultCORSOrigins = []string{"http://localhost:*", "http://127.0.0.1:*"}
+
+// CORS lets browsers on origins call the API. An origin may contain one "*"
+// wildcard (https://*.example.com), and "*" alone allows any origin, in
+// which case credentials are not allowed since browsers refuse them with a
+// wildcard. Preflight requests are answered here: 204 with the
+// Access-Control-* headers when the origin, method, and headers are allowed,
+// 403 without them otherwise.
+func CORS(origins []string) func(http.Handler) http.Handler {
+	c := cors.New(cors.Options{
+		AllowedOrigins:     origins,
+		AllowedMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:     []string{"Accept", "Authorization", "Content-Type", "If-Match", "If-None-Match"},
+		ExposedHeaders:     []string{"Link", "ETag", "Location"},
+		AllowCredentials:   !slices.Contains(origins, "*"),
+		MaxAge:             300,
+		OptionsPassthrough: true,
+	})
+
+	return func(next http.Handler) http.Handler {
+		return c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if w.Header().Get("Access-Control-Allow-Origin") == "" {
+				respondError(w, http.StatusForbidden, "CORS preflight rejected")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		method          string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		wantStatus      int
+		wantAllowOrigin string
+		wantCredentials bool
+	}{
+		{"simple request", DefaultCORSOrigins, "GET", "http://localhost:5173", "", "", http.StatusOK, "http://localhost:5173", true},
+		{"disallowed origin", DefaultCORSOrigins, "GET", "https://evil.example", "", "", http.StatusOK, "", false},
+		{"preflight", DefaultCORSOrigins, "OPTIONS", "http://127.0.0.1:3000", "PATCH", "Authorization, If-Match", http.StatusNoContent, "http://127.0.0.1:3000", true},
+		{"preflight bad origin", DefaultCORSOrigins, "OPTIONS", "https://evil.example", "PATCH", "", http.StatusForbidden, "", false},
+		{"preflight bad method", DefaultCORSOrigins, "OPTIONS", "http://localhost:5173", "TRACE", "", http.StatusForbidden, "", false},
+		{"preflight bad header", DefaultCORSOrigins, "OPTIONS", "http://localhost:5173", "GET", "X-Secret", http.StatusForbidden, "", false},
+		{"plain OPTIONS", DefaultCORSOrigins, "OPTIONS", "", "", "", http.StatusOK, "", false},
+		{"subdomain wildcard", []string{"https://*.example.com"}, "GET", "https://maps.example.com", "", "", http.StatusOK, "https://maps.example.com", true},
+		{"any origin", []string{"*"}, "GET", "https://anywhere.example", "", "", http.StatusOK, "*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := CORS(tt.origins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(tt.method, "/api/v1/placemarks", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Errorf("Allow-Credentials = %v, want %v", got, tt.wantCredentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/shapefile"
+)
+
+// Attribute columns written to exported shapefiles. DBF limits field names
+// to 10 characters and values to 254 bytes.
+var shapefileFields = []shapefile.Field{
+	{Name: "id", Length: 10},
+	{Name: "name", Length: 254},
+	{Name: "folder", Length: 254},
+	{Name: "timestamp", Length: 20},
+}
+
+func (h *Handlers) ExportShapefile(w http.ResponseWriter, r *http.Request) {
+	window, ok := exportWindow(w, r)
+	if !ok {
+		return
+	}
+	folder := r.URL.Query().Get("folder")
+
+	placemarks, err := h.placemarkStore.ListAll(r.Context(), folder, window)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	features := make([]shapefile.Feature, 0, len(placemarks))
+	for _, p := range placemarks {
+		var timestamp string
+		if p.Timestamp != nil {
+			timestamp = p.Timestamp.Format(time.RFC3339)
+		}
+		features = append(features, shapefile.Feature{
+			Geometry: p.Geometry,
+			Values: []string{
+				strconv.Itoa(p.ID),
+				p.Name,
+				strings.Join(p.FolderPath, "/"),
+				timestamp,
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	if _, err := shapefile.WriteZip(&buf, "placemarks", shapefileFields, features); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="placemarks.zip"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// geoJSONGeometry is a GeoJSON geometry as written to POST and PUT
+// /placemarks, before validation.
+type geoJSONGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometries  []json.RawMessage `json:"geometries"`
+}
+
+// position is a GeoJSON position: longitude, latitude, and optionally
+// altitude.
+type position []float64
+
+// validateGeoJSONGeometry checks that raw is a geometry placemarks can be
+// written with and that its coordinates have the shape its type needs, so
+// malformed input is refused before it reaches ST_GeomFromGeoJSON.
+func validateGeoJSONGeometry(raw json.RawMessage) error {
+	var g geoJSONGeometry
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return fmt.Errorf("must be a GeoJSON geometry object")
+	}
+	if g.Type == "GeometryCollection" {
+		if len(g.Geometries) == 0 {
+			return fmt.Errorf("GeometryCollection needs a non-empty geometries array")
+		}
+		for i, member := range g.Geometries {
+			if err := validateGeoJSONGeometry(member); err != nil {
+				return fmt.Errorf("geometries[%d]: %w", i, err)
+			}
+		}
+		return nil
+	}
+	if len(g.Coordinates) == 0 {
+		return fmt.Errorf("%s needs coordinates", typeName(g.Type))
+	}
+
+	var err error
+	switch g.Type {
+	case "Point":
+		var p position
+		if err = unmarshalCoordinates(g, &p); err == nil {
+			err = checkPosition(p)
+		}
+	case "MultiPoint":
+		var ps []position
+		if err = unmarshalCoordinates(g, &ps); err == nil {
+			err = checkPositions(ps, 1)
+		}
+	case "LineString":
+		var ps []position
+		if err = unmarshalCoordinates(g, &ps); err == nil {
+			err = checkPositions(ps, 2)
+		}
+	case "MultiLineString":
+		var lines [][]position
+		if err = unmarshalCoordinates(g, &lines); err == nil {
+			err = checkEach(len(lines), func(i int) error { return checkPositions(lines[i], 2) })
+		}
+	case "Polygon":
+		var rings [][]position
+		if err = unmarshalCoordinates(g, &rings); err == nil {
+			err = checkRings(rings)
+		}
+	case "MultiPolygon":
+		var polygons [][][]position
+		if err = unmarshalCoordinates(g, &polygons); err == nil {
+			err = checkEach(len(polygons), func(i int) error { return checkRings(polygons[i]) })
+		}
+	default:
+		return fmt.Errorf("unsupported geometry type %q", g.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s coordinates: %w", g.Type, err)
+	}
+	return nil
+}
+
+func typeName(t string) string {
+	if t == "" {
+		return "geometry"
+	}
+	return t
+}
+
+func unmarshalCoordinates(g geoJSONGeometry, dst interface{}) error {
+	if err := json.Unmarshal(g.Coordinates, dst); err != nil {
+		return fmt.Errorf("wrong nesting or non-numeric values")
+	}
+	return nil
+}
+
+func checkEach(n int, check func(int) error) error {
+	if n == 0 {
+		return fmt.Errorf("must not be empty")
+	}
+	for i := 0; i < n; i++ {
+		if err := check(i); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func checkPosition(p position) error {
+	if len(p) != 2 && len(p) != 3 {
+		return fmt.Errorf("a position needs 2 or 3 numbers, got %d", len(p))
+	}
+	return nil
+}
+
+func checkPositions(ps []position, min int) error {
+	if len(ps) < min {
+		return fmt.Errorf("needs at least %d positions, got %d", min, len(ps))
+	}
+	for i, p := range ps {
+		if err := checkPosition(p); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkRings checks polygon rings: each needs four positions and must end
+// where it starts.
+func checkRings(rings [][]position) error {
+	return checkEach(len(rings), func(i int) error {
+		ring := rings[i]
+		if err := checkPositions(ring, 4); err != nil {
+			return err
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return fmt.Errorf("ring is not closed")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateGeoJSONGeometry(t *testing.T) {
+	tests := []struct {
+		name    string
+		geom    string
+		wantErr bool
+	}{
+		{"point", `{"type":"Point","coordinates":[-115.17,36.09]}`, false},
+		{"point with altitude", `{"type":"Point","coordinates":[-115.17,36.09,620]}`, false},
+		{"line", `{"type":"LineString","coordinates":[[0,0],[1,1]]}`, false},
+		{"polygon", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`, false},
+		{"multipoint", `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`, false},
+		{"multiline", `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3]]]}`, false},
+		{"multipolygon", `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]]]}`, false},
+		{"collection", `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[0,0]}]}`, false},
+
+		{"not an object", `[0,0]`, true},
+		{"unknown type", `{"type":"Circle","coordinates":[0,0]}`, true},
+		{"missing type", `{"coordinates":[0,0]}`, true},
+		{"missing coordinates", `{"type":"Point"}`, true},
+		{"null coordinates", `{"type":"Point","coordinates":null}`, true},
+		{"point too short", `{"type":"Point","coordinates":[1]}`, true},
+		{"point too long", `{"type":"Point","coordinates":[1,2,3,4]}`, true},
+		{"point as string", `{"type":"Point","coordinates":"1,2"}`, true},
+		{"point nested like a line", `{"type":"Point","coordinates":[[0,0]]}`, true},
+		{"line with one position", `{"type":"LineString","coordinates":[[0,0]]}`, true},
+		{"line as point", `{"type":"LineString","coordinates":[0,0]}`, true},
+		{"empty multipoint", `{"type":"MultiPoint","coordinates":[]}`, true},
+		{"polygon ring too short", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[0,0]]]}`, true},
+		{"polygon ring not closed", `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1]]]}`, true},
+		{"polygon without rings", `{"type":"Polygon","coordinates":[]}`, true},
+		{"multipolygon bad member", `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0]]]]}`, true},
+		{"empty collection", `{"type":"GeometryCollection","geometries":[]}`, true},
+		{"collection bad member", `{"type":"GeometryCollection","geometries":[{"type":"Point"}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGeoJSONGeometry(json.RawMessage(tt.geom))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateGeoJSONGeometry(%s) error = %v, wantErr %v", tt.geom, err, tt.wantErr)
+			}
+		})
+	}
+}
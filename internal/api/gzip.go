@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultGzipMinSize is the response size below which Gzip doesn't bother
+// compressing; the gzip framing would eat most of the saving.
+const DefaultGzipMinSize = 1400
+
+// Gzip compresses responses for clients that send Accept-Encoding: gzip.
+// Output is buffered until minSize bytes are written or the handler flushes;
+// responses that finish smaller go out uncompressed. Responses that already
+// carry a Content-Encoding, or are zip archives, pass through untouched.
+func Gzip(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize}
+			defer gw.Close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip. A
+// coding listed with q=0 is refused.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+		if !ok {
+			return true
+		}
+		v, err := strconv.ParseFloat(q, 64)
+		return err == nil && v > 0
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the header and the first minSize bytes of
+// the body until it knows whether to compress.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	if !g.decided {
+		if g.buf.Len()+len(p) < g.minSize {
+			return g.buf.Write(p)
+		}
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// decide sends the header, compressing if large is set and the response is
+// eligible, then writes out whatever was buffered.
+func (g *gzipResponseWriter) decide(large bool) error {
+	g.decided = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+
+	h := g.Header()
+	if large && compressible(g.status, h) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+
+	if g.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(g.buf.Bytes())
+	} else {
+		_, err = g.ResponseWriter.Write(g.buf.Bytes())
+	}
+	g.buf.Reset()
+	return err
+}
+
+func compressible(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	return !strings.HasPrefix(h.Get("Content-Type"), "application/zip")
+}
+
+// Flush commits to compression, since a flushing handler is streaming.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		if g.decide(true) != nil {
+			return
+		}
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the response: small bodies are sent as-is, compressed ones
+// get their gzip trailer.
+func (g *gzipResponseWriter) Close() error {
+	if !g.decided {
+		if g.status == 0 && g.buf.Len() == 0 {
+			// The handler wrote nothing; let net/http send its default.
+			return nil
+		}
+		return g.decide(false)
+	}
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
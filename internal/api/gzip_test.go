@@ -0,0 +1,149 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.5", true},
+		{"*", true},
+		{"*;q=0", false},
+		{"br, deflate", false},
+		{"gzip;q=abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := acceptsGzip(tt.header); got != tt.want {
+				t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	const minSize = 100
+	large := strings.Repeat("placemark ", 50)
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantStatus     int
+		wantGzip       bool
+		wantBody       string
+	}{
+		{
+			name: "large body compressed", acceptEncoding: "gzip",
+			handler:    func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, large) },
+			wantStatus: http.StatusOK, wantGzip: true, wantBody: large,
+		},
+		{
+			name: "small body passed through", acceptEncoding: "gzip",
+			handler:    func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") },
+			wantStatus: http.StatusOK, wantBody: "ok",
+		},
+		{
+			name:       "client without gzip",
+			handler:    func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, large) },
+			wantStatus: http.StatusOK, wantBody: large,
+		},
+		{
+			name: "HEAD", method: http.MethodHead, acceptEncoding: "gzip",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "already encoded", acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK, wantBody: large,
+		},
+		{
+			name: "zip archive", acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/zip")
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK, wantBody: large,
+		},
+		{
+			name: "flushed small body compressed", acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "[")
+				w.(http.Flusher).Flush()
+				io.WriteString(w, "]")
+			},
+			wantStatus: http.StatusOK, wantGzip: true, wantBody: "[]",
+		},
+		{
+			name: "status kept", acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusCreated, wantGzip: true, wantBody: large,
+		},
+		{
+			name: "not modified", acceptEncoding: "gzip",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotModified) },
+			wantStatus: http.StatusNotModified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/api/v1/placemarks", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			Gzip(minSize)(tt.handler).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+
+			body := w.Body.String()
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("gzip = %v, want %v", gzipped, tt.wantGzip)
+			}
+			if gzipped {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("body is not gzip: %v", err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("failed to decompress: %v", err)
+				}
+				body = string(b)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,16 +1,27 @@
 package api
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/onnwee/mandalay/internal/sanitize"
 	"github.com/onnwee/mandalay/internal/store"
 )
 
 type Handlers struct {
 	placemarkStore *store.PlacemarkStore
+	requireIfMatch bool
 }
 
 func NewHandlers(placemarkStore *store.PlacemarkStore) *Handlers {
@@ -19,98 +30,1439 @@ func NewHandlers(placemarkStore *store.PlacemarkStore) *Handlers {
 	}
 }
 
+// RequireIfMatch makes PATCH /placemarks/{id} reject requests without an
+// If-Match header with 428. Without it a missing header updates
+// unconditionally; a stale one is refused either way.
+func (h *Handlers) RequireIfMatch() {
+	h.requireIfMatch = true
+}
+
+// readyTimeout bounds the database ping behind /readyz.
+const readyTimeout = 2 * time.Second
+
+// Healthz is the liveness probe: it succeeds whenever the process is serving.
+func (h *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz is the readiness probe: it succeeds only while the database answers
+// a ping, so orchestrators stop routing traffic when it can't be reached.
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	if err := h.placemarkStore.Ping(ctx); err != nil {
+		respondError(w, http.StatusServiceUnavailable, "database unavailable: "+err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
 func (h *Handlers) ListPlacemarks(w http.ResponseWriter, r *http.Request) {
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := getListFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := getIntParam(r, "limit", 100)
+	offset := getIntParam(r, "offset", 0)
+
+	switch r.URL.Query().Get("order") {
+	case "", "id":
+	case "distance":
+		from, err := parsePointParam(r.URL.Query().Get("from"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "order=distance requires from=lon,lat: "+err.Error())
+			return
+		}
+		filter.NearestTo = &from
+	default:
+		respondError(w, http.StatusBadRequest, "order must be id or distance")
+		return
+	}
+
+	if sortParam := r.URL.Query().Get("sort"); sortParam != "" {
+		key, dir, _ := strings.Cut(sortParam, ":")
+		if !slices.Contains(store.ListSortKeys, key) || (dir != "" && dir != "asc" && dir != "desc") {
+			respondError(w, http.StatusBadRequest, "sort must be id, name, or created_at, optionally followed by :asc or :desc")
+			return
+		}
+		if filter.NearestTo != nil {
+			respondError(w, http.StatusBadRequest, "sort can't be combined with order=distance")
+			return
+		}
+		filter.Sort, filter.SortDesc = key, dir == "desc"
+	}
+
+	if afterParam := r.URL.Query().Get("after"); afterParam != "" {
+		after, err := strconv.Atoi(afterParam)
+		if err != nil || after < 0 {
+			respondError(w, http.StatusBadRequest, "after must be a placemark id")
+			return
+		}
+		if filter.NearestTo != nil || filter.Sort != "" || r.URL.Query().Has("offset") {
+			respondError(w, http.StatusBadRequest, "after can't be combined with offset, sort, or order=distance")
+			return
+		}
+
+		placemarks, err := h.placemarkStore.ListAfter(r.Context(), after, limit, filter)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sanitizePlacemarks(placemarks, mode)
+
+		// A short page is the last one.
+		var next *int
+		if len(placemarks) > 0 && len(placemarks) == limit {
+			next = &placemarks[len(placemarks)-1].ID
+		}
+
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"placemarks":  placemarks,
+			"limit":       limit,
+			"next_cursor": next,
+		})
+		return
+	}
+
+	// The page is streamed as rows arrive; limit, offset, and the counts
+	// follow the placemarks array.
+	stream := newJSONStream(w, "application/json", `{"placemarks":[`)
+	count := 0
+	err = h.placemarkStore.EachListed(r.Context(), limit, offset, filter, false, func(p *store.Placemark) error {
+		p.Description = sanitize.ApplyFormat(mode, p.DescriptionFormat, p.Description)
+		count++
+		return stream.element(p)
+	})
+	var total int
+	if err == nil {
+		total, err = h.placemarkStore.PageTotal(r.Context(), filter, limit, offset, count)
+	}
+	if err == nil {
+		err = stream.finish(fmt.Sprintf(`],"limit":%d,"offset":%d,"total":%d,"has_more":%t}`+"\n",
+			limit, offset, total, offset+count < total))
+	}
+	if err != nil {
+		stream.fail(r, err)
+	}
+}
+
+// GetPlacemarksGeoJSON serves a page of placemarks as a GeoJSON
+// FeatureCollection for map libraries. It takes the same filters as
+// ListPlacemarks, and its limit and offset.
+func (h *Handlers) GetPlacemarksGeoJSON(w http.ResponseWriter, r *http.Request) {
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := getListFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	limit := getIntParam(r, "limit", 100)
 	offset := getIntParam(r, "offset", 0)
+
+	stream := newJSONStream(w, "application/geo+json", `{"type":"FeatureCollection","features":[`)
+	err = h.placemarkStore.EachListed(r.Context(), limit, offset, filter, true, func(p *store.Placemark) error {
+		feature := placemarkFeature(p, mode)
+		feature.Properties["extended_data"] = p.ExtendedData
+		return stream.element(feature)
+	})
+	if err == nil {
+		err = stream.finish("]}\n")
+	}
+	if err != nil {
+		stream.fail(r, err)
+	}
+}
+
+// maxSearchLimit caps the page size of /placemarks/search.
+const maxSearchLimit = 200
+
+// SearchPlacemarks runs a full-text search over names and descriptions.
+func (h *Handlers) SearchPlacemarks(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		respondError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := getIntParam(r, "limit", 20)
+	if limit < 1 || limit > maxSearchLimit {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+		return
+	}
+	offset := getIntParam(r, "offset", 0)
+
+	results, total, err := h.placemarkStore.Search(r.Context(), q, limit, offset)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if results == nil {
+		results = []store.SearchResult{}
+	}
+	for i := range results {
+		p := &results[i].Placemark
+		p.Description = sanitize.ApplyFormat(mode, p.DescriptionFormat, p.Description)
+		// Headlines are cut from the raw description, so they may hold
+		// stray markup besides the <b> highlights.
+		results[i].Headline = sanitize.HTML(results[i].Headline)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   q,
+		"results": results,
+		"count":   len(results),
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// Duplicate finder limits
+const (
+	maxDuplicateGroupSize = 50
+	maxDuplicateTolerance = 1000
+)
+
+func (h *Handlers) GetDuplicates(w http.ResponseWriter, r *http.Request) {
 	folder := r.URL.Query().Get("folder")
+	tolerance := getFloatParam(r, "tolerance", 0)
+	if tolerance < 0 || tolerance > maxDuplicateTolerance {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("tolerance must be between 0 and %d meters", maxDuplicateTolerance))
+		return
+	}
+
+	groups, err := h.placemarkStore.GetGeometryDuplicates(r.Context(), folder, tolerance, maxDuplicateGroupSize)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"groups":    groups,
+		"count":     len(groups),
+		"tolerance": tolerance,
+	})
+}
+
+func (h *Handlers) GetPlacemark(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var meters float64
+	if r.URL.Query().Get("buffer") != "" {
+		meters = getFloatParam(r, "buffer", 0)
+		if meters <= 0 {
+			respondError(w, http.StatusBadRequest, "buffer must be a positive number of meters")
+			return
+		}
+		meters = min(meters, maxBufferMeters)
+	}
+
+	placemark, err := h.placemarkStore.GetByID(r.Context(), id)
+	if errors.Is(err, store.ErrPlacemarkNotFound) {
+		respondError(w, http.StatusNotFound, "placemark not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if notModified(w, r, placemarkETag(placemark, mode, meters)) {
+		return
+	}
+	placemark.Description = sanitize.ApplyFormat(mode, placemark.DescriptionFormat, placemark.Description)
+	if placemark.DescriptionRaw != nil {
+		// The source is only as safe as the mode makes it, like description.
+		raw := sanitize.ApplyFormat(mode, placemark.DescriptionFormat, *placemark.DescriptionRaw)
+		placemark.DescriptionRaw = &raw
+	}
+
+	if meters > 0 {
+		geometry, err := h.placemarkStore.GetBufferedGeometry(r.Context(), id, meters)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		placemark.Geometry = geometry
+
+		respondJSON(w, http.StatusOK, struct {
+			*store.Placemark
+			BufferMeters float64 `json:"buffer_meters"`
+		}{placemark, meters})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, placemark)
+}
+
+func (h *Handlers) GetPlacemarkDistance(w http.ResponseWriter, r *http.Request) {
+	fromID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	toID, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "to must be a placemark id")
+		return
+	}
+
+	units, err := store.ParseDistanceUnit(r.URL.Query().Get("units"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	meters, found, err := h.placemarkStore.GetDistance(r.Context(), fromID, toID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		respondError(w, http.StatusNotFound, "placemark not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from":     fromID,
+		"to":       toID,
+		"distance": units.FromMeters(meters),
+		"units":    units,
+	})
+}
+
+// Limits for /placemarks/nearby.
+const (
+	defaultNearbyRadius = 1000
+	maxNearbyRadius     = 50000
+	defaultNearbyLimit  = 50
+	maxNearbyLimit      = 500
+)
+
+// GetNearby returns placemarks within a radius in meters of lon,lat, nearest
+// first, each with its distance.
+func (h *Handlers) GetNearby(w http.ResponseWriter, r *http.Request) {
+	lon, err := requireFloatParam(r, "lon")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	lat, err := requireFloatParam(r, "lat")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateBBox(store.BoundingBox{MinLon: lon, MinLat: lat, MaxLon: lon, MaxLat: lat}); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	radius := getFloatParam(r, "radius", defaultNearbyRadius)
+	if radius <= 0 || radius > maxNearbyRadius {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("radius must be between 0 and %d meters", maxNearbyRadius))
+		return
+	}
+	limit := getIntParam(r, "limit", defaultNearbyLimit)
+	if limit < 1 || limit > maxNearbyLimit {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxNearbyLimit))
+		return
+	}
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	nearby, err := h.placemarkStore.GetNearby(r.Context(), lon, lat, radius, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if nearby == nil {
+		nearby = []store.NearbyPlacemark{}
+	}
+	for i := range nearby {
+		p := &nearby[i].Placemark
+		p.Description = sanitize.ApplyFormat(mode, p.DescriptionFormat, p.Description)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"placemarks": nearby,
+		"center":     store.Point{Lat: lat, Lon: lon},
+		"radius":     radius,
+		"count":      len(nearby),
+	})
+}
+
+// UpdatePlacemark applies a partial update. Only thumbnail_url is writable;
+// sending null clears it so the default selection applies again. An If-Match
+// header holding the placemark's ETag makes the update conditional.
+func (h *Handlers) UpdatePlacemark(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	ifVersion, ok := h.ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	raw, ok := req["thumbnail_url"]
+	if !ok || len(req) != 1 {
+		respondError(w, http.StatusBadRequest, "only thumbnail_url can be updated")
+		return
+	}
+
+	var thumbnail *string
+	if err := json.Unmarshal(raw, &thumbnail); err != nil {
+		respondError(w, http.StatusBadRequest, "thumbnail_url must be a string or null")
+		return
+	}
+	if thumbnail != nil {
+		if u, err := url.Parse(*thumbnail); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			respondError(w, http.StatusBadRequest, "thumbnail_url must be an http(s) URL")
+			return
+		}
+	}
+
+	if err := h.placemarkStore.SetThumbnailURL(r.Context(), id, thumbnail, ifVersion); err != nil {
+		if errors.Is(err, store.ErrPlacemarkNotFound) {
+			respondError(w, http.StatusNotFound, "placemark not found")
+			return
+		}
+		if errors.Is(err, store.ErrVersionMismatch) {
+			respondError(w, http.StatusPreconditionFailed, "placemark has changed; refetch and retry")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondWrittenPlacemark(w, r, http.StatusOK, id, mode)
+}
+
+// ifMatchVersion reads the If-Match precondition of a placemark write. It
+// reports false after responding when the header is malformed, or missing
+// while the server requires it.
+func (h *Handlers) ifMatchVersion(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		respondError(w, http.StatusPreconditionFailed, err.Error())
+		return nil, false
+	}
+	if ifVersion == nil && h.requireIfMatch && r.Header.Get("If-Match") == "" {
+		respondError(w, http.StatusPreconditionRequired, "If-Match header required; fetch the placemark for its ETag")
+		return nil, false
+	}
+	return ifVersion, true
+}
+
+// placemarkInput is the body of POST /placemarks and PUT /placemarks/{id}.
+type placemarkInput struct {
+	Name              string          `json:"name"`
+	Description       string          `json:"description"`
+	DescriptionFormat string          `json:"description_format"`
+	StyleID           *string         `json:"style_id"`
+	FolderPath        []string        `json:"folder_path"`
+	Geometry          json.RawMessage `json:"geometry"`
+	MediaLinks        []string        `json:"media_links"`
+	Timestamp         *time.Time      `json:"timestamp"`
+	EndTimestamp      *time.Time      `json:"end_timestamp"`
+	ExtendedData      []store.KVPair  `json:"extended_data"`
+}
+
+// geoJSONGeometryTypes are the geometry types placemarks can be written with.
+var geoJSONGeometryTypes = map[string]bool{
+	"Point": true, "LineString": true, "Polygon": true,
+	"MultiPoint": true, "MultiLineString": true, "MultiPolygon": true,
+	"GeometryCollection": true,
+}
+
+// decodePlacemarkInput reads and validates a placemark write body. It
+// reports false after responding with an error.
+func (h *Handlers) decodePlacemarkInput(w http.ResponseWriter, r *http.Request) (*store.Placemark, bool) {
+	// Read-only fields (id, version, thumbnail_url, ...) are ignored, so a
+	// fetched placemark can be edited and sent back as is.
+	var in placemarkInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return nil, false
+	}
+
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return nil, false
+	}
+
+	// The geometry may be given as a GeoJSON object or, as placemarks are
+	// returned, as a string holding one.
+	var encoded string
+	if json.Unmarshal(in.Geometry, &encoded) == nil {
+		in.Geometry = json.RawMessage(encoded)
+	}
+	if len(in.Geometry) == 0 || string(in.Geometry) == "null" {
+		respondError(w, http.StatusBadRequest, "geometry is required and must be a GeoJSON geometry")
+		return nil, false
+	}
+	if err := validateGeoJSONGeometry(in.Geometry); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid geometry: "+err.Error())
+		return nil, false
+	}
+
+	switch in.DescriptionFormat {
+	case "":
+		in.DescriptionFormat = sanitize.FormatHTML
+	case sanitize.FormatHTML, sanitize.FormatMarkdown:
+	default:
+		respondError(w, http.StatusBadRequest, "description_format must be html or markdown")
+		return nil, false
+	}
+
+	if in.EndTimestamp != nil && (in.Timestamp == nil || in.EndTimestamp.Before(*in.Timestamp)) {
+		respondError(w, http.StatusBadRequest, "end_timestamp requires a timestamp no later than it")
+		return nil, false
+	}
+
+	if in.StyleID != nil {
+		style, err := h.placemarkStore.GetStyle(r.Context(), *in.StyleID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return nil, false
+		}
+		if style == nil {
+			respondError(w, http.StatusBadRequest, "unknown style_id")
+			return nil, false
+		}
+	}
+
+	for _, kv := range in.ExtendedData {
+		if kv.Key == "" {
+			respondError(w, http.StatusBadRequest, "extended_data keys must not be empty")
+			return nil, false
+		}
+	}
+
+	return &store.Placemark{
+		Name:              in.Name,
+		Description:       in.Description,
+		DescriptionFormat: in.DescriptionFormat,
+		StyleID:           in.StyleID,
+		FolderPath:        in.FolderPath,
+		Geometry:          string(in.Geometry),
+		MediaLinks:        in.MediaLinks,
+		Timestamp:         in.Timestamp,
+		EndTimestamp:      in.EndTimestamp,
+		ExtendedData:      in.ExtendedData,
+	}, true
+}
+
+// CreatePlacemark adds a placemark and returns it with its new id.
+func (h *Handlers) CreatePlacemark(w http.ResponseWriter, r *http.Request) {
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, ok := h.decodePlacemarkInput(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.placemarkStore.Create(r.Context(), p); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/placemarks/"+strconv.Itoa(p.ID))
+	h.respondWrittenPlacemark(w, r, http.StatusCreated, p.ID, mode)
+}
+
+// respondWrittenPlacemark answers a placemark write with the placemark as
+// GetPlacemark would return it, description sanitized per mode, and its
+// ETag.
+func (h *Handlers) respondWrittenPlacemark(w http.ResponseWriter, r *http.Request, status, id int, mode sanitize.Mode) {
+	placemark, err := h.placemarkStore.GetByID(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	placemark.Description = sanitize.ApplyFormat(mode, placemark.DescriptionFormat, placemark.Description)
+
+	w.Header().Set("ETag", placemarkETag(placemark, mode, 0))
+	respondJSON(w, status, placemark)
+}
+
+// ReplacePlacemark overwrites a placemark's fields and extended data. Like
+// UpdatePlacemark it honors If-Match. The thumbnail_url is left alone.
+func (h *Handlers) ReplacePlacemark(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	ifVersion, ok := h.ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, ok := h.decodePlacemarkInput(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.placemarkStore.Update(r.Context(), id, p, ifVersion); err != nil {
+		if errors.Is(err, store.ErrPlacemarkNotFound) {
+			respondError(w, http.StatusNotFound, "placemark not found")
+			return
+		}
+		if errors.Is(err, store.ErrVersionMismatch) {
+			respondError(w, http.StatusPreconditionFailed, "placemark has changed; refetch and retry")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondWrittenPlacemark(w, r, http.StatusOK, id, mode)
+}
+
+// placemarkETag is the strong entity tag for a placemark's current version
+// as GetPlacemark represents it with the given description mode and buffer
+// (0 for none). The default representation's tag is just the version;
+// others append the parameters that change the body, so two different
+// bodies never share a strong validator. parseIfMatch reads the version
+// back from any of them.
+func placemarkETag(p *store.Placemark, mode sanitize.Mode, bufferMeters float64) string {
+	tag := strconv.FormatInt(p.Version, 10)
+	if mode != sanitize.ModeSafe {
+		tag += ";description=" + string(mode)
+	}
+	if bufferMeters > 0 {
+		tag += ";buffer=" + strconv.FormatFloat(bufferMeters, 'g', -1, 64)
+	}
+	return `"` + tag + `"`
+}
+
+// notModified sets the ETag header and, when the request's If-None-Match
+// lists etag (compared weakly) or is "*", answers 304 Not Modified and
+// reports true; the caller then writes nothing more.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch reads an If-Match header as a placemark version. It returns
+// nil for an absent header or "*", which match any existing placemark.
+func parseIfMatch(header string) (*int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return nil, fmt.Errorf("If-Match must be a single ETag")
+	}
+	versionText, _, _ := strings.Cut(tag[1:len(tag)-1], ";")
+	version, err := strconv.ParseInt(versionText, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("If-Match does not match any placemark version")
+	}
+	return &version, nil
+}
+
+func (h *Handlers) MergePlacemark(w http.ResponseWriter, r *http.Request) {
+	keepID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var req struct {
+		MergeID int `json:"merge_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MergeID == 0 {
+		respondError(w, http.StatusBadRequest, "body must be {\"merge_id\": <id>}")
+		return
+	}
+	if req.MergeID == keepID {
+		respondError(w, http.StatusBadRequest, "cannot merge a placemark into itself")
+		return
+	}
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.placemarkStore.MergePlacemarks(r.Context(), keepID, req.MergeID); err != nil {
+		if errors.Is(err, store.ErrPlacemarkNotFound) {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	placemark, err := h.placemarkStore.GetByID(r.Context(), keepID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	placemark.Description = sanitize.ApplyFormat(mode, placemark.DescriptionFormat, placemark.Description)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"placemark": placemark,
+		"merged_id": req.MergeID,
+	})
+}
+
+// PatchPlacemarkData upserts and deletes individual extended-data keys
+// without rewriting the rest of the placemark.
+func (h *Handlers) PatchPlacemarkData(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	ifVersion, ok := h.ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Set    map[string]string `json:"set"`
+		Delete []string          `json:"delete"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "body must be {\"set\": {<key>: <value>}, \"delete\": [<key>]}")
+		return
+	}
+	if len(req.Set) == 0 && len(req.Delete) == 0 {
+		respondError(w, http.StatusBadRequest, "nothing to set or delete")
+		return
+	}
+	for _, key := range req.Delete {
+		if _, ok := req.Set[key]; ok {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("key %q is both set and deleted", key))
+			return
+		}
+	}
+
+	data, version, err := h.placemarkStore.PatchExtendedData(r.Context(), id, req.Set, req.Delete, ifVersion)
+	if err != nil {
+		if errors.Is(err, store.ErrPlacemarkNotFound) {
+			respondError(w, http.StatusNotFound, "placemark not found")
+			return
+		}
+		if errors.Is(err, store.ErrVersionMismatch) {
+			respondError(w, http.StatusPreconditionFailed, "placemark has changed; refetch and retry")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":            id,
+		"extended_data": data,
+	})
+}
+
+func (h *Handlers) GetRoute(w http.ResponseWriter, r *http.Request) {
+	fromID, err := strconv.Atoi(r.URL.Query().Get("from_id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "from_id must be a placemark id")
+		return
+	}
+	toID, err := strconv.Atoi(r.URL.Query().Get("to_id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "to_id must be a placemark id")
+		return
+	}
+	if fromID == toID {
+		respondError(w, http.StatusBadRequest, "from_id and to_id must differ")
+		return
+	}
+
+	route, err := h.placemarkStore.GetRoute(r.Context(), fromID, toID)
+	switch {
+	case errors.Is(err, store.ErrPlacemarkNotFound):
+		respondError(w, http.StatusNotFound, "placemark not found")
+		return
+	case errors.Is(err, store.ErrNoRoute):
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, store.ErrRoutingUnavailable):
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"from_id":            fromID,
+		"to_id":              toID,
+		"geometry":           route.Geometry,
+		"length_meters":      route.LengthMeters,
+		"edge_placemark_ids": route.EdgePlacemarkIDs,
+	})
+}
+
+// maxBufferMeters caps the ?buffer= distance on placemark detail.
+const maxBufferMeters = 50000
+
+func (h *Handlers) DeleteSource(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "label")
+
+	deleted, err := h.placemarkStore.DeleteBySource(r.Context(), source)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		respondError(w, http.StatusNotFound, "source not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"source":  source,
+		"deleted": deleted,
+	})
+}
+
+func (h *Handlers) DeletePlacemark(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if err := h.placemarkStore.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrPlacemarkNotFound) {
+			respondError(w, http.StatusNotFound, "placemark not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) ListStyles(w http.ResponseWriter, r *http.Request) {
+	styles, err := h.placemarkStore.ListStyles(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if styles == nil {
+		styles = []store.Style{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"styles": styles,
+		"count":  len(styles),
+	})
+}
+
+func (h *Handlers) GetStyle(w http.ResponseWriter, r *http.Request) {
+	style, err := h.placemarkStore.GetStyle(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if style == nil {
+		respondError(w, http.StatusNotFound, "style not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, style)
+}
+
+func (h *Handlers) GetStylePlacemarks(w http.ResponseWriter, r *http.Request) {
+	styleID := chi.URLParam(r, "id")
+	limit := getIntParam(r, "limit", 100)
+	offset := getIntParam(r, "offset", 0)
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exists, err := h.placemarkStore.StyleExists(r.Context(), styleID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		respondError(w, http.StatusNotFound, "style not found")
+		return
+	}
+
+	placemarks, err := h.placemarkStore.GetByStyle(r.Context(), styleID, limit, offset)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if placemarks == nil {
+		placemarks = []store.Placemark{}
+	}
+	sanitizePlacemarks(placemarks, mode)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"style_id":   styleID,
+		"placemarks": placemarks,
+		"count":      len(placemarks),
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+func (h *Handlers) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	descending, err := getTimelineOrder(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	window, err := getTimeWindow(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var events []store.TimelineEvent
+
+	if bboxParam := r.URL.Query().Get("bbox"); bboxParam != "" {
+		bbox, parseErr := getBBoxParam(r)
+		if parseErr != nil {
+			respondError(w, http.StatusBadRequest, parseErr.Error())
+			return
+		}
+		events, err = h.placemarkStore.GetTimelineInBBox(r.Context(), bbox, window)
+	} else {
+		events, err = h.placemarkStore.GetTimeline(r.Context(), window)
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if descending {
+		store.SortTimeline(events, true)
+	}
+	sanitizeEvents(events, mode)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+func (h *Handlers) GetTimelineEvents(w http.ResponseWriter, r *http.Request) {
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	descending, err := getTimelineOrder(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := getTimeWindow(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := h.placemarkStore.GetTimeline(r.Context(), window)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if descending {
+		store.SortTimeline(events, true)
+	}
+	sanitizeEvents(events, mode)
+
+	respondJSON(w, http.StatusOK, events)
+}
+
+// Limits for /timeline/nearest.
+const (
+	defaultNearestInTime = 10
+	maxNearestInTime     = 100
+)
+
+// GetNearestInTime lists the events closest in time to ?at= (RFC 3339 or
+// YYYY-MM-DD) or to the timestamp of ?placemark_id=, which is excluded from
+// the results.
+func (h *Handlers) GetNearestInTime(w http.ResponseWriter, r *http.Request) {
+	limit := getIntParam(r, "limit", defaultNearestInTime)
+	if limit <= 0 {
+		respondError(w, http.StatusBadRequest, "limit must be positive")
+		return
+	}
+	if limit > maxNearestInTime {
+		limit = maxNearestInTime
+	}
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var at time.Time
+	excludeID := 0
+	if idParam := r.URL.Query().Get("placemark_id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid placemark_id")
+			return
+		}
+		placemark, err := h.placemarkStore.GetByID(r.Context(), id)
+		if errors.Is(err, store.ErrPlacemarkNotFound) {
+			respondError(w, http.StatusNotFound, "placemark not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if placemark.Timestamp == nil {
+			respondError(w, http.StatusBadRequest, "placemark has no timestamp")
+			return
+		}
+		at, excludeID = *placemark.Timestamp, id
+	} else {
+		at, err = parseTimeParam(r.URL.Query().Get("at"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Fetch one extra in case the reference placemark is among the results.
+	neighbors, err := h.placemarkStore.GetNearestInTime(r.Context(), at, limit+1)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	events := make([]store.TemporalNeighbor, 0, limit)
+	for _, n := range neighbors {
+		if len(events) == limit {
+			break
+		}
+		if n.PlacemarkID == excludeID {
+			continue
+		}
+		n.Description = sanitize.ApplyFormat(mode, n.DescriptionFormat, n.Description)
+		events = append(events, n)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"at":     at.Format(time.RFC3339),
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date.
+func parseTimeParam(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, fmt.Errorf("missing at or placemark_id")
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q (expected RFC 3339 or YYYY-MM-DD)", val)
+}
+
+// Parameters for /spatial/stack.
+const (
+	defaultStackPrecision = 5
+	maxStackPrecision     = 8
+	defaultStackRadius    = 20.0
+	maxStackRadius        = 500.0
+	defaultStackMembers   = 50
+	maxStackMembers       = 200
+)
+
+// GetStack returns the points stacked at ?at=lon,lat with spiderfy offsets.
+func (h *Handlers) GetStack(w http.ResponseWriter, r *http.Request) {
+	at, err := parsePointParam(r.URL.Query().Get("at"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "at: "+err.Error())
+		return
+	}
+
+	precision := getIntParam(r, "precision", defaultStackPrecision)
+	if precision < 0 || precision > maxStackPrecision {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("precision must be between 0 and %d decimal places", maxStackPrecision))
+		return
+	}
+
+	radius := getFloatParam(r, "radius", defaultStackRadius)
+	if radius <= 0 {
+		respondError(w, http.StatusBadRequest, "radius must be a positive number of meters")
+		return
+	}
+	if radius > maxStackRadius {
+		radius = maxStackRadius
+	}
+
+	limit := getIntParam(r, "limit", defaultStackMembers)
+	if limit <= 0 {
+		respondError(w, http.StatusBadRequest, "limit must be positive")
+		return
+	}
+	if limit > maxStackMembers {
+		limit = maxStackMembers
+	}
+
+	stack, err := h.placemarkStore.GetStack(r.Context(), at, precision, radius, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stack)
+}
+
+func (h *Handlers) GetPlacemarksInBBox(w http.ResponseWriter, r *http.Request) {
+	limit := getIntParam(r, "limit", 1000)
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var bbox store.BoundingBox
+	for _, p := range []struct {
+		key string
+		dst *float64
+	}{
+		{"min_lon", &bbox.MinLon},
+		{"min_lat", &bbox.MinLat},
+		{"max_lon", &bbox.MaxLon},
+		{"max_lat", &bbox.MaxLat},
+	} {
+		if *p.dst, err = requireFloatParam(r, p.key); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	bbox, err = orientBBox(r, bbox)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("light") == "true" {
+		markers, err := h.placemarkStore.GetInBBoxLight(r.Context(), bbox, limit)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if markers == nil {
+			markers = []store.PlacemarkMarker{}
+		}
+
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"placemarks": markers,
+			"bbox":       bbox,
+			"count":      len(markers),
+		})
+		return
+	}
 
-	placemarks, err := h.placemarkStore.List(r.Context(), limit, offset, folder)
+	tolerance, err := getToleranceParam(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	placemarks, err := h.placemarkStore.GetInBBox(r.Context(), bbox, limit, tolerance)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	sanitizePlacemarks(placemarks, mode)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"placemarks": placemarks,
-		"limit":      limit,
-		"offset":     offset,
+		"bbox":       bbox,
+		"count":      len(placemarks),
 	})
 }
 
-func (h *Handlers) GetPlacemark(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+// Heatmap grid limits
+const (
+	defaultHeatmapCell = 0.01
+	maxHeatmapCells    = 5000
+)
+
+func (h *Handlers) GetHeatmap(w http.ResponseWriter, r *http.Request) {
+	bbox, err := getBBoxParam(r)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, "invalid id")
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	placemark, err := h.placemarkStore.GetByID(r.Context(), id)
+	cell := getFloatParam(r, "cell", defaultHeatmapCell)
+	if cell <= 0 {
+		respondError(w, http.StatusBadRequest, "cell must be a positive number of degrees")
+		return
+	}
+
+	cells, err := h.placemarkStore.GetHeatmapGrid(r.Context(), bbox, cell, maxHeatmapCells)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "placemark not found")
+		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondJSON(w, http.StatusOK, placemark)
+	features := make([]geoJSONFeature, 0, len(cells))
+	for _, c := range cells {
+		features = append(features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: json.RawMessage(fmt.Sprintf(`{"type":"Point","coordinates":[%g,%g]}`, c.Lon, c.Lat)),
+			Properties: map[string]interface{}{
+				"count": c.Count,
+			},
+		})
+	}
+
+	respondJSON(w, http.StatusOK, geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: features,
+	})
 }
 
-func (h *Handlers) GetTimeline(w http.ResponseWriter, r *http.Request) {
-	events, err := h.placemarkStore.GetTimeline(r.Context())
+// GetClusters groups the placemarks in ?bbox= into marker clusters for
+// ?zoom=, as GeoJSON points with a count property and, for single-placemark
+// clusters, the placemark's id.
+func (h *Handlers) GetClusters(w http.ResponseWriter, r *http.Request) {
+	bbox, err := getBBoxParam(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	zoom, err := strconv.Atoi(r.URL.Query().Get("zoom"))
+	if err != nil || zoom < 0 || zoom > store.MaxClusterZoom {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("zoom must be an integer between 0 and %d", store.MaxClusterZoom))
+		return
+	}
+
+	clusters, err := h.placemarkStore.GetClusters(r.Context(), bbox, zoom)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"events": events,
-		"count":  len(events),
+	features := make([]geoJSONFeature, 0, len(clusters))
+	for _, c := range clusters {
+		properties := map[string]interface{}{
+			"count": c.Count,
+		}
+		if c.ID != nil {
+			properties["id"] = *c.ID
+		}
+		features = append(features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   json.RawMessage(fmt.Sprintf(`{"type":"Point","coordinates":[%g,%g]}`, c.Center.Lon, c.Center.Lat)),
+			Properties: properties,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: features,
 	})
 }
 
-func (h *Handlers) GetTimelineEvents(w http.ResponseWriter, r *http.Request) {
-	events, err := h.placemarkStore.GetTimeline(r.Context())
+// GetTile serves tile z/x/y as a Mapbox Vector Tile, or 204 when no
+// placemark falls in it.
+func (h *Handlers) GetTile(w http.ResponseWriter, r *http.Request) {
+	var coords [3]int
+	for i, key := range []string{"z", "x", "y"} {
+		v, err := strconv.Atoi(chi.URLParam(r, key))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "tile coordinates must be integers")
+			return
+		}
+		coords[i] = v
+	}
+	z, x, y := coords[0], coords[1], coords[2]
+	if _, ok := store.TileBounds(z, x, y); !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("no tile %d/%d/%d: z must be 0 to %d and x, y 0 to 2^z-1", z, x, y, store.MaxTileZoom))
+		return
+	}
+
+	tile, err := h.placemarkStore.GetTile(r.Context(), z, x, y)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if len(tile) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
-	respondJSON(w, http.StatusOK, events)
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Write(tile)
 }
 
-func (h *Handlers) GetPlacemarksInBBox(w http.ResponseWriter, r *http.Request) {
-	minLon := getFloatParam(r, "min_lon", 0)
-	minLat := getFloatParam(r, "min_lat", 0)
-	maxLon := getFloatParam(r, "max_lon", 0)
-	maxLat := getFloatParam(r, "max_lat", 0)
-	limit := getIntParam(r, "limit", 1000)
+// GetFolderHull returns the convex hull of a folder's geometries as a GeoJSON
+// feature.
+func (h *Handlers) GetFolderHull(w http.ResponseWriter, r *http.Request) {
+	folder, err := folderParam(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if minLon == 0 || minLat == 0 || maxLon == 0 || maxLat == 0 {
-		respondError(w, http.StatusBadRequest, "missing bbox parameters")
+	hull, err := h.placemarkStore.GetFolderHull(r.Context(), folder)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hull == nil {
+		respondError(w, http.StatusNotFound, "folder not found")
 		return
 	}
 
-	bbox := store.BoundingBox{
-		MinLon: minLon,
-		MinLat: minLat,
-		MaxLon: maxLon,
-		MaxLat: maxLat,
+	respondJSON(w, http.StatusOK, geoJSONFeature{
+		Type:     "Feature",
+		Geometry: json.RawMessage(hull.Geometry),
+		Properties: map[string]interface{}{
+			"folder": hull.Folder,
+			"count":  hull.Count,
+		},
+	})
+}
+
+// GetFolderBounds returns the extent of a folder's placemarks, for zooming
+// the map to it.
+func (h *Handlers) GetFolderBounds(w http.ResponseWriter, r *http.Request) {
+	folder, err := folderParam(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	placemarks, err := h.placemarkStore.GetInBBox(r.Context(), bbox, limit)
+	bounds, err := h.placemarkStore.GetFolderBounds(r.Context(), folder)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if bounds == nil {
+		respondError(w, http.StatusNotFound, "folder not found")
+		return
+	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"placemarks": placemarks,
-		"bbox":       bbox,
-		"count":      len(placemarks),
+		"folder": folder,
+		"bounds": bounds,
 	})
 }
 
+// folderParam reads the {folder} path parameter. chi matches on the raw path
+// when the URL escapes a slash (%2F), leaving the parameter escaped, so it is
+// unescaped here; otherwise it is already decoded.
+func folderParam(r *http.Request) (string, error) {
+	folder := chi.URLParam(r, "folder")
+	if r.URL.RawPath == "" {
+		return folder, nil
+	}
+	unescaped, err := url.PathUnescape(folder)
+	if err != nil {
+		return "", fmt.Errorf("invalid folder: %w", err)
+	}
+	return unescaped, nil
+}
+
 func (h *Handlers) ListFolders(w http.ResponseWriter, r *http.Request) {
-	folders, err := h.placemarkStore.ListFolders(r.Context())
+	limit := getIntParam(r, "limit", 500)
+	offset := getIntParam(r, "offset", 0)
+
+	folders, total, err := h.placemarkStore.ListFolders(r.Context(), limit, offset)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -119,11 +1471,43 @@ func (h *Handlers) ListFolders(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"folders": folders,
 		"count":   len(folders),
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// GetFolderTree returns the folder hierarchy with placemark counts.
+func (h *Handlers) GetFolderTree(w http.ResponseWriter, r *http.Request) {
+	root, err := h.placemarkStore.GetFolderTree(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"folders":    root.Children,
+		"unfoldered": root.Count,
+		"total":      root.Total,
 	})
 }
 
+// Bounds for the stats ?top= parameter
+const (
+	defaultTopFolders = 10
+	maxTopFolders     = 100
+)
+
 func (h *Handlers) GetStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.placemarkStore.GetStats(r.Context())
+	top := getIntParam(r, "top", defaultTopFolders)
+	if top < 1 {
+		top = defaultTopFolders
+	}
+	if top > maxTopFolders {
+		top = maxTopFolders
+	}
+
+	stats, err := h.placemarkStore.GetStats(r.Context(), top)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -132,6 +1516,129 @@ func (h *Handlers) GetStats(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, stats)
 }
 
+// GetTimelineHistogram counts timeline events per day, week, month, or year
+// (?interval=, default month) for density charts.
+func (h *Handlers) GetTimelineHistogram(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if !slices.Contains(store.HistogramIntervals, interval) {
+		respondError(w, http.StatusBadRequest, "interval must be day, week, month, or year")
+		return
+	}
+
+	histogram, err := h.placemarkStore.GetTimelineHistogram(r.Context(), interval)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, histogram)
+}
+
+func (h *Handlers) GetGeometryReport(w http.ResponseWriter, r *http.Request) {
+	reports, err := h.placemarkStore.GetGeometryReport(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"geometry_types": reports,
+	})
+}
+
+// ListDataKeys lists the extended-data keys in use with their counts.
+func (h *Handlers) ListDataKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.placemarkStore.ListDataKeys(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+func (h *Handlers) ListImports(w http.ResponseWriter, r *http.Request) {
+	limit := getIntParam(r, "limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	runs, err := h.placemarkStore.ListImportRuns(r.Context(), limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if runs == nil {
+		runs = []store.ImportRun{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"imports": runs,
+		"count":   len(runs),
+	})
+}
+
+// Delta sync page sizes
+const (
+	defaultChangesLimit = 500
+	maxChangesLimit     = 5000
+)
+
+func (h *Handlers) GetChanges(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if val := r.URL.Query().Get("since"); val != "" {
+		parsed, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || parsed < 0 {
+			respondError(w, http.StatusBadRequest, "since must be a non-negative version number")
+			return
+		}
+		since = parsed
+	}
+
+	limit := getIntParam(r, "limit", defaultChangesLimit)
+	if limit <= 0 || limit > maxChangesLimit {
+		limit = defaultChangesLimit
+	}
+
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	changes, err := h.placemarkStore.GetChangedSince(r.Context(), since, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range changes.Placemarks {
+		changes.Placemarks[i].Description = sanitize.ApplyFormat(mode, changes.Placemarks[i].DescriptionFormat, changes.Placemarks[i].Description)
+	}
+
+	respondJSON(w, http.StatusOK, changes)
+}
+
+func (h *Handlers) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	stats := h.placemarkStore.DetailCacheStats()
+	if stats == nil {
+		respondJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":  true,
+		"hits":     stats.Hits,
+		"misses":   stats.Misses,
+		"size":     stats.Size,
+		"capacity": stats.Capacity,
+	})
+}
+
 func getIntParam(r *http.Request, key string, defaultVal int) int {
 	val := r.URL.Query().Get(key)
 	if val == "" {
@@ -149,13 +1656,288 @@ func getFloatParam(r *http.Request, key string, defaultVal float64) float64 {
 	if val == "" {
 		return defaultVal
 	}
-	floatVal, err := strconv.ParseFloat(val, 64)
+	floatVal, err := parseFiniteFloat(val)
 	if err != nil {
 		return defaultVal
 	}
 	return floatVal
 }
 
+// requireFloatParam reads a mandatory float query parameter. Zero is a valid
+// value; only an absent or unparsable parameter is an error.
+func requireFloatParam(r *http.Request, key string) (float64, error) {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return 0, fmt.Errorf("missing %s parameter", key)
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	return f, nil
+}
+
+// getToleranceParam reads the optional simplification tolerance in
+// degrees; absent means no simplification.
+func getToleranceParam(r *http.Request) (float64, error) {
+	val := r.URL.Query().Get("tolerance")
+	if val == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return 0, fmt.Errorf("tolerance must be a non-negative number of degrees")
+	}
+	return f, nil
+}
+
+// getBBoxParam reads the bbox query parameter, honoring coord_order.
+func getBBoxParam(r *http.Request) (store.BoundingBox, error) {
+	bbox, err := parseBBoxParam(r.URL.Query().Get("bbox"))
+	if err != nil {
+		return store.BoundingBox{}, err
+	}
+	return orientBBox(r, bbox)
+}
+
+// orientBBox swaps latitude and longitude when the request sets
+// coord_order=latlon, then checks the box is in range and well-ordered.
+func orientBBox(r *http.Request, bbox store.BoundingBox) (store.BoundingBox, error) {
+	switch r.URL.Query().Get("coord_order") {
+	case "", "lonlat":
+	case "latlon":
+		bbox = store.BoundingBox{
+			MinLon: bbox.MinLat,
+			MinLat: bbox.MinLon,
+			MaxLon: bbox.MaxLat,
+			MaxLat: bbox.MaxLon,
+		}
+	default:
+		return store.BoundingBox{}, fmt.Errorf("coord_order must be lonlat or latlon")
+	}
+
+	if err := validateBBox(bbox); err != nil {
+		return store.BoundingBox{}, err
+	}
+	return bbox, nil
+}
+
+func validateBBox(bbox store.BoundingBox) error {
+	for _, lat := range []float64{bbox.MinLat, bbox.MaxLat} {
+		if lat < -90 || lat > 90 {
+			return fmt.Errorf("latitude %g out of range [-90, 90]; if coordinates are in lat,lon order pass coord_order=latlon", lat)
+		}
+	}
+	for _, lon := range []float64{bbox.MinLon, bbox.MaxLon} {
+		if lon < -180 || lon > 180 {
+			return fmt.Errorf("longitude %g out of range [-180, 180]", lon)
+		}
+	}
+	if bbox.MinLon > bbox.MaxLon {
+		return fmt.Errorf("min_lon (%g) is greater than max_lon (%g)", bbox.MinLon, bbox.MaxLon)
+	}
+	if bbox.MinLat > bbox.MaxLat {
+		return fmt.Errorf("min_lat (%g) is greater than max_lat (%g)", bbox.MinLat, bbox.MaxLat)
+	}
+	return nil
+}
+
+// getTimelineOrder reads the timeline order parameter (asc or desc; default
+// asc) and reports whether it is descending.
+func getTimelineOrder(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, fmt.Errorf("order must be asc or desc")
+}
+
+// getTimeWindow reads the timeline from and to parameters. Either may be
+// omitted to leave that side open.
+func getTimeWindow(r *http.Request) (store.TimeWindow, error) {
+	var window store.TimeWindow
+	for _, p := range []struct {
+		key string
+		dst **time.Time
+	}{{"from", &window.From}, {"to", &window.To}} {
+		val := r.URL.Query().Get(p.key)
+		if val == "" {
+			continue
+		}
+		t, err := parseTimeParam(val)
+		if err != nil {
+			return store.TimeWindow{}, fmt.Errorf("%s: %w", p.key, err)
+		}
+		*p.dst = &t
+	}
+	if window.From != nil && window.To != nil && window.To.Before(*window.From) {
+		return store.TimeWindow{}, fmt.Errorf("from must not be after to")
+	}
+	return window, nil
+}
+
+// getListFilter reads the filters shared by the placemark list endpoints:
+// folder, source, geometry_type, data.<key>, and tolerance.
+func getListFilter(r *http.Request) (store.ListFilter, error) {
+	geometryTypes, err := getGeometryTypes(r)
+	if err != nil {
+		return store.ListFilter{}, err
+	}
+	tolerance, err := getToleranceParam(r)
+	if err != nil {
+		return store.ListFilter{}, err
+	}
+	data, err := getDataFilters(r)
+	if err != nil {
+		return store.ListFilter{}, err
+	}
+	return store.ListFilter{
+		Folder:        r.URL.Query().Get("folder"),
+		Source:        r.URL.Query().Get("source"),
+		GeometryTypes: geometryTypes,
+		Tolerance:     tolerance,
+		Data:          data,
+	}, nil
+}
+
+// getGeometryTypes reads the comma-separated geometry_type parameter,
+// case-insensitively, as canonical type names. It returns nil when the
+// parameter is absent.
+func getGeometryTypes(r *http.Request) ([]string, error) {
+	val := r.URL.Query().Get("geometry_type")
+	if val == "" {
+		return nil, nil
+	}
+	var types []string
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		canonical := ""
+		for t := range geoJSONGeometryTypes {
+			if strings.EqualFold(t, name) {
+				canonical = t
+				break
+			}
+		}
+		if canonical == "" {
+			return nil, fmt.Errorf("unknown geometry_type %q (expected Point, LineString, Polygon, MultiPoint, MultiLineString, MultiPolygon, or GeometryCollection)", name)
+		}
+		if !slices.Contains(types, canonical) {
+			types = append(types, canonical)
+		}
+	}
+	return types, nil
+}
+
+// getDataFilters reads data.<key>=<value> query parameters as
+// extended-data conditions, sorted by key. A key given more than once
+// needs each of its values.
+func getDataFilters(r *http.Request) ([]store.KVPair, error) {
+	var filters []store.KVPair
+	for param, values := range r.URL.Query() {
+		key, ok := strings.CutPrefix(param, "data.")
+		if !ok {
+			continue
+		}
+		if key == "" {
+			return nil, fmt.Errorf("data filters need a key, as in data.<key>=<value>")
+		}
+		for _, v := range values {
+			filters = append(filters, store.KVPair{Key: key, Value: v})
+		}
+	}
+	slices.SortFunc(filters, func(a, b store.KVPair) int {
+		return cmp.Or(strings.Compare(a.Key, b.Key), strings.Compare(a.Value, b.Value))
+	})
+	return filters, nil
+}
+
+// getDescriptionMode reads the description query parameter (raw, text, or
+// safe; default safe).
+func getDescriptionMode(r *http.Request) (sanitize.Mode, error) {
+	return sanitize.ParseMode(r.URL.Query().Get("description"))
+}
+
+func sanitizePlacemarks(placemarks []store.Placemark, mode sanitize.Mode) {
+	for i := range placemarks {
+		placemarks[i].Description = sanitize.ApplyFormat(mode, placemarks[i].DescriptionFormat, placemarks[i].Description)
+	}
+}
+
+func sanitizeEvents(events []store.TimelineEvent, mode sanitize.Mode) {
+	for i := range events {
+		events[i].Description = sanitize.ApplyFormat(mode, events[i].DescriptionFormat, events[i].Description)
+	}
+}
+
+// parsePointParam parses a "lon,lat" query value.
+func parsePointParam(val string) (store.Point, error) {
+	if val == "" {
+		return store.Point{}, fmt.Errorf("missing point")
+	}
+	parts := strings.Split(val, ",")
+	if len(parts) != 2 {
+		return store.Point{}, fmt.Errorf("point must be lon,lat")
+	}
+
+	lon, err := parseFiniteFloat(parts[0])
+	if err != nil {
+		return store.Point{}, fmt.Errorf("invalid longitude %q", parts[0])
+	}
+	lat, err := parseFiniteFloat(parts[1])
+	if err != nil {
+		return store.Point{}, fmt.Errorf("invalid latitude %q", parts[1])
+	}
+	if lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+		return store.Point{}, fmt.Errorf("point %g,%g out of range", lon, lat)
+	}
+
+	return store.Point{Lon: lon, Lat: lat}, nil
+}
+
+// parseBBoxParam parses a "min_lon,min_lat,max_lon,max_lat" query value.
+func parseBBoxParam(val string) (store.BoundingBox, error) {
+	if val == "" {
+		return store.BoundingBox{}, fmt.Errorf("missing bbox parameter")
+	}
+
+	parts := strings.Split(val, ",")
+	if len(parts) != 4 {
+		return store.BoundingBox{}, fmt.Errorf("bbox must be min_lon,min_lat,max_lon,max_lat")
+	}
+
+	var vals [4]float64
+	for i, part := range parts {
+		f, err := parseFiniteFloat(part)
+		if err != nil {
+			return store.BoundingBox{}, fmt.Errorf("invalid bbox value %q", part)
+		}
+		vals[i] = f
+	}
+
+	return store.BoundingBox{
+		MinLon: vals[0],
+		MinLat: vals[1],
+		MaxLon: vals[2],
+		MaxLat: vals[3],
+	}, nil
+}
+
+// parseFiniteFloat parses one coordinate of a point or bbox value.
+// ParseFloat accepts "NaN" and "Inf", which no range check would catch, so
+// they are rejected here, as requireFloatParam does.
+func parseFiniteFloat(val string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", val)
+	}
+	return f, nil
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
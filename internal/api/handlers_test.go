@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/onnwee/mandalay/internal/sanitize"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+func TestDecodePlacemarkInput(t *testing.T) {
+	const point = `"geometry":{"type":"Point","coordinates":[-115.17,36.09]}`
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", `{"name":"Gate C",` + point + `}`, ""},
+		{"geometry as string", `{"name":"Gate C","geometry":"{\"type\":\"Point\",\"coordinates\":[0,0]}"}`, ""},
+		{"markdown", `{"name":"Gate C","description_format":"markdown",` + point + `}`, ""},
+		{"not JSON", `{`, "invalid JSON body"},
+		{"missing name", `{` + point + `}`, "name is required"},
+		{"blank name", `{"name":"  ",` + point + `}`, "name is required"},
+		{"missing geometry", `{"name":"Gate C"}`, "geometry is required"},
+		{"null geometry", `{"name":"Gate C","geometry":null}`, "geometry is required"},
+		{"unknown geometry type", `{"name":"Gate C","geometry":{"type":"Circle","coordinates":[0,0]}}`, "invalid geometry"},
+		{"missing coordinates", `{"name":"Gate C","geometry":{"type":"Point"}}`, "invalid geometry"},
+		{"malformed coordinates", `{"name":"Gate C","geometry":{"type":"LineString","coordinates":[0,0]}}`, "invalid geometry"},
+		{"unknown format", `{"name":"Gate C","description_format":"rtf",` + point + `}`, "description_format"},
+		{"end without start", `{"name":"Gate C","end_timestamp":"2017-10-01T22:00:00Z",` + point + `}`, "end_timestamp"},
+		{"end before start", `{"name":"Gate C","timestamp":"2017-10-01T22:00:00Z","end_timestamp":"2017-10-01T21:00:00Z",` + point + `}`, "end_timestamp"},
+		{"empty extended data key", `{"name":"Gate C","extended_data":[{"key":"","value":"x"}],` + point + `}`, "extended_data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handlers{}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/placemarks", strings.NewReader(tt.body))
+			p, ok := h.decodePlacemarkInput(w, r)
+
+			if tt.wantErr == "" {
+				if !ok {
+					t.Fatalf("rejected valid body: %s", w.Body.String())
+				}
+				if p.Name != "Gate C" || p.Geometry == "" || p.DescriptionFormat == "" {
+					t.Errorf("decoded %+v", p)
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("accepted invalid body %s", tt.body)
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantErr) {
+				t.Errorf("error %s does not mention %q", w.Body.String(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlacemarkETag(t *testing.T) {
+	p := &store.Placemark{Version: 7}
+
+	tests := []struct {
+		name   string
+		mode   sanitize.Mode
+		buffer float64
+		want   string
+	}{
+		{"default", sanitize.ModeSafe, 0, `"7"`},
+		{"raw", sanitize.ModeRaw, 0, `"7;description=raw"`},
+		{"text", sanitize.ModeText, 0, `"7;description=text"`},
+		{"buffer", sanitize.ModeSafe, 50, `"7;buffer=50"`},
+		{"raw with buffer", sanitize.ModeRaw, 12.5, `"7;description=raw;buffer=12.5"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			etag := placemarkETag(p, tt.mode, tt.buffer)
+			if etag != tt.want {
+				t.Fatalf("placemarkETag = %s, want %s", etag, tt.want)
+			}
+			version, err := parseIfMatch(etag)
+			if err != nil || version == nil || *version != 7 {
+				t.Errorf("parseIfMatch(%s) = %v, %v; want 7", etag, version, err)
+			}
+		})
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64 // 0 means no version
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"*", 0, false},
+		{`"3"`, 3, false},
+		{` W/"3" `, 3, false},
+		{`"3;description=raw"`, 3, false},
+		{`3`, 0, true},
+		{`"abc"`, 0, true},
+		{`"3", "4"`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			version, err := parseIfMatch(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseIfMatch(%q) = %v, want error", tt.header, *version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseIfMatch(%q): %v", tt.header, err)
+			}
+			switch {
+			case tt.want == 0 && version != nil:
+				t.Errorf("parseIfMatch(%q) = %d, want none", tt.header, *version)
+			case tt.want != 0 && (version == nil || *version != tt.want):
+				t.Errorf("parseIfMatch(%q) = %v, want %d", tt.header, version, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{"no header", "", `"7"`, false},
+		{"match", `"7"`, `"7"`, true},
+		{"weak match", `W/"7"`, `"7"`, true},
+		{"one of several", `"6", "7"`, `"7"`, true},
+		{"wildcard", "*", `"7"`, true},
+		{"stale version", `"6"`, `"7"`, false},
+		{"other representation", `"7"`, `"7;description=raw"`, false},
+		{"buffered from plain", `"7;description=raw"`, `"7;description=raw;buffer=50"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/placemarks/1", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if got := notModified(w, r, tt.etag); got != tt.want {
+				t.Fatalf("notModified = %v, want %v", got, tt.want)
+			}
+			if w.Header().Get("ETag") != tt.etag {
+				t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), tt.etag)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/sanitize"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+// icalTimeLayout is an iCalendar DATE-TIME without a zone. Timestamps parsed
+// from names carry no zone either, so events are emitted as floating times;
+// stored KML times are written as their UTC wall clock.
+const icalTimeLayout = "20060102T150405"
+
+// ExportICalendar serves the dated timeline as an iCalendar feed, one VEVENT
+// per event. ?folder= keeps events filed under that folder at any depth;
+// ?start= (inclusive) and ?end= (exclusive) bound the event time.
+func (h *Handlers) ExportICalendar(w http.ResponseWriter, r *http.Request) {
+	var start, end *time.Time
+	for _, p := range []struct {
+		key string
+		dst **time.Time
+	}{{"start", &start}, {"end", &end}} {
+		val := r.URL.Query().Get(p.key)
+		if val == "" {
+			continue
+		}
+		t, err := parseTimeParam(val)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, p.key+": "+err.Error())
+			return
+		}
+		*p.dst = &t
+	}
+	folder := r.URL.Query().Get("folder")
+
+	events, err := h.placemarkStore.GetTimeline(r.Context(), store.TimeWindow{})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var b strings.Builder
+	writeICalLine(&b, "BEGIN:VCALENDAR")
+	writeICalLine(&b, "VERSION:2.0")
+	writeICalLine(&b, "PRODID:-//mandalay//timeline//EN")
+	writeICalLine(&b, "CALSCALE:GREGORIAN")
+	writeICalLine(&b, "X-WR-CALNAME:Mandalay timeline")
+
+	stamp := time.Now().UTC().Format(icalTimeLayout) + "Z"
+	for _, e := range events {
+		if e.Timestamp == nil ||
+			(start != nil && e.Timestamp.Before(*start)) ||
+			(end != nil && !e.Timestamp.Before(*end)) ||
+			(folder != "" && !slices.Contains(e.FolderPath, folder)) {
+			continue
+		}
+		writeICalEvent(&b, e, stamp)
+	}
+	writeICalLine(&b, "END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="timeline.ics"`)
+	w.Write([]byte(b.String()))
+}
+
+func writeICalEvent(b *strings.Builder, e store.TimelineEvent, stamp string) {
+	writeICalLine(b, "BEGIN:VEVENT")
+	writeICalLine(b, "UID:placemark-"+strconv.Itoa(e.PlacemarkID)+"@mandalay")
+	writeICalLine(b, "DTSTAMP:"+stamp)
+	writeICalLine(b, "DTSTART:"+e.Timestamp.UTC().Format(icalTimeLayout))
+	if e.EndTimestamp != nil {
+		writeICalLine(b, "DTEND:"+e.EndTimestamp.UTC().Format(icalTimeLayout))
+	}
+	writeICalLine(b, "SUMMARY:"+escapeICalText(e.Name))
+	if desc := sanitize.Text(e.Description); desc != "" {
+		writeICalLine(b, "DESCRIPTION:"+escapeICalText(desc))
+	}
+	if e.Location != nil {
+		writeICalLine(b, fmt.Sprintf("GEO:%f;%f", e.Location.Lat, e.Location.Lon))
+	}
+	if len(e.FolderPath) > 0 {
+		writeICalLine(b, "CATEGORIES:"+escapeICalText(strings.Join(e.FolderPath, store.FolderPathSeparator)))
+	}
+	writeICalLine(b, "END:VEVENT")
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escapeICalText escapes a TEXT property value (RFC 5545 section 3.3.11).
+func escapeICalText(s string) string {
+	return icalTextEscaper.Replace(s)
+}
+
+// writeICalLine writes a content line with CRLF, folding it so no physical
+// line exceeds 75 octets. Folds never split a UTF-8 sequence.
+func writeICalLine(b *strings.Builder, line string) {
+	const maxOctets = 75
+	width := maxOctets
+	for len(line) > width {
+		cut := width
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation line counts toward its length.
+		width = maxOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
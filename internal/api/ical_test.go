@@ -0,0 +1,112 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+func TestEscapeICalText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Gate C", "Gate C"},
+		{"Stage; north, east", `Stage\; north\, east`},
+		{`C:\maps`, `C:\\maps`},
+		{"line one\r\nline two\nthree", `line one\nline two\nthree`},
+	}
+	for _, tt := range tests {
+		if got := escapeICalText(tt.in); got != tt.want {
+			t.Errorf("escapeICalText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteICalLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Gate C"},
+		{"exactly 75", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"long", "DESCRIPTION:" + strings.Repeat("crowd ", 40)},
+		{"multibyte", "SUMMARY:" + strings.Repeat("é", 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			writeICalLine(&b, tt.line)
+			out := b.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("line does not end in CRLF: %q", out)
+			}
+
+			physical := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			var unfolded strings.Builder
+			for i, p := range physical {
+				if len(p) > 75 {
+					t.Errorf("physical line %d is %d octets", i, len(p))
+				}
+				if !utf8.ValidString(p) {
+					t.Errorf("physical line %d splits a UTF-8 sequence: %q", i, p)
+				}
+				if i > 0 {
+					if !strings.HasPrefix(p, " ") {
+						t.Fatalf("continuation line %d does not start with a space", i)
+					}
+					p = p[1:]
+				}
+				unfolded.WriteString(p)
+			}
+			if unfolded.String() != tt.line {
+				t.Errorf("unfolded = %q, want %q", unfolded.String(), tt.line)
+			}
+			if len(tt.line) <= 75 && len(physical) != 1 {
+				t.Errorf("folded a %d-octet line", len(tt.line))
+			}
+		})
+	}
+}
+
+func TestWriteICalEvent(t *testing.T) {
+	start := time.Date(2017, 10, 1, 21, 41, 56, 0, time.FixedZone("PDT", -7*3600))
+	end := start.Add(2 * time.Hour)
+	e := store.TimelineEvent{
+		PlacemarkID:  42,
+		Name:         "Gate C, north",
+		Description:  "<p>Opens at <b>6pm</b></p>",
+		Timestamp:    &start,
+		EndTimestamp: &end,
+		Location:     &store.Point{Lat: 36.09, Lon: -115.17},
+		FolderPath:   []string{"Venue", "Gates"},
+	}
+
+	var b strings.Builder
+	writeICalEvent(&b, e, "20261014T000000Z")
+	want := strings.Join([]string{
+		"BEGIN:VEVENT",
+		"UID:placemark-42@mandalay",
+		"DTSTAMP:20261014T000000Z",
+		"DTSTART:20171002T044156",
+		"DTEND:20171002T064156",
+		`SUMMARY:Gate C\, north`,
+		"DESCRIPTION:Opens at 6pm",
+		"GEO:36.090000;-115.170000",
+		"CATEGORIES:Venue / Gates",
+		"END:VEVENT",
+	}, "\r\n") + "\r\n"
+	if b.String() != want {
+		t.Errorf("event =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	writeICalEvent(&b, store.TimelineEvent{PlacemarkID: 7, Name: "Stage", Timestamp: &start}, "20261014T000000Z")
+	for _, property := range []string{"DTEND", "DESCRIPTION", "GEO", "CATEGORIES"} {
+		if strings.Contains(b.String(), property+":") {
+			t.Errorf("event without %s data wrote %s:\n%s", property, property, b.String())
+		}
+	}
+}
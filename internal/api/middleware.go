@@ -0,0 +1,113 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// DefaultTokenMethods are the methods RequireTokenFor protects when no set
+// is configured: everything that writes.
+var DefaultTokenMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// RequireToken rejects requests that don't carry "Authorization: Bearer
+// <token>". An empty token rejects every request, so protected routes stay
+// closed until a token is configured.
+func RequireToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !validToken(r, token) {
+				unauthorized(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireTokenFor is RequireToken applied only to requests whose method is
+// in methods; requests with any other method pass through unchecked.
+func RequireTokenFor(token string, methods []string) func(http.Handler) http.Handler {
+	protected := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		protected[strings.ToUpper(m)] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if protected[r.Method] && !validToken(r, token) {
+				unauthorized(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validToken reports whether r carries token as its bearer credential,
+// comparing in constant time.
+func validToken(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// WriteTimeout replaces the server's write deadline on the routes it wraps,
+// for streamed responses that take longer to send than the server allows
+// ordinary ones. The deadline runs from the start of the request; a zero
+// timeout removes it.
+func WriteTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var deadline time.Time
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			// A writer without deadline support has no server deadline to
+			// lift, so the error is ignored.
+			_ = http.NewResponseController(w).SetWriteDeadline(deadline)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	respondError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+// RequestLogger logs one structured line per request with its method, path,
+// status, response size, and latency. Server errors log at error level and
+// everything else at info. It doesn't recover panics: put it outside
+// middleware.Recoverer to log the 500 that Recoverer writes. Sizes are bytes
+// on the wire, so compressed when it wraps Gzip.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				level := slog.LevelInfo
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+				logger.LogAttrs(r.Context(), level, "request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", status),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+				)
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTimeout(t *testing.T) {
+	const serverTimeout = 50 * time.Millisecond
+	body := strings.Repeat("placemark,", 1000)
+
+	tests := []struct {
+		name    string
+		wrap    func(http.Handler) http.Handler
+		wantErr bool
+	}{
+		{"server deadline", func(h http.Handler) http.Handler { return h }, true},
+		{"extended", WriteTimeout(time.Minute), false},
+		{"cleared", WriteTimeout(0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(3 * serverTimeout)
+				io.WriteString(w, body)
+			})
+			// The logger and gzip writers sit between the server and the
+			// handler, as in cmd/api, so the deadline must reach through them.
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			srv := httptest.NewUnstartedServer(RequestLogger(logger)(Gzip(DefaultGzipMinSize)(tt.wrap(slow))))
+			srv.Config.WriteTimeout = serverTimeout
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := srv.Client().Get(srv.URL)
+			if err == nil {
+				var got []byte
+				got, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err == nil && string(got) != body {
+					t.Fatalf("body has %d bytes, want %d", len(got), len(body))
+				}
+			}
+			if tt.wantErr && err == nil {
+				t.Fatal("response outlived the server's WriteTimeout")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"valid", "s3cret", "Bearer s3cret", http.StatusNoContent},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"missing header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := RequireToken(tt.token)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			r := httptest.NewRequest("DELETE", "/api/v1/sources/partner", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestRequireTokenFor(t *testing.T) {
+	h := RequireTokenFor("s3cret", []string{"post", "DELETE"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method string
+		auth   bool
+		want   int
+	}{
+		{"GET", false, http.StatusNoContent},
+		{"POST", false, http.StatusUnauthorized},
+		{"POST", true, http.StatusNoContent},
+		{"DELETE", false, http.StatusUnauthorized},
+		{"PATCH", false, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/v1/placemarks", nil)
+		if tt.auth {
+			r.Header.Set("Authorization", "Bearer s3cret")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s (auth %v): status = %d, want %d", tt.method, tt.auth, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+func TestParseBBoxParam(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    store.BoundingBox
+		wantErr bool
+	}{
+		{"-115.3,36.0,-115.0,36.3", store.BoundingBox{MinLon: -115.3, MinLat: 36.0, MaxLon: -115.0, MaxLat: 36.3}, false},
+		{" -1 , -2 , 3 , 4 ", store.BoundingBox{MinLon: -1, MinLat: -2, MaxLon: 3, MaxLat: 4}, false},
+		{"", store.BoundingBox{}, true},
+		{"1,2,3", store.BoundingBox{}, true},
+		{"1,2,3,x", store.BoundingBox{}, true},
+		{"NaN,0,1,1", store.BoundingBox{}, true},
+		{"0,0,Inf,1", store.BoundingBox{}, true},
+		{"0,-Inf,1,1", store.BoundingBox{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			got, err := parseBBoxParam(tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBBoxParam(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseBBoxParam(%q) = %+v, want %+v", tt.val, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePointParam(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    store.Point
+		wantErr bool
+	}{
+		{"-115.172,36.094", store.Point{Lon: -115.172, Lat: 36.094}, false},
+		{"180,-90", store.Point{Lon: 180, Lat: -90}, false},
+		{"", store.Point{}, true},
+		{"1", store.Point{}, true},
+		{"181,0", store.Point{}, true},
+		{"0,91", store.Point{}, true},
+		{"NaN,0", store.Point{}, true},
+		{"0,NaN", store.Point{}, true},
+		{"Inf,0", store.Point{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			got, err := parsePointParam(tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePointParam(%q) error = %v, wantErr %v", tt.val, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePointParam(%q) = %+v, want %+v", tt.val, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBBoxParam(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    store.BoundingBox
+		wantErr bool
+	}{
+		{"lonlat", "bbox=-115.3,36.0,-115.0,36.3", store.BoundingBox{MinLon: -115.3, MinLat: 36.0, MaxLon: -115.0, MaxLat: 36.3}, false},
+		{"latlon swapped", "bbox=36.0,-115.3,36.3,-115.0&coord_order=latlon", store.BoundingBox{MinLon: -115.3, MinLat: 36.0, MaxLon: -115.0, MaxLat: 36.3}, false},
+		{"latlon without coord_order", "bbox=36.0,-115.3,36.3,-115.0", store.BoundingBox{}, true},
+		{"unknown coord_order", "bbox=0,0,1,1&coord_order=xy", store.BoundingBox{}, true},
+		{"min above max", "bbox=2,0,1,1", store.BoundingBox{}, true},
+		{"NaN", "bbox=NaN,NaN,NaN,NaN", store.BoundingBox{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := getBBoxParam(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getBBoxParam(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getBBoxParam(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireFloatParam(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    float64
+		wantErr bool
+	}{
+		{"lat=36.1", 36.1, false},
+		{"lat=0", 0, false},
+		{"", 0, true},
+		{"lat=abc", 0, true},
+		{"lat=NaN", 0, true},
+		{"lat=-Inf", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := requireFloatParam(r, "lat")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requireFloatParam(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("requireFloatParam(%q) = %g, want %g", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFloatParam(t *testing.T) {
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"radius=25", 25},
+		{"", 100},
+		{"radius=abc", 100},
+		{"radius=NaN", 100},
+		{"radius=Inf", 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			if got := getFloatParam(r, "radius", 100); got != tt.want {
+				t.Errorf("getFloatParam(%q) = %g, want %g", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetListFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    store.ListFilter
+		wantErr bool
+	}{
+		{"empty", "", store.ListFilter{}, false},
+		{"folder and source", "folder=Videos&source=2017", store.ListFilter{Folder: "Videos", Source: "2017"}, false},
+		{"geometry types", "geometry_type=polygon,MultiPolygon", store.ListFilter{GeometryTypes: []string{"Polygon", "MultiPolygon"}}, false},
+		{"tolerance", "tolerance=0.001", store.ListFilter{Tolerance: 0.001}, false},
+		{"data", "data.camera=GoPro", store.ListFilter{Data: []store.KVPair{{Key: "camera", Value: "GoPro"}}}, false},
+		{"unknown geometry type", "geometry_type=Circle", store.ListFilter{}, true},
+		{"negative tolerance", "tolerance=-1", store.ListFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := getListFilter(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getListFilter(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getListFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTimeWindow(t *testing.T) {
+	at := func(s string) *time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &v
+	}
+	tests := []struct {
+		name    string
+		query   string
+		want    store.TimeWindow
+		wantErr bool
+	}{
+		{"open", "", store.TimeWindow{}, false},
+		{"date", "from=2017-10-01", store.TimeWindow{From: at("2017-10-01T00:00:00Z")}, false},
+		{"local time", "to=2017-10-01T21:41:56", store.TimeWindow{To: at("2017-10-01T21:41:56Z")}, false},
+		{"rfc 3339", "from=2017-10-01T00:00:00Z&to=2017-10-02T00:00:00%2B02:00", store.TimeWindow{From: at("2017-10-01T00:00:00Z"), To: at("2017-10-01T22:00:00Z")}, false},
+		{"same instant", "from=2017-10-01&to=2017-10-01", store.TimeWindow{From: at("2017-10-01T00:00:00Z"), To: at("2017-10-01T00:00:00Z")}, false},
+		{"reversed", "from=2017-10-02&to=2017-10-01", store.TimeWindow{}, true},
+		{"invalid", "from=yesterday", store.TimeWindow{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := getTimeWindow(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getTimeWindow(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			for _, b := range []struct {
+				name      string
+				got, want *time.Time
+			}{{"From", got.From, tt.want.From}, {"To", got.To, tt.want.To}} {
+				if (b.got == nil) != (b.want == nil) || (b.got != nil && !b.got.Equal(*b.want)) {
+					t.Errorf("%s = %v, want %v", b.name, b.got, b.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTimelineOrder(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantDesc bool
+		wantErr  bool
+	}{
+		{"", false, false},
+		{"order=asc", false, false},
+		{"order=desc", true, false},
+		{"order=DESC", false, true},
+		{"order=newest", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			desc, err := getTimelineOrder(r)
+			if (err != nil) != tt.wantErr || desc != tt.wantDesc {
+				t.Errorf("getTimelineOrder(%q) = %v, %v; want %v, error %v", tt.query, desc, err, tt.wantDesc, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetDataFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []store.KVPair
+		wantErr bool
+	}{
+		{"none", "folder=Videos", nil, false},
+		{"sorted by key", "data.year=2017&data.camera=GoPro", []store.KVPair{{Key: "camera", Value: "GoPro"}, {Key: "year", Value: "2017"}}, false},
+		{"repeated key", "data.tag=b&data.tag=a", []store.KVPair{{Key: "tag", Value: "a"}, {Key: "tag", Value: "b"}}, false},
+		{"empty value", "data.note=", []store.KVPair{{Key: "note", Value: ""}}, false},
+		{"empty key", "data.=x", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			got, err := getDataFilters(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getDataFilters(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDataFilters(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
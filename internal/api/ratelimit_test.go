@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2017, 10, 1, 22, 0, 0, 0, time.UTC)
+
+	type step struct {
+		key      string
+		at       time.Duration // after start
+		want     bool
+		wantWait time.Duration
+	}
+	tests := []struct {
+		name  string
+		rps   float64
+		burst int
+		steps []step
+	}{
+		{"burst then limited", 1, 2, []step{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+			{"a", 0, false, time.Second},
+		}},
+		{"refills over time", 2, 1, []step{
+			{"a", 0, true, 0},
+			{"a", 100 * time.Millisecond, false, 400 * time.Millisecond},
+			{"a", 500 * time.Millisecond, true, 0},
+		}},
+		{"refill capped at burst", 10, 2, []step{
+			{"a", 0, true, 0},
+			{"a", time.Hour, true, 0},
+			{"a", time.Hour, true, 0},
+			{"a", time.Hour, false, 100 * time.Millisecond},
+		}},
+		{"keys are independent", 1, 1, []step{
+			{"a", 0, true, 0},
+			{"a", 0, false, time.Second},
+			{"b", 0, true, 0},
+		}},
+		{"burst below one is one", 1, 0, []step{
+			{"a", 0, true, 0},
+			{"a", 0, false, time.Second},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.rps, tt.burst)
+			for i, s := range tt.steps {
+				ok, wait := l.allow(s.key, start.Add(s.at))
+				if ok != s.want {
+					t.Fatalf("step %d: allow = %v, want %v", i, ok, s.want)
+				}
+				if diff := wait - s.wantWait; diff < -time.Millisecond || diff > time.Millisecond {
+					t.Errorf("step %d: wait = %s, want %s", i, wait, s.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterHandler(t *testing.T) {
+	l := NewRateLimiter(0.5, 1)
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/v1/placemarks", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("203.0.113.9:4000"); w.Code != http.StatusNoContent {
+		t.Fatalf("first request status = %d, want 204", w.Code)
+	}
+	w := request("203.0.113.9:4001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if w := request("198.51.100.1:4000"); w.Code != http.StatusNoContent {
+		t.Errorf("other client status = %d, want 204", w.Code)
+	}
+}
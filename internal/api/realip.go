@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma-separated list of proxy addresses and
+// CIDR ranges, such as "10.0.0.0/8, 127.0.0.1". An empty list trusts no one.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// RealIP replaces r.RemoteAddr with the client address a trusted proxy
+// forwarded, so the rate limiter and request log see the real client. Only
+// requests arriving from one of trusted are rewritten; X-Forwarded-For is
+// read right to left, skipping trusted hops, so a client cannot choose its
+// address by prepending entries, and X-Real-IP is the fallback. With no
+// trusted proxies the headers are ignored.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := forwardedIP(r, trusted); ip != "" {
+				r.RemoteAddr = ip
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP is the client address carried by r's forwarding headers, or ""
+// when r did not come from a trusted proxy or names no usable address.
+func forwardedIP(r *http.Request, trusted []netip.Prefix) string {
+	peer, ok := parseIP(clientIP(r))
+	if !ok || !isTrusted(peer, trusted) {
+		return ""
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseIP(hops[i])
+		if !ok {
+			break
+		}
+		if !isTrusted(addr, trusted) {
+			return addr.String()
+		}
+	}
+	if addr, ok := parseIP(r.Header.Get("X-Real-IP")); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses an address from a header or RemoteAddr, with or without a
+// port, mapping IPv4-in-IPv6 back to IPv4.
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"10.0.0.0/8", []string{"10.0.0.0/8"}, false},
+		{" 127.0.0.1 , 10.1.2.3/8 ", []string{"127.0.0.1/32", "10.0.0.0/8"}, false},
+		{"::1", []string{"::1/128"}, false},
+		{"proxy.internal", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTrustedProxies(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTrustedProxies(%q) = %v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTrustedProxies(%q): %v", tt.input, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseTrustedProxies(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("prefix %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"no proxies configured", false, "203.0.113.9:4000", []string{"198.51.100.1"}, "", "203.0.113.9"},
+		{"untrusted peer", true, "203.0.113.9:4000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.9"},
+		{"trusted peer", true, "10.0.0.5:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed prefix", true, "10.0.0.5:4000", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chained proxies", true, "10.0.0.5:4000", []string{"198.51.100.1, 10.0.0.7"}, "", "198.51.100.1"},
+		{"repeated header", true, "10.0.0.5:4000", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"garbage hop", true, "10.0.0.5:4000", []string{"198.51.100.1, nonsense"}, "", "10.0.0.5"},
+		{"x-real-ip fallback", true, "10.0.0.5:4000", nil, "198.51.100.2", "198.51.100.2"},
+		{"no headers", true, "10.0.0.5:4000", nil, "", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+			var got string
+			h := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			r := httptest.NewRequest("GET", "/api/v1/placemarks", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
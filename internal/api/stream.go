@@ -0,0 +1,458 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+	"github.com/onnwee/mandalay/internal/sanitize"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+// exportFlushEvery is how many rows streaming exports write between flushes.
+const exportFlushEvery = 500
+
+// Columns written by the CSV export. timestamp_source says whether the
+// timestamp was stored at import ("column") or parsed from the name
+// ("name").
+var csvExportColumns = []string{
+	"id", "name", "description", "folder_path", "geometry_type",
+	"source", "timestamp", "timestamp_source", "created_at", "geometry",
+}
+
+// Columns written by the CSV placemark list. lon and lat are the centroid
+// for non-point geometries.
+var csvListColumns = []string{
+	"id", "name", "description", "geometry_type", "lon", "lat", "folder_path", "media_links",
+}
+
+// flushingWriter flushes the response every exportFlushEvery rows so data
+// reaches the client while the query is still running.
+type flushingWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	rows    int
+}
+
+func newFlushingWriter(w http.ResponseWriter) *flushingWriter {
+	flusher, _ := w.(http.Flusher)
+	return &flushingWriter{w: w, flusher: flusher}
+}
+
+// rowWritten counts a row, flushing periodically. flushBuffered, if not nil,
+// empties the caller's own buffer first.
+func (f *flushingWriter) rowWritten(flushBuffered func()) {
+	f.rows++
+	if f.flusher != nil && f.rows%exportFlushEvery == 0 {
+		if flushBuffered != nil {
+			flushBuffered()
+		}
+		f.flusher.Flush()
+	}
+}
+
+// jsonStream writes a JSON document with one array streamed element by
+// element: prefix, the elements separated by commas, then the closing that
+// finish is given. Nothing is sent before the first element, so a failure
+// until then can still get an error response.
+type jsonStream struct {
+	w           http.ResponseWriter
+	contentType string
+	prefix      string
+	out         *flushingWriter
+	enc         *json.Encoder
+	started     bool
+}
+
+func newJSONStream(w http.ResponseWriter, contentType, prefix string) *jsonStream {
+	return &jsonStream{w: w, contentType: contentType, prefix: prefix, out: newFlushingWriter(w), enc: json.NewEncoder(w)}
+}
+
+func (s *jsonStream) start() error {
+	s.started = true
+	s.w.Header().Set("Content-Type", s.contentType)
+	_, err := io.WriteString(s.w, s.prefix)
+	return err
+}
+
+// element appends v to the array.
+func (s *jsonStream) element(v interface{}) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	} else if _, err := io.WriteString(s.w, ","); err != nil {
+		return err
+	}
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	s.out.rowWritten(nil)
+	return nil
+}
+
+// finish closes the array and writes closing, which ends the document.
+func (s *jsonStream) finish(closing string) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(s.w, closing)
+	return err
+}
+
+// fail reports err: as an error response when nothing has been sent yet,
+// otherwise by logging it and leaving the client a truncated body.
+func (s *jsonStream) fail(r *http.Request, err error) {
+	if !s.started {
+		respondError(s.w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logExportError(r, s.out.rows, err)
+}
+
+// exportPreamble parses the shared export parameters and writes headers.
+// It reports false after responding with an error.
+func exportPreamble(w http.ResponseWriter, r *http.Request, contentType, filename string) (string, sanitize.Mode, bool) {
+	mode, err := getDescriptionMode(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return "", "", false
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	return r.URL.Query().Get("folder"), mode, true
+}
+
+// logExportError records a failure after the response has started; headers
+// are already sent so the client sees a truncated body.
+func logExportError(r *http.Request, rows int, err error) {
+	if err != nil {
+		log.Printf("%s aborted after %d rows: %v", r.URL.Path, rows, err)
+	}
+}
+
+// exportWindow reads the exports' from and to parameters, as for the
+// timeline. It reports false after responding with an error.
+func exportWindow(w http.ResponseWriter, r *http.Request) (store.TimeWindow, bool) {
+	window, err := getTimeWindow(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return store.TimeWindow{}, false
+	}
+	return window, true
+}
+
+func (h *Handlers) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	window, ok := exportWindow(w, r)
+	if !ok {
+		return
+	}
+	folder, mode, ok := exportPreamble(w, r, "text/csv; charset=utf-8", "placemarks.csv")
+	if !ok {
+		return
+	}
+
+	out := newFlushingWriter(w)
+	cw := csv.NewWriter(w)
+	cw.Write(csvExportColumns)
+
+	err := h.placemarkStore.EachPlacemark(r.Context(), folder, window, func(p *store.Placemark) error {
+		var source, timestamp string
+		if p.Source != nil {
+			source = *p.Source
+		}
+		if p.Timestamp != nil {
+			timestamp = p.Timestamp.Format(time.RFC3339)
+		}
+		if err := cw.Write([]string{
+			strconv.Itoa(p.ID),
+			p.Name,
+			sanitize.ApplyFormat(mode, p.DescriptionFormat, p.Description),
+			strings.Join(p.FolderPath, store.FolderPathSeparator),
+			p.GeometryType,
+			source,
+			timestamp,
+			p.TimestampSource,
+			p.CreatedAt.Format(time.RFC3339),
+			p.Geometry,
+		}); err != nil {
+			return err
+		}
+		out.rowWritten(cw.Flush)
+		return nil
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	logExportError(r, out.rows, err)
+}
+
+// ListPlacemarksCSV streams the placemark list as a spreadsheet-friendly
+// CSV with one location per row, honoring the list endpoint's filters.
+func (h *Handlers) ListPlacemarksCSV(w http.ResponseWriter, r *http.Request) {
+	filter, err := getListFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	_, mode, ok := exportPreamble(w, r, "text/csv; charset=utf-8", "placemarks.csv")
+	if !ok {
+		return
+	}
+
+	out := newFlushingWriter(w)
+	cw := csv.NewWriter(w)
+	cw.Write(csvListColumns)
+
+	err = h.placemarkStore.EachPlacemarkRow(r.Context(), filter, func(p *store.PlacemarkRow) error {
+		var lon, lat string
+		if p.Centroid != nil {
+			lon = strconv.FormatFloat(p.Centroid.Lon, 'f', -1, 64)
+			lat = strconv.FormatFloat(p.Centroid.Lat, 'f', -1, 64)
+		}
+		if err := cw.Write([]string{
+			strconv.Itoa(p.ID),
+			p.Name,
+			sanitize.ApplyFormat(mode, p.DescriptionFormat, p.Description),
+			p.GeometryType,
+			lon,
+			lat,
+			strings.Join(p.FolderPath, store.FolderPathSeparator),
+			strconv.Itoa(p.MediaLinks),
+		}); err != nil {
+			return err
+		}
+		out.rowWritten(cw.Flush)
+		return nil
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	logExportError(r, out.rows, err)
+}
+
+func (h *Handlers) ExportGeoJSON(w http.ResponseWriter, r *http.Request) {
+	window, ok := exportWindow(w, r)
+	if !ok {
+		return
+	}
+	folder, mode, ok := exportPreamble(w, r, "application/geo+json", "placemarks.geojson")
+	if !ok {
+		return
+	}
+
+	// The FeatureCollection is assembled by hand so features can be written
+	// one at a time.
+	out := newFlushingWriter(w)
+	if _, err := w.Write([]byte(`{"type":"FeatureCollection","features":[`)); err != nil {
+		return
+	}
+
+	err := h.placemarkStore.EachPlacemark(r.Context(), folder, window, func(p *store.Placemark) error {
+		data, err := json.Marshal(placemarkFeature(p, mode))
+		if err != nil {
+			return err
+		}
+		if out.rows > 0 {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		out.rowWritten(nil)
+		return nil
+	})
+	if err == nil {
+		_, err = w.Write([]byte("]}\n"))
+	}
+	logExportError(r, out.rows, err)
+}
+
+func (h *Handlers) ExportNDJSON(w http.ResponseWriter, r *http.Request) {
+	window, ok := exportWindow(w, r)
+	if !ok {
+		return
+	}
+	folder, mode, ok := exportPreamble(w, r, "application/x-ndjson", "placemarks.ndjson")
+	if !ok {
+		return
+	}
+
+	out := newFlushingWriter(w)
+	encoder := json.NewEncoder(w)
+
+	err := h.placemarkStore.EachPlacemark(r.Context(), folder, window, func(p *store.Placemark) error {
+		if err := encoder.Encode(placemarkFeature(p, mode)); err != nil {
+			return err
+		}
+		out.rowWritten(nil)
+		return nil
+	})
+	logExportError(r, out.rows, err)
+}
+
+// ExportKML streams placemarks as a KML document for Google Earth, with
+// styles, folders rebuilt from folder_path, and extended data. Descriptions
+// are written as stored.
+func (h *Handlers) ExportKML(w http.ResponseWriter, r *http.Request) {
+	window, ok := exportWindow(w, r)
+	if !ok {
+		return
+	}
+	styles, err := h.placemarkStore.ListStyles(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	folder := r.URL.Query().Get("folder")
+
+	w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="placemarks.kml"`)
+
+	out := newFlushingWriter(w)
+	kw, err := kml.NewWriter(w, "Mandalay export")
+	if err != nil {
+		logExportError(r, 0, err)
+		return
+	}
+	for _, s := range styles {
+		if err := kw.WriteStyle(kmlStyle(s)); err != nil {
+			logExportError(r, 0, err)
+			return
+		}
+	}
+
+	err = h.placemarkStore.EachPlacemarkWithData(r.Context(), folder, window, func(p *store.Placemark) error {
+		pm, err := kmlPlacemark(p)
+		if err != nil {
+			log.Printf("%s: skipping placemark %d: %v", r.URL.Path, p.ID, err)
+			return nil
+		}
+		if err := kw.WritePlacemark(p.FolderPath, pm); err != nil {
+			return err
+		}
+		out.rowWritten(nil)
+		return nil
+	})
+	if err == nil {
+		err = kw.Close()
+	}
+	logExportError(r, out.rows, err)
+}
+
+func kmlPlacemark(p *store.Placemark) (kml.Placemark, error) {
+	pm := kml.Placemark{
+		Name:        p.Name,
+		Description: p.Description,
+	}
+	if err := pm.SetGeoJSON([]byte(p.Geometry)); err != nil {
+		return pm, err
+	}
+	if p.StyleID != nil {
+		pm.StyleURL = "#" + *p.StyleID
+	}
+
+	switch {
+	case p.EndTimestamp != nil:
+		pm.TimeSpan = &kml.TimeSpan{End: p.EndTimestamp.Format(time.RFC3339)}
+		if p.Timestamp != nil {
+			pm.TimeSpan.Begin = p.Timestamp.Format(time.RFC3339)
+		}
+	case p.Timestamp != nil:
+		pm.TimeStamp = &kml.TimeStamp{When: p.Timestamp.Format(time.RFC3339)}
+	}
+
+	var data []kml.Data
+	for _, link := range p.MediaLinks {
+		data = append(data, kml.Data{Name: "gx_media_links", Value: link})
+	}
+	for _, kv := range p.ExtendedData {
+		data = append(data, kml.Data{Name: kv.Key, Value: kv.Value})
+	}
+	if len(data) > 0 {
+		pm.ExtendedData = &kml.ExtendedData{Data: data}
+	}
+	return pm, nil
+}
+
+func kmlStyle(s store.Style) kml.Style {
+	style := kml.Style{ID: s.ID}
+	if s.IconHref != nil || s.IconScale != nil {
+		style.IconStyle = &kml.IconStyle{}
+		if s.IconHref != nil {
+			style.IconStyle.Icon = &kml.Icon{Href: *s.IconHref}
+		}
+		if s.IconScale != nil {
+			style.IconStyle.Scale = *s.IconScale
+		}
+	}
+	if s.LabelColor != nil || s.LabelScale != nil {
+		style.LabelStyle = &kml.LabelStyle{Color: kmlColor(s.LabelColor)}
+		if s.LabelScale != nil {
+			style.LabelStyle.Scale = *s.LabelScale
+		}
+	}
+	if s.LineColor != nil || s.LineWidth != nil {
+		style.LineStyle = &kml.LineStyle{Color: kmlColor(s.LineColor)}
+		if s.LineWidth != nil {
+			style.LineStyle.Width = *s.LineWidth
+		}
+	}
+	if s.PolyColor != nil {
+		style.PolyStyle = &kml.PolyStyle{Color: kmlColor(s.PolyColor)}
+	}
+	return style
+}
+
+// kmlColor converts a web color back to KML's aabbggrr, or "" for nil.
+func kmlColor(c *store.Color) string {
+	if c == nil || len(c.Hex) != 7 {
+		return ""
+	}
+	rr, gg, bb := c.Hex[1:3], c.Hex[3:5], c.Hex[5:7]
+	return fmt.Sprintf("%02x", int(math.Round(c.Opacity*255))) + bb + gg + rr
+}
+
+// placemarkFeature converts a placemark to a GeoJSON feature for export.
+func placemarkFeature(p *store.Placemark, mode sanitize.Mode) geoJSONFeature {
+	var timestamp, timestampSource interface{}
+	if p.Timestamp != nil {
+		timestamp, timestampSource = p.Timestamp.Format(time.RFC3339), p.TimestampSource
+	}
+
+	return geoJSONFeature{
+		Type:     "Feature",
+		Geometry: json.RawMessage(p.Geometry),
+		Properties: map[string]interface{}{
+			"id":                 p.ID,
+			"name":               p.Name,
+			"description":        sanitize.ApplyFormat(mode, p.DescriptionFormat, p.Description),
+			"description_format": p.DescriptionFormat,
+			"style_id":           p.StyleID,
+			"folder_path":        p.FolderPath,
+			"geometry_type":      p.GeometryType,
+			"media_links":        p.MediaLinks,
+			"thumbnail_url":      p.ThumbnailURL,
+			"source":             p.Source,
+			"timestamp":          timestamp,
+			"timestamp_source":   timestampSource,
+			"created_at":         p.CreatedAt,
+			"updated_at":         p.UpdatedAt,
+		},
+	}
+}
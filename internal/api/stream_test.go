@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/onnwee/mandalay/internal/kml"
+	"github.com/onnwee/mandalay/internal/store"
+)
+
+// TestKMLExportRoundTrip writes placemarks as ExportKML does and imports the
+// document again, checking nothing is lost on the way.
+func TestKMLExportRoundTrip(t *testing.T) {
+	styleID := "icon-1"
+	when := time.Date(2017, 10, 1, 21, 41, 56, 0, time.UTC)
+	placemarks := []store.Placemark{
+		{
+			ID: 1, Name: "Gate C", Description: "<p>Main entrance</p>", StyleID: &styleID,
+			FolderPath:   []string{"Venues"},
+			Geometry:     `{"type":"Point","coordinates":[-115.172,36.094]}`,
+			MediaLinks:   []string{"https://youtube.com/watch?v=1"},
+			Timestamp:    &when,
+			ExtendedData: []store.KVPair{{Key: "camera", Value: "GoPro"}},
+		},
+		{
+			ID: 2, Name: "Route", FolderPath: []string{"Venues", "Paths"},
+			Geometry: `{"type":"LineString","coordinates":[[-115.17,36.09],[-115.16,36.1]]}`,
+		},
+		{
+			ID: 3, Name: "Lot", FolderPath: []string{"Parking"},
+			Geometry: `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`,
+		},
+		{
+			ID: 4, Name: "Pair", Geometry: `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`,
+		},
+	}
+
+	var buf bytes.Buffer
+	kw, err := kml.NewWriter(&buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kw.WriteStyle(kml.Style{ID: styleID}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range placemarks {
+		pm, err := kmlPlacemark(&placemarks[i])
+		if err != nil {
+			t.Fatalf("kmlPlacemark(%s): %v", placemarks[i].Name, err)
+		}
+		if err := kw.WritePlacemark(placemarks[i].FolderPath, pm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := kml.Parse(context.Background(), buf.Bytes(), kml.Options{})
+	if err != nil {
+		t.Fatalf("re-importing the export: %v\n%s", err, buf.String())
+	}
+	if len(result.Placemarks) != len(placemarks) || len(result.Skipped) != 0 {
+		t.Fatalf("re-imported %d placemarks (%d skipped), want %d", len(result.Placemarks), len(result.Skipped), len(placemarks))
+	}
+	if len(result.Styles) != 1 || result.Styles[0].ID != styleID {
+		t.Errorf("styles = %+v, want %s", result.Styles, styleID)
+	}
+
+	wantTypes := []string{"Point", "LineString", "Polygon", "MultiPoint"}
+	for i, got := range result.Placemarks {
+		want := placemarks[i]
+		if got.Name != want.Name || got.Description != want.Description {
+			t.Errorf("placemark %d = %q/%q, want %q/%q", i, got.Name, got.Description, want.Name, want.Description)
+		}
+		if !slices.Equal(got.FolderPath, want.FolderPath) {
+			t.Errorf("%s folder path = %q, want %q", want.Name, got.FolderPath, want.FolderPath)
+		}
+		if got.GeometryType != wantTypes[i] {
+			t.Errorf("%s geometry type = %s, want %s", want.Name, got.GeometryType, wantTypes[i])
+		}
+		if !slices.Equal(got.MediaLinks, want.MediaLinks) {
+			t.Errorf("%s media links = %q, want %q", want.Name, got.MediaLinks, want.MediaLinks)
+		}
+		for _, kv := range want.ExtendedData {
+			if got.ExtendedData[kv.Key] != kv.Value {
+				t.Errorf("%s extended data %s = %q, want %q", want.Name, kv.Key, got.ExtendedData[kv.Key], kv.Value)
+			}
+		}
+	}
+
+	first := result.Placemarks[0]
+	if first.StyleID != styleID {
+		t.Errorf("style = %q, want %q", first.StyleID, styleID)
+	}
+	if first.TimeBegin == nil || !first.TimeBegin.Equal(when) {
+		t.Errorf("time = %v, want %v", first.TimeBegin, when)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// maxValidateUploadBytes caps the KML/KMZ upload accepted by ValidateKML.
+const maxValidateUploadBytes = 32 << 20
+
+// validationReport mirrors the importer's dry-run summary.
+type validationReport struct {
+	Styles             int                    `json:"styles"`
+	Placemarks         int                    `json:"placemarks"`
+	GeometryTypes      map[string]int         `json:"geometry_types"`
+	Unnamed            int                    `json:"unnamed"`
+	SkippedCounts      map[kml.SkipReason]int `json:"skipped_counts"`
+	Skipped            []kml.SkippedPlacemark `json:"skipped"`
+	UnresolvedStyles   []string               `json:"unresolved_styles"`
+	InvalidCoordinates int                    `json:"invalid_coordinates"`
+	Warnings           []kml.Warning          `json:"warnings"`
+}
+
+// ValidateKML parses an uploaded KML or KMZ file the way the importer's
+// -dry-run does and reports what would be imported, without touching the
+// database. The file is the request body, or the "file" field of a
+// multipart form.
+func (h *Handlers) ValidateKML(w http.ResponseWriter, r *http.Request) {
+	unnamed := r.URL.Query().Get("unnamed")
+	if unnamed == "" {
+		unnamed = kml.UnnamedKeep
+	}
+	if !kml.ValidUnnamedMode(unnamed) {
+		respondError(w, http.StatusBadRequest, "unnamed must be one of keep, skip, synthesize, or coords")
+		return
+	}
+	opts := kml.Options{
+		DecimalComma: r.URL.Query().Get("decimal_comma") == "true",
+		Altitude:     r.URL.Query().Get("altitude") == "true",
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxValidateUploadBytes)
+	data, err := readUpload(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d bytes", maxValidateUploadBytes))
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) == 0 {
+		respondError(w, http.StatusBadRequest, "empty upload")
+		return
+	}
+
+	parsed, err := kml.Parse(r.Context(), data, opts)
+	if err != nil {
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	placemarks, unnamedCount, unnamedSkipped := kml.ApplyUnnamedPolicy(parsed.Placemarks, unnamed, opts)
+	skipped := append(parsed.Skipped, unnamedSkipped...)
+
+	report := validationReport{
+		Styles:             len(parsed.Styles),
+		Placemarks:         len(placemarks),
+		GeometryTypes:      make(map[string]int),
+		Unnamed:            unnamedCount,
+		SkippedCounts:      kml.TallySkips(skipped),
+		Skipped:            skipped,
+		UnresolvedStyles:   parsed.UnresolvedStyles(),
+		InvalidCoordinates: parsed.InvalidCoordinates,
+		Warnings:           parsed.Warnings,
+	}
+	for _, pm := range placemarks {
+		report.GeometryTypes[pm.GeometryType]++
+	}
+	if report.Skipped == nil {
+		report.Skipped = []kml.SkippedPlacemark{}
+	}
+	if report.UnresolvedStyles == nil {
+		report.UnresolvedStyles = []string{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []kml.Warning{}
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+func readUpload(r *http.Request) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("missing file field: %w", err)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,130 @@
+// Package cache provides a small concurrency-safe LRU cache.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats reports cache usage counters.
+type Stats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
+
+// LRU is a fixed-capacity cache that evicts the least recently used entry.
+// With a TTL, entries also expire that long after they were added.
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[K]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// NewLRU creates a cache holding at most capacity entries.
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// NewLRUWithTTL is NewLRU with entries that expire ttl after being added.
+// A ttl of zero or less never expires them.
+func NewLRUWithTTL[K comparable, V any](capacity int, ttl time.Duration) *LRU[K, V] {
+	c := NewLRU[K, V](capacity)
+	c.ttl = ttl
+	return c
+}
+
+// Get returns the cached value for key and marks it as recently used.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if c.ttl <= 0 || time.Now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.hits++
+			return e.value, true
+		}
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+
+	c.misses++
+	var zero V
+	return zero, false
+}
+
+// Add stores value under key, evicting the oldest entry when full.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Remove drops key from the cache if present.
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Purge drops every entry. Counters are preserved.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Size:     c.ll.Len(),
+		Capacity: c.capacity,
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[int, string](2)
+	c.Add(1, "one")
+	c.Add(2, "two")
+	c.Get(1) // 2 is now the oldest
+	c.Add(3, "three")
+
+	tests := []struct {
+		key  int
+		want string
+		ok   bool
+	}{
+		{1, "one", true},
+		{2, "", false},
+		{3, "three", true},
+	}
+	for _, tt := range tests {
+		if got, ok := c.Get(tt.key); got != tt.want || ok != tt.ok {
+			t.Errorf("Get(%d) = %q, %v; want %q, %v", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	stats := c.Stats()
+	want := Stats{Hits: 3, Misses: 1, Size: 2, Capacity: 2}
+	if stats != want {
+		t.Errorf("Stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestLRUAddReplaces(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("a", 10) // refreshes a, so b is evicted next
+	c.Add("c", 3)
+
+	if got, ok := c.Get("a"); !ok || got != 10 {
+		t.Errorf("Get(a) = %d, %v; want 10, true", got, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("b survived eviction")
+	}
+}
+
+func TestLRURemoveAndPurge(t *testing.T) {
+	c := NewLRU[int, int](4)
+	for i := range 3 {
+		c.Add(i, i)
+	}
+	c.Remove(1)
+	c.Remove(99)
+	if _, ok := c.Get(1); ok {
+		t.Error("Get(1) found a removed entry")
+	}
+	if size := c.Stats().Size; size != 2 {
+		t.Errorf("Size after Remove = %d, want 2", size)
+	}
+
+	c.Purge()
+	stats := c.Stats()
+	if stats.Size != 0 {
+		t.Errorf("Size after Purge = %d, want 0", stats.Size)
+	}
+	if stats.Misses != 1 {
+		t.Errorf("Purge reset the counters: %+v", stats)
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		wait   time.Duration
+		wantOK bool
+	}{
+		{"fresh", ttl, 0, true},
+		{"expired", ttl, 2 * ttl, false},
+		{"no ttl", 0, 2 * ttl, true},
+		{"negative ttl", -time.Second, 2 * ttl, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLRUWithTTL[int, string](4, tt.ttl)
+			c.Add(1, "one")
+			time.Sleep(tt.wait)
+
+			_, ok := c.Get(1)
+			if ok != tt.wantOK {
+				t.Fatalf("Get after %s = %v, want %v", tt.wait, ok, tt.wantOK)
+			}
+			size := c.Stats().Size
+			if !ok && size != 0 {
+				t.Errorf("expired entry still counted: Size = %d", size)
+			}
+		})
+	}
+}
+
+func TestLRUAddRestartsTTL(t *testing.T) {
+	const ttl = 40 * time.Millisecond
+	c := NewLRUWithTTL[int, string](4, ttl)
+	c.Add(1, "one")
+	time.Sleep(ttl / 2)
+	c.Add(1, "uno")
+	time.Sleep(ttl * 3 / 4)
+
+	if got, ok := c.Get(1); !ok || got != "uno" {
+		t.Errorf("Get(1) = %q, %v; want the re-added value", got, ok)
+	}
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Value holds a single computed value for a limited time.
+type Value[T any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	value   T
+	expires time.Time
+	set     bool
+}
+
+// NewValue creates an empty holder whose values expire after ttl.
+func NewValue[T any](ttl time.Duration) *Value[T] {
+	return &Value[T]{ttl: ttl}
+}
+
+// Get returns the held value if it was set and has not expired.
+func (v *Value[T]) Get() (T, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.set || time.Now().After(v.expires) {
+		var zero T
+		return zero, false
+	}
+	return v.value, true
+}
+
+// Set stores value and restarts the expiry timer.
+func (v *Value[T]) Set(value T) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.value = value
+	v.expires = time.Now().Add(v.ttl)
+	v.set = true
+}
+
+// Clear drops the held value.
+func (v *Value[T]) Clear() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var zero T
+	v.value = zero
+	v.set = false
+}
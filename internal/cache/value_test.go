@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValue(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	v := NewValue[int](ttl)
+
+	if _, ok := v.Get(); ok {
+		t.Fatal("Get on an empty Value succeeded")
+	}
+	v.Set(7)
+	if got, ok := v.Get(); !ok || got != 7 {
+		t.Fatalf("Get = %d, %v; want 7, true", got, ok)
+	}
+	time.Sleep(2 * ttl)
+	if _, ok := v.Get(); ok {
+		t.Error("Get returned an expired value")
+	}
+
+	v.Set(8)
+	v.Clear()
+	if _, ok := v.Get(); ok {
+		t.Error("Get returned a cleared value")
+	}
+}
@@ -0,0 +1,310 @@
+// Package kml parses KML and KMZ documents into placemark records ready for
+// import, reporting placemarks that cannot be imported and why, and writes
+// KML for export.
+package kml
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// KML element structures, shared by the decoder and Writer. Documents and
+// Folders are walked by the streaming decoder rather than unmarshalled, so
+// only their contents appear here.
+type Style struct {
+	ID         string      `xml:"id,attr"`
+	IconStyle  *IconStyle  `xml:"IconStyle"`
+	LabelStyle *LabelStyle `xml:"LabelStyle"`
+	LineStyle  *LineStyle  `xml:"LineStyle"`
+	PolyStyle  *PolyStyle  `xml:"PolyStyle"`
+}
+
+type StyleMap struct {
+	ID    string         `xml:"id,attr"`
+	Pairs []StyleMapPair `xml:"Pair"`
+}
+
+type StyleMapPair struct {
+	Key      string `xml:"key"`
+	StyleURL string `xml:"styleUrl,omitempty"`
+}
+
+type IconStyle struct {
+	Scale float64 `xml:"scale,omitempty"`
+	Icon  *Icon   `xml:"Icon"`
+}
+
+type Icon struct {
+	Href string `xml:"href,omitempty"`
+}
+
+type LabelStyle struct {
+	Color string  `xml:"color,omitempty"`
+	Scale float64 `xml:"scale,omitempty"`
+}
+
+type LineStyle struct {
+	Color string  `xml:"color,omitempty"`
+	Width float64 `xml:"width,omitempty"`
+}
+
+type PolyStyle struct {
+	Color string `xml:"color,omitempty"`
+}
+
+type Placemark struct {
+	Name          string         `xml:"name,omitempty"`
+	Description   string         `xml:"description,omitempty"`
+	StyleURL      string         `xml:"styleUrl,omitempty"`
+	Point         *Point         `xml:"Point"`
+	LineString    *LineString    `xml:"LineString"`
+	Polygon       *Polygon       `xml:"Polygon"`
+	MultiGeometry *MultiGeometry `xml:"MultiGeometry"`
+	Track         *Track         `xml:"Track"`
+	TimeStamp     *TimeStamp     `xml:"TimeStamp"`
+	TimeSpan      *TimeSpan      `xml:"TimeSpan"`
+	ExtendedData  *ExtendedData  `xml:"ExtendedData"`
+}
+
+// TimeStamp is a KML point in time; When is an XML Schema dateTime, date,
+// gYearMonth, or gYear.
+type TimeStamp struct {
+	When string `xml:"when,omitempty"`
+}
+
+// TimeSpan is a KML time range. Either end may be omitted.
+type TimeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type Point struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type LineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type Polygon struct {
+	OuterBoundary OuterBoundary   `xml:"outerBoundaryIs"`
+	InnerBoundary []InnerBoundary `xml:"innerBoundaryIs"`
+}
+
+// Track is a Google Earth <gx:Track>: positions with an optional time for
+// each, as parallel <when> and <gx:coord> lists. A gx:coord is
+// space-separated "lon lat alt". Tags are matched without a namespace so
+// files that use the gx prefix without declaring it still parse.
+type Track struct {
+	When   []string `xml:"when"`
+	Coords []string `xml:"coord"`
+}
+
+// CoordinatesText rewrites the track's positions as KML coordinate text.
+func (t *Track) CoordinatesText() string {
+	tuples := make([]string, 0, len(t.Coords))
+	for _, c := range t.Coords {
+		if fields := strings.Fields(c); len(fields) > 0 {
+			tuples = append(tuples, strings.Join(fields, ","))
+		}
+	}
+	return strings.Join(tuples, " ")
+}
+
+// MultiGeometry groups several geometries under one placemark. Nested
+// MultiGeometry elements are flattened into their parent.
+type MultiGeometry struct {
+	Points          []Point         `xml:"Point"`
+	LineStrings     []LineString    `xml:"LineString"`
+	Polygons        []Polygon       `xml:"Polygon"`
+	MultiGeometries []MultiGeometry `xml:"MultiGeometry"`
+}
+
+type OuterBoundary struct {
+	LinearRing LinearRing `xml:"LinearRing"`
+}
+
+type InnerBoundary struct {
+	LinearRing LinearRing `xml:"LinearRing"`
+}
+
+type LinearRing struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type ExtendedData struct {
+	Data []Data `xml:"Data"`
+}
+
+type Data struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// PlacemarkRecord is a parsed placemark ready to be inserted.
+type PlacemarkRecord struct {
+	Name           string
+	Description    string
+	StyleID        string
+	FolderPath     []string
+	GeometryType   string
+	GeomWKT        string
+	CoordinatesRaw string
+	MediaLinks     []string
+	ExtendedData   map[string]string
+	// TimeBegin and TimeEnd come from <TimeStamp> (begin only) or
+	// <TimeSpan>.
+	TimeBegin *time.Time
+	TimeEnd   *time.Time
+	// TrackTimes holds a gx:Track's <when> values, one per vertex, when the
+	// track had a usable time for every position.
+	TrackTimes []time.Time
+}
+
+// Namespaces accepted on the <kml> root element. Documents without a
+// namespace are tolerated since many hand-written files omit it.
+var kmlNamespaces = map[string]bool{
+	"":                                true,
+	"http://www.opengis.net/kml/2.2":  true,
+	"http://earth.google.com/kml/2.0": true,
+	"http://earth.google.com/kml/2.1": true,
+	"http://earth.google.com/kml/2.2": true,
+}
+
+// checkRoot verifies that the document's root element is <kml> in a KML
+// namespace, so other XML files fail loudly instead of importing nothing.
+func checkRoot(start xml.StartElement) error {
+	if start.Name.Local != "kml" {
+		return fmt.Errorf("not a KML file: root element is <%s>, expected <kml>", start.Name.Local)
+	}
+	if !kmlNamespaces[start.Name.Space] {
+		return fmt.Errorf("not a KML file: root element <kml> has unexpected namespace %q", start.Name.Space)
+	}
+	return nil
+}
+
+// zipMagic starts every zip archive, and so every KMZ file.
+var zipMagic = []byte("PK\x03\x04")
+
+// document is an opened KML stream. For a KMZ archive, dir is the main
+// document's directory within the archive and assets lists the archive's
+// other files, so relative hrefs in the document can be resolved to them.
+type document struct {
+	io.ReadCloser
+	kmz    bool
+	dir    string
+	assets []string
+}
+
+// openFile opens a KML file, or the main document of a KMZ file, for
+// streaming.
+func openFile(name string) (*document, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KML file: %w", err)
+	}
+
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(len(zipMagic)); !bytes.Equal(magic, zipMagic) {
+		return &document{ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{br, f}}, nil
+	}
+	f.Close()
+
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open KMZ archive: %w", err)
+	}
+	doc, err := openMainEntry(&zr.Reader)
+	if err != nil {
+		zr.Close()
+		return nil, err
+	}
+	doc.ReadCloser = struct {
+		io.Reader
+		io.Closer
+	}{doc.ReadCloser, closers{doc.ReadCloser, zr}}
+	return doc, nil
+}
+
+// openBytes is openFile for an in-memory document.
+func openBytes(data []byte) (*document, error) {
+	if !bytes.HasPrefix(data, zipMagic) {
+		return &document{ReadCloser: io.NopCloser(bytes.NewReader(data))}, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open KMZ archive: %w", err)
+	}
+	return openMainEntry(zr)
+}
+
+// openMainEntry opens the main KML document inside a KMZ archive. Following
+// Google Earth, that is doc.kml when present, otherwise the first .kml entry.
+func openMainEntry(zr *zip.Reader) (*document, error) {
+	var main *zip.File
+	var assets []string
+	for _, f := range zr.File {
+		if !strings.EqualFold(path.Ext(f.Name), ".kml") {
+			if !strings.HasSuffix(f.Name, "/") {
+				assets = append(assets, path.Clean(f.Name))
+			}
+			continue
+		}
+		if strings.EqualFold(path.Base(f.Name), "doc.kml") && (main == nil || !strings.EqualFold(path.Base(main.Name), "doc.kml")) {
+			main = f
+		}
+		if main == nil {
+			main = f
+		}
+	}
+	if main == nil {
+		return nil, fmt.Errorf("KMZ archive contains no .kml document")
+	}
+
+	rc, err := main.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in KMZ archive: %w", main.Name, err)
+	}
+	return &document{ReadCloser: rc, kmz: true, dir: path.Dir(main.Name), assets: assets}, nil
+}
+
+// archivePath resolves a relative href in the document to the archive file
+// it names, if the document came from a KMZ that contains it.
+func (d *document) archivePath(href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if !d.kmz || href == "" || strings.Contains(href, ":") || strings.HasPrefix(href, "/") {
+		return "", false
+	}
+	target := path.Join(d.dir, href)
+	for _, asset := range d.assets {
+		if asset == target {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// closers closes each of its members in order.
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var first error
+	for _, c := range cs {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
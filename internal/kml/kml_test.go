@@ -0,0 +1,124 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeKMZ zips files, in order, into a KMZ archive.
+func makeKMZ(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func kmzDoc(name string) string {
+	return `<kml xmlns="http://www.opengis.net/kml/2.2"><Document>
+		<Style id="gate"><IconStyle><Icon><href>icons/gate.png</href></Icon></IconStyle></Style>
+		<Style id="web"><IconStyle><Icon><href>https://example.com/web.png</href></Icon></IconStyle></Style>
+		<Style id="missing"><IconStyle><Icon><href>icons/missing.png</href></Icon></IconStyle></Style>
+		<Placemark><name>` + name + `</name><Point><coordinates>-115.17,36.09</coordinates></Point></Placemark>
+	</Document></kml>`
+}
+
+func TestParseKMZ(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      [][2]string
+		wantName   string
+		wantAssets []string
+		wantHrefs  []string
+	}{
+		{
+			"doc.kml preferred",
+			[][2]string{{"other.kml", kmzDoc("Other")}, {"doc.kml", kmzDoc("Main")}, {"icons/gate.png", "png"}},
+			"Main", []string{"icons/gate.png"},
+			[]string{"icons/gate.png", "https://example.com/web.png", "icons/missing.png"},
+		},
+		{
+			"first kml otherwise",
+			[][2]string{{"files/", ""}, {"files/venue.kml", kmzDoc("Venue")}, {"files/icons/gate.png", "png"}, {"second.kml", kmzDoc("Second")}},
+			"Venue", []string{"files/icons/gate.png"},
+			[]string{"files/icons/gate.png", "https://example.com/web.png", "icons/missing.png"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(context.Background(), makeKMZ(t, tt.files...), Options{})
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(result.Placemarks) != 1 || result.Placemarks[0].Name != tt.wantName {
+				t.Errorf("placemarks = %+v, want %s", result.Placemarks, tt.wantName)
+			}
+			if !reflect.DeepEqual(result.Assets, tt.wantAssets) {
+				t.Errorf("Assets = %v, want %v", result.Assets, tt.wantAssets)
+			}
+			var hrefs []string
+			for _, style := range result.Styles {
+				hrefs = append(hrefs, style.IconStyle.Icon.Href)
+			}
+			if !reflect.DeepEqual(hrefs, tt.wantHrefs) {
+				t.Errorf("icon hrefs = %v, want %v", hrefs, tt.wantHrefs)
+			}
+		})
+	}
+}
+
+func TestParseKMZWithoutDocument(t *testing.T) {
+	_, err := Parse(context.Background(), makeKMZ(t, [2]string{"icons/gate.png", "png"}), Options{})
+	if err == nil {
+		t.Fatal("Parse accepted a KMZ with no .kml document")
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+	kmlPath := filepath.Join(dir, "venue.kml")
+	kmzPath := filepath.Join(dir, "venue.kmz")
+	if err := os.WriteFile(kmlPath, []byte(kmzDoc("Plain")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kmzPath, makeKMZ(t, [2]string{"doc.kml", kmzDoc("Zipped")}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{kmlPath, "Plain"},
+		{kmzPath, "Zipped"},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.path), func(t *testing.T) {
+			result, err := ParseFile(context.Background(), tt.path, Options{})
+			if err != nil {
+				t.Fatalf("ParseFile: %v", err)
+			}
+			if len(result.Placemarks) != 1 || result.Placemarks[0].Name != tt.want {
+				t.Errorf("placemarks = %+v, want %s", result.Placemarks, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseFile(context.Background(), filepath.Join(dir, "missing.kml"), Options{}); err == nil {
+		t.Error("ParseFile succeeded on a missing file")
+	}
+}
@@ -0,0 +1,81 @@
+package kml
+
+import (
+	"slices"
+	"strings"
+)
+
+// NetworkLink loads another KML or KMZ document by reference. Url is the
+// KML 2.0 name for Link.
+type NetworkLink struct {
+	Name string `xml:"name"`
+	Link *Link  `xml:"Link"`
+	URL  *Link  `xml:"Url"`
+}
+
+type Link struct {
+	Href string `xml:"href"`
+}
+
+// LinkRef is a <NetworkLink> found while parsing. Decoding doesn't fetch
+// it; see Result.Merge for folding in the linked document once it has been.
+type LinkRef struct {
+	Name       string   `json:"name"`
+	Href       string   `json:"href"`
+	FolderPath []string `json:"folder_path"`
+}
+
+// LinkedPath is the folder path the linked document's placemarks belong
+// under: the link's own folder plus, like a Folder, its name.
+func (l LinkRef) LinkedPath() []string {
+	if l.Name == "" {
+		return slices.Clone(l.FolderPath)
+	}
+	return append(slices.Clone(l.FolderPath), l.Name)
+}
+
+func newLinkRef(nl NetworkLink, folderPath []string) (LinkRef, bool) {
+	link := nl.Link
+	if link == nil {
+		link = nl.URL
+	}
+	if link == nil || strings.TrimSpace(link.Href) == "" {
+		return LinkRef{}, false
+	}
+	return LinkRef{
+		Name:       strings.TrimSpace(nl.Name),
+		Href:       strings.TrimSpace(link.Href),
+		FolderPath: folderPath,
+	}, true
+}
+
+// Merge adds a linked document's placemarks, styles, skips, and warnings to
+// r, with folderPath prepended to their folder paths. linked's own network
+// links are not merged; callers following links recursively handle them.
+func (r *Result) Merge(linked *Result, folderPath []string) {
+	prefix := func(p []string) []string {
+		return append(slices.Clone(folderPath), p...)
+	}
+	for _, pm := range linked.Placemarks {
+		pm.FolderPath = prefix(pm.FolderPath)
+		r.Placemarks = append(r.Placemarks, pm)
+	}
+	for _, skip := range linked.Skipped {
+		skip.FolderPath = prefix(skip.FolderPath)
+		r.Skipped = append(r.Skipped, skip)
+	}
+	for _, warning := range linked.Warnings {
+		warning.FolderPath = prefix(warning.FolderPath)
+		r.Warnings = append(r.Warnings, warning)
+	}
+	r.Styles = append(r.Styles, linked.Styles...)
+	r.InvalidCoordinates += linked.InvalidCoordinates
+	if len(linked.HighlightStyles) > 0 && r.HighlightStyles == nil {
+		r.HighlightStyles = make(map[string]string, len(linked.HighlightStyles))
+	}
+	for normal, highlight := range linked.HighlightStyles {
+		if _, ok := r.HighlightStyles[normal]; !ok {
+			r.HighlightStyles[normal] = highlight
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package kml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworkLinks(t *testing.T) {
+	result := parseDoc(t, `
+		<NetworkLink><name>Parking</name><Link><href> https://example.com/parking.kmz </href></Link></NetworkLink>
+		<Folder><name>Venue</name>
+			<NetworkLink><name>Stages</name><Url><href>stages.kml</href></Url></NetworkLink>
+			<NetworkLink><name>Broken</name><Link><href></href></Link></NetworkLink>
+			<NetworkLink><Link><href>unnamed.kml</href></Link></NetworkLink>
+		</Folder>`, Options{})
+
+	want := []LinkRef{
+		{Name: "Parking", Href: "https://example.com/parking.kmz", FolderPath: []string{}},
+		{Name: "Stages", Href: "stages.kml", FolderPath: []string{"Venue"}},
+		{Name: "", Href: "unnamed.kml", FolderPath: []string{"Venue"}},
+	}
+	if !reflect.DeepEqual(result.NetworkLinks, want) {
+		t.Errorf("NetworkLinks = %+v\nwant %+v", result.NetworkLinks, want)
+	}
+
+	wantPaths := [][]string{{"Parking"}, {"Venue", "Stages"}, {"Venue"}}
+	for i, link := range result.NetworkLinks {
+		if got := link.LinkedPath(); !reflect.DeepEqual(got, wantPaths[i]) {
+			t.Errorf("%s LinkedPath = %v, want %v", link.Href, got, wantPaths[i])
+		}
+	}
+}
+
+func TestResultMerge(t *testing.T) {
+	r := &Result{
+		Placemarks:         []PlacemarkRecord{{Name: "Gate C", FolderPath: []string{"Venue"}}},
+		HighlightStyles:    map[string]string{"gate": "gateHover"},
+		InvalidCoordinates: 1,
+	}
+	linked := &Result{
+		Placemarks:         []PlacemarkRecord{{Name: "Lot A", FolderPath: []string{"North"}}, {Name: "Lot B"}},
+		Styles:             []Style{{ID: "lot"}},
+		Skipped:            []SkippedPlacemark{{Name: "Lot Z", Reason: SkipNoGeometry}},
+		Warnings:           []Warning{{Name: "Lot A", FolderPath: []string{"North"}, Message: "outer ring was not closed; closed automatically"}},
+		HighlightStyles:    map[string]string{"gate": "other", "lot": "lotHover"},
+		InvalidCoordinates: 2,
+		NetworkLinks:       []LinkRef{{Href: "deeper.kml"}},
+	}
+	base := []string{"Venue", "Parking"}
+	r.Merge(linked, base)
+
+	var paths [][]string
+	for _, pm := range r.Placemarks {
+		paths = append(paths, pm.FolderPath)
+	}
+	wantPaths := [][]string{{"Venue"}, {"Venue", "Parking", "North"}, {"Venue", "Parking"}}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("folder paths = %v, want %v", paths, wantPaths)
+	}
+	if !reflect.DeepEqual(r.Skipped[0].FolderPath, base) {
+		t.Errorf("skip folder = %v, want %v", r.Skipped[0].FolderPath, base)
+	}
+	if !reflect.DeepEqual(r.Warnings[0].FolderPath, []string{"Venue", "Parking", "North"}) {
+		t.Errorf("warning folder = %v", r.Warnings[0].FolderPath)
+	}
+	if len(r.Styles) != 1 || r.InvalidCoordinates != 3 {
+		t.Errorf("styles = %v, invalid coordinates = %d", r.Styles, r.InvalidCoordinates)
+	}
+	if want := map[string]string{"gate": "gateHover", "lot": "lotHover"}; !reflect.DeepEqual(r.HighlightStyles, want) {
+		t.Errorf("HighlightStyles = %v, want %v", r.HighlightStyles, want)
+	}
+	if len(r.NetworkLinks) != 0 {
+		t.Errorf("merged the linked document's network links: %v", r.NetworkLinks)
+	}
+	if !reflect.DeepEqual(base, []string{"Venue", "Parking"}) {
+		t.Errorf("Merge modified the folder path it was given: %v", base)
+	}
+}
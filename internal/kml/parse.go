@@ -0,0 +1,685 @@
+package kml
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Options controls coordinate parsing.
+type Options struct {
+	// DecimalComma treats commas inside ordinates as decimal separators.
+	DecimalComma bool
+	// Altitude keeps the third ordinate: a placemark with any non-zero
+	// altitude gets Z geometry, with missing altitudes read as 0.
+	Altitude bool
+	// Limit stops parsing after this many importable placemarks (0 = all).
+	Limit int
+}
+
+// Result is everything Parse extracted from a document.
+type Result struct {
+	Placemarks []PlacemarkRecord
+	Styles     []Style
+	Skipped    []SkippedPlacemark
+	Warnings   []Warning
+	// InvalidCoordinates counts coordinate tuples that had to be dropped.
+	InvalidCoordinates int
+	// HighlightStyles maps a StyleMap's normal style id to its highlight
+	// (hover) style id.
+	HighlightStyles map[string]string
+	// NetworkLinks lists the document's <NetworkLink>s, which are not
+	// followed.
+	NetworkLinks []LinkRef
+	// Assets lists the files other than KML documents in a KMZ archive, by
+	// their path within it. Style icon hrefs that name one are rewritten to
+	// that path, so they resolve against the extracted archive.
+	Assets []string
+}
+
+// UnresolvedStyles returns style ids referenced by placemarks that are not
+// defined in the document, sorted by first use.
+func (r *Result) UnresolvedStyles() []string {
+	defined := make(map[string]bool, len(r.Styles))
+	for _, style := range r.Styles {
+		defined[style.ID] = true
+	}
+
+	seen := make(map[string]bool)
+	var unresolved []string
+	for _, pm := range r.Placemarks {
+		if pm.StyleID == "" || defined[pm.StyleID] || seen[pm.StyleID] {
+			continue
+		}
+		seen[pm.StyleID] = true
+		unresolved = append(unresolved, pm.StyleID)
+	}
+	return unresolved
+}
+
+// ParseFile reads and parses a KML or KMZ file. The document is streamed
+// from disk rather than loaded whole; see Decode.
+func ParseFile(ctx context.Context, path string, opts Options) (*Result, error) {
+	doc, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+	return collect(ctx, doc, opts)
+}
+
+// Parse parses a KML document, or a KMZ archive containing one.
+func Parse(ctx context.Context, data []byte, opts Options) (*Result, error) {
+	doc, err := openBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	defer doc.Close()
+	return collect(ctx, doc, opts)
+}
+
+// collect decodes r, keeping every placemark in the result. StyleMaps defined
+// after the placemarks that use them are resolved once the whole document
+// has been read.
+func collect(ctx context.Context, doc *document, opts Options) (*Result, error) {
+	var placemarks []PlacemarkRecord
+	p := newParser(opts)
+	result, err := p.decode(ctx, doc, func(pm PlacemarkRecord) error {
+		placemarks = append(placemarks, pm)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range placemarks {
+		p.resolveStyleMap(&placemarks[i])
+	}
+	result.Placemarks = placemarks
+	result.Assets = doc.assets
+	for _, style := range result.Styles {
+		if style.IconStyle == nil || style.IconStyle.Icon == nil {
+			continue
+		}
+		if target, ok := doc.archivePath(style.IconStyle.Icon.Href); ok {
+			style.IconStyle.Icon.Href = target
+		}
+	}
+	return result, nil
+}
+
+func newParser(opts Options) *parser {
+	return &parser{
+		opts:            opts,
+		normalStyles:    make(map[string]string),
+		highlightStyles: make(map[string]string),
+	}
+}
+
+// parser accumulates results while walking a document.
+type parser struct {
+	opts   Options
+	result Result
+	// z is set while building a placemark whose geometry carries altitude.
+	z bool
+	// normalStyles and highlightStyles map the StyleMap ids read so far to
+	// their styles.
+	normalStyles    map[string]string
+	highlightStyles map[string]string
+}
+
+// addStyleMap records a StyleMap's normal and highlight styles.
+func (p *parser) addStyleMap(sm StyleMap) {
+	for _, pair := range sm.Pairs {
+		styleID := strings.TrimPrefix(strings.TrimSpace(pair.StyleURL), "#")
+		switch strings.TrimSpace(pair.Key) {
+		case "normal":
+			p.normalStyles[sm.ID] = styleID
+		case "highlight":
+			p.highlightStyles[sm.ID] = styleID
+		}
+	}
+}
+
+// resolveStyleMap rewrites a placemark style reference that points at a
+// StyleMap to the StyleMap's "normal" style, which is what gets imported.
+func (p *parser) resolveStyleMap(pm *PlacemarkRecord) {
+	if styleID, ok := p.normalStyles[pm.StyleID]; ok {
+		pm.StyleID = styleID
+	}
+}
+
+// highlights returns each StyleMap normal style's "highlight" counterpart.
+func (p *parser) highlights() map[string]string {
+	highlights := make(map[string]string)
+	for mapID, normalID := range p.normalStyles {
+		if highlightID, ok := p.highlightStyles[mapID]; ok && highlightID != normalID {
+			highlights[normalID] = highlightID
+		}
+	}
+	return highlights
+}
+
+// processPlacemark converts a KML placemark into a record, or records why it
+// was skipped and reports false when no usable geometry could be built.
+func (p *parser) processPlacemark(pm Placemark, folderPath []string) (PlacemarkRecord, bool) {
+	var geomType, geomWKT, coordsRaw string
+	invalidBefore := p.result.InvalidCoordinates
+	warningsBefore := len(p.result.Warnings)
+	p.z = p.opts.Altitude && hasAltitude(pm, p.opts)
+
+	if pm.Point != nil {
+		geomType = "Point"
+		coordsRaw = strings.TrimSpace(pm.Point.Coordinates)
+		geomWKT = p.buildPointWKT(coordsRaw)
+	} else if pm.LineString != nil {
+		geomType = "LineString"
+		coordsRaw = strings.TrimSpace(pm.LineString.Coordinates)
+		geomWKT = p.buildLineStringWKT(coordsRaw)
+	} else if pm.Polygon != nil {
+		geomType = "Polygon"
+		coordsRaw = strings.TrimSpace(pm.Polygon.OuterBoundary.LinearRing.Coordinates)
+		geomWKT = p.buildPolygonWKT(pm, pm.Polygon, folderPath)
+	} else if pm.MultiGeometry != nil {
+		geomType, geomWKT, coordsRaw = p.buildMultiGeometryWKT(pm, folderPath)
+	} else if pm.Track != nil {
+		// Tracks are stored as lines so spatial queries treat them alike.
+		geomType = "LineString"
+		coordsRaw = pm.Track.CoordinatesText()
+		geomWKT = p.buildLineStringWKT(coordsRaw)
+	} else {
+		p.skip(newSkippedPlacemark(pm, folderPath, SkipNoGeometry, ""))
+		return PlacemarkRecord{}, false
+	}
+
+	if geomWKT == "" {
+		p.result.Warnings = p.result.Warnings[:warningsBefore]
+		reason := SkipInvalidCoords
+		if coords, _ := ParseCoordinateTuples(coordsRaw, p.opts); geomType == "Polygon" && len(coords) > 0 {
+			reason = SkipDegeneratePolygon
+		}
+		p.skip(newSkippedPlacemark(pm, folderPath, reason, coordsRaw))
+		return PlacemarkRecord{}, false
+	}
+
+	if dropped := p.result.InvalidCoordinates - invalidBefore; dropped > 0 {
+		p.warn(pm, folderPath, fmt.Sprintf("%d unparseable coordinate tuple(s) dropped", dropped))
+	}
+	if coords, _ := ParseCoordinateTuples(coordsRaw, p.opts); outOfRange(coords) {
+		p.warn(pm, folderPath, "coordinates outside -180..180 / -90..90; check for swapped lat/lon")
+	}
+
+	styleID := strings.TrimPrefix(pm.StyleURL, "#")
+	timeBegin, timeEnd := p.placemarkTimes(pm, folderPath)
+	var trackTimes []time.Time
+	if pm.Track != nil {
+		trackTimes = p.trackTimes(pm, folderPath)
+		if timeBegin == nil && timeEnd == nil && len(trackTimes) > 0 {
+			timeBegin, timeEnd = &trackTimes[0], &trackTimes[len(trackTimes)-1]
+		}
+	}
+
+	extData := make(map[string]string)
+	var mediaLinks []string
+
+	if pm.ExtendedData != nil {
+		for _, data := range pm.ExtendedData.Data {
+			if data.Name == "gx_media_links" {
+				mediaLinks = append(mediaLinks, data.Value)
+			} else {
+				extData[data.Name] = data.Value
+			}
+		}
+	}
+
+	return PlacemarkRecord{
+		Name:           strings.TrimSpace(pm.Name),
+		Description:    strings.TrimSpace(pm.Description),
+		StyleID:        styleID,
+		FolderPath:     folderPath,
+		GeometryType:   geomType,
+		GeomWKT:        geomWKT,
+		CoordinatesRaw: coordsRaw,
+		MediaLinks:     mediaLinks,
+		ExtendedData:   extData,
+		TimeBegin:      timeBegin,
+		TimeEnd:        timeEnd,
+		TrackTimes:     trackTimes,
+	}, true
+}
+
+// trackTimes parses a gx:Track's <when> values. They only mean something
+// paired with positions, so all are dropped with a warning unless every
+// position has a parseable time.
+func (p *parser) trackTimes(pm Placemark, folderPath []string) []time.Time {
+	track := pm.Track
+	if len(track.When) == 0 {
+		return nil
+	}
+	if len(track.When) != len(track.Coords) {
+		p.warn(pm, folderPath, fmt.Sprintf("gx:Track has %d <when> for %d <gx:coord>; times ignored", len(track.When), len(track.Coords)))
+		return nil
+	}
+
+	times := make([]time.Time, len(track.When))
+	for i, when := range track.When {
+		t, err := parseKMLTime(strings.TrimSpace(when))
+		if err != nil {
+			p.warn(pm, folderPath, fmt.Sprintf("unparseable gx:Track when %q; times ignored", when))
+			return nil
+		}
+		times[i] = t
+	}
+	return times
+}
+
+// placemarkTimes reads a placemark's <TimeStamp> or <TimeSpan>. Values that
+// can't be parsed are dropped with a warning.
+func (p *parser) placemarkTimes(pm Placemark, folderPath []string) (begin, end *time.Time) {
+	parse := func(element, value string) *time.Time {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil
+		}
+		t, err := parseKMLTime(value)
+		if err != nil {
+			p.warn(pm, folderPath, fmt.Sprintf("unparseable %s %q ignored", element, value))
+			return nil
+		}
+		return &t
+	}
+
+	switch {
+	case pm.TimeStamp != nil:
+		return parse("TimeStamp", pm.TimeStamp.When), nil
+	case pm.TimeSpan != nil:
+		begin = parse("TimeSpan begin", pm.TimeSpan.Begin)
+		end = parse("TimeSpan end", pm.TimeSpan.End)
+		if begin != nil && end != nil && end.Before(*begin) {
+			p.warn(pm, folderPath, "TimeSpan ends before it begins; end ignored")
+			end = nil
+		}
+		return begin, end
+	}
+	return nil, nil
+}
+
+// kmlTimeLayouts are the XML Schema forms KML allows in <when>, <begin>, and
+// <end>, most specific first. Values without a zone are read as UTC.
+var kmlTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseKMLTime(value string) (time.Time, error) {
+	for _, layout := range kmlTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid KML time %q", value)
+}
+
+func (p *parser) skip(s *SkippedPlacemark) {
+	p.result.Skipped = append(p.result.Skipped, *s)
+}
+
+func (p *parser) warn(pm Placemark, folderPath []string, message string) {
+	p.result.Warnings = append(p.result.Warnings, Warning{
+		Name:       strings.TrimSpace(pm.Name),
+		FolderPath: folderPath,
+		Message:    message,
+	})
+}
+
+func outOfRange(coords [][2]float64) bool {
+	for _, c := range coords {
+		if math.Abs(c[0]) > 180 || math.Abs(c[1]) > 90 {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCoordinateTuples splits KML coordinate text into "lon,lat[,alt]"
+// tokens. Besides the standard whitespace separators it accepts semicolons,
+// which some third-party exporters emit, and ignores byte order marks.
+func splitCoordinateTuples(coordsText string) []string {
+	coordsText = strings.ReplaceAll(coordsText, "\ufeff", "")
+	return strings.FieldsFunc(coordsText, func(r rune) bool {
+		return r == ';' || unicode.IsSpace(r)
+	})
+}
+
+// parseCoordinates parses coordinate text, counting dropped tuples.
+func (p *parser) parseCoordinates(coordsText string) [][3]float64 {
+	coords, failed := parseCoordinateTriples(coordsText, p.opts)
+	p.result.InvalidCoordinates += failed
+	return coords
+}
+
+// ParseCoordinateTuples parses lon/lat pairs from coordinate text and returns
+// how many tuples could not be parsed.
+func ParseCoordinateTuples(coordsText string, opts Options) ([][2]float64, int) {
+	triples, failed := parseCoordinateTriples(coordsText, opts)
+	coords := make([][2]float64, len(triples))
+	for i, c := range triples {
+		coords[i] = [2]float64{c[0], c[1]}
+	}
+	return coords, failed
+}
+
+// parseCoordinateTriples is ParseCoordinateTuples keeping altitude, which is
+// 0 when a tuple has none.
+func parseCoordinateTriples(coordsText string, opts Options) ([][3]float64, int) {
+	var coords [][3]float64
+	failed := 0
+
+	for _, part := range splitCoordinateTuples(coordsText) {
+		vals, err := parseOrdinates(part, opts)
+		if err != nil {
+			failed++
+			continue
+		}
+		c := [3]float64{vals[0], vals[1]}
+		if len(vals) > 2 {
+			c[2] = vals[2]
+		}
+		coords = append(coords, c)
+	}
+
+	return coords, failed
+}
+
+// hasAltitude reports whether any coordinate of the placemark's geometry has
+// a non-zero altitude.
+func hasAltitude(pm Placemark, opts Options) bool {
+	for _, text := range geometryCoordinates(pm) {
+		coords, _ := parseCoordinateTriples(text, opts)
+		for _, c := range coords {
+			if c[2] != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// geometryCoordinates lists every coordinate string in a placemark's
+// geometry, including polygon holes and MultiGeometry members.
+func geometryCoordinates(pm Placemark) []string {
+	var texts []string
+	addPolygon := func(polygon *Polygon) {
+		texts = append(texts, polygon.OuterBoundary.LinearRing.Coordinates)
+		for _, inner := range polygon.InnerBoundary {
+			texts = append(texts, inner.LinearRing.Coordinates)
+		}
+	}
+
+	var addMulti func(mg *MultiGeometry)
+	addMulti = func(mg *MultiGeometry) {
+		for _, pt := range mg.Points {
+			texts = append(texts, pt.Coordinates)
+		}
+		for _, ls := range mg.LineStrings {
+			texts = append(texts, ls.Coordinates)
+		}
+		for i := range mg.Polygons {
+			addPolygon(&mg.Polygons[i])
+		}
+		for i := range mg.MultiGeometries {
+			addMulti(&mg.MultiGeometries[i])
+		}
+	}
+
+	switch {
+	case pm.Point != nil:
+		texts = append(texts, pm.Point.Coordinates)
+	case pm.LineString != nil:
+		texts = append(texts, pm.LineString.Coordinates)
+	case pm.Polygon != nil:
+		addPolygon(pm.Polygon)
+	case pm.MultiGeometry != nil:
+		addMulti(pm.MultiGeometry)
+	case pm.Track != nil:
+		texts = append(texts, pm.Track.CoordinatesText())
+	}
+	return texts
+}
+
+// keyword returns a WKT type keyword, marked Z for placemarks with altitude.
+func (p *parser) keyword(name string) string {
+	if p.z {
+		return name + " Z"
+	}
+	return name
+}
+
+// ringClosed reports whether a ring ends where it starts, ignoring altitude
+// unless it is being kept.
+func (p *parser) ringClosed(ring [][3]float64) bool {
+	first, last := ring[0], ring[len(ring)-1]
+	if !p.z {
+		first[2], last[2] = 0, 0
+	}
+	return first == last
+}
+
+// position formats one coordinate as a WKT position.
+func (p *parser) position(c [3]float64) string {
+	if p.z {
+		return fmt.Sprintf("%f %f %f", c[0], c[1], c[2])
+	}
+	return fmt.Sprintf("%f %f", c[0], c[1])
+}
+
+// parseOrdinates splits a "lon,lat[,alt]" tuple into numbers. In
+// decimal-comma mode a tuple such as "-115,17,36,09" is read as pairs of
+// integer and fractional parts, i.e. -115.17 and 36.09.
+func parseOrdinates(tuple string, opts Options) ([]float64, error) {
+	pieces := strings.Split(tuple, ",")
+
+	if opts.DecimalComma && (len(pieces) == 4 || len(pieces) == 6) {
+		var joined []string
+		for i := 0; i < len(pieces); i += 2 {
+			joined = append(joined, pieces[i]+"."+pieces[i+1])
+		}
+		pieces = joined
+	}
+
+	if len(pieces) < 2 {
+		return nil, fmt.Errorf("coordinate %q has fewer than two ordinates", tuple)
+	}
+
+	vals := make([]float64, 0, len(pieces))
+	for i, piece := range pieces {
+		piece = strings.TrimSpace(piece)
+		if i >= 2 && piece == "" {
+			break
+		}
+		v, err := strconv.ParseFloat(piece, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid ordinate %q", piece)
+		}
+		vals = append(vals, v)
+	}
+
+	return vals, nil
+}
+
+func (p *parser) buildPointWKT(coordsText string) string {
+	return wrapWKT(p.keyword("POINT"), p.pointText(coordsText))
+}
+
+func (p *parser) buildLineStringWKT(coordsText string) string {
+	return wrapWKT(p.keyword("LINESTRING"), p.lineStringText(coordsText))
+}
+
+func (p *parser) buildPolygonWKT(pm Placemark, polygon *Polygon, folderPath []string) string {
+	return wrapWKT(p.keyword("POLYGON"), p.polygonText(pm, polygon, folderPath))
+}
+
+// wrapWKT prefixes a WKT body with its type keyword; an empty body (no usable
+// geometry) stays empty.
+func wrapWKT(keyword, text string) string {
+	if text == "" {
+		return ""
+	}
+	return keyword + text
+}
+
+// buildMultiGeometryWKT converts a MultiGeometry to MULTIPOINT,
+// MULTILINESTRING, or MULTIPOLYGON when its children share a type, and to a
+// GEOMETRYCOLLECTION otherwise. Children without usable coordinates are
+// dropped with a warning. coordsRaw joins the children's coordinate text.
+func (p *parser) buildMultiGeometryWKT(pm Placemark, folderPath []string) (geomType, wkt, coordsRaw string) {
+	var points, lines, polygons []string
+	var raw []string
+	dropped := 0
+
+	var collect func(mg *MultiGeometry)
+	collect = func(mg *MultiGeometry) {
+		for _, pt := range mg.Points {
+			raw = append(raw, strings.TrimSpace(pt.Coordinates))
+			if text := p.pointText(pt.Coordinates); text != "" {
+				points = append(points, text)
+			} else {
+				dropped++
+			}
+		}
+		for _, ls := range mg.LineStrings {
+			raw = append(raw, strings.TrimSpace(ls.Coordinates))
+			if text := p.lineStringText(ls.Coordinates); text != "" {
+				lines = append(lines, text)
+			} else {
+				dropped++
+			}
+		}
+		for i := range mg.Polygons {
+			raw = append(raw, strings.TrimSpace(mg.Polygons[i].OuterBoundary.LinearRing.Coordinates))
+			if text := p.polygonText(pm, &mg.Polygons[i], folderPath); text != "" {
+				polygons = append(polygons, text)
+			} else {
+				dropped++
+			}
+		}
+		for i := range mg.MultiGeometries {
+			collect(&mg.MultiGeometries[i])
+		}
+	}
+	collect(pm.MultiGeometry)
+	coordsRaw = strings.Join(raw, " ")
+
+	kinds := 0
+	for _, parts := range [][]string{points, lines, polygons} {
+		if len(parts) > 0 {
+			kinds++
+		}
+	}
+	if kinds == 0 {
+		return "MultiGeometry", "", coordsRaw
+	}
+	if dropped > 0 {
+		p.warn(pm, folderPath, fmt.Sprintf("%d MultiGeometry member(s) without usable coordinates dropped", dropped))
+	}
+
+	if kinds > 1 {
+		var members []string
+		for _, text := range points {
+			members = append(members, p.keyword("POINT")+text)
+		}
+		for _, text := range lines {
+			members = append(members, p.keyword("LINESTRING")+text)
+		}
+		for _, text := range polygons {
+			members = append(members, p.keyword("POLYGON")+text)
+		}
+		return "GeometryCollection", p.keyword("GEOMETRYCOLLECTION") + "(" + strings.Join(members, ", ") + ")", coordsRaw
+	}
+
+	switch {
+	case len(points) > 0:
+		return "MultiPoint", p.keyword("MULTIPOINT") + "(" + strings.Join(points, ", ") + ")", coordsRaw
+	case len(lines) > 0:
+		return "MultiLineString", p.keyword("MULTILINESTRING") + "(" + strings.Join(lines, ", ") + ")", coordsRaw
+	default:
+		return "MultiPolygon", p.keyword("MULTIPOLYGON") + "(" + strings.Join(polygons, ", ") + ")", coordsRaw
+	}
+}
+
+// pointText returns the WKT body "(x y)" of a point, or "" without a
+// usable coordinate.
+func (p *parser) pointText(coordsText string) string {
+	coords := p.parseCoordinates(coordsText)
+	if len(coords) == 0 {
+		return ""
+	}
+	return "(" + p.position(coords[0]) + ")"
+}
+
+// lineStringText returns the WKT body of a line, or "" with fewer than two
+// usable coordinates.
+func (p *parser) lineStringText(coordsText string) string {
+	coords := p.parseCoordinates(coordsText)
+	if len(coords) < 2 {
+		return ""
+	}
+
+	var points []string
+	for _, c := range coords {
+		points = append(points, p.position(c))
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(points, ", "))
+}
+
+// polygonText returns the WKT body of a polygon with its rings closed, or ""
+// when the outer ring has fewer than three usable coordinates.
+func (p *parser) polygonText(pm Placemark, polygon *Polygon, folderPath []string) string {
+	outer := p.parseCoordinates(polygon.OuterBoundary.LinearRing.Coordinates)
+	if len(outer) < 3 {
+		return ""
+	}
+
+	// Ensure ring is closed
+	if !p.ringClosed(outer) {
+		outer = append(outer, outer[0])
+		p.warn(pm, folderPath, "outer ring was not closed; closed automatically")
+	}
+
+	var outerPoints []string
+	for _, c := range outer {
+		outerPoints = append(outerPoints, p.position(c))
+	}
+
+	rings := []string{fmt.Sprintf("(%s)", strings.Join(outerPoints, ", "))}
+
+	// Process inner rings (holes)
+	for _, inner := range polygon.InnerBoundary {
+		innerCoords := p.parseCoordinates(inner.LinearRing.Coordinates)
+		if len(innerCoords) < 3 {
+			p.warn(pm, folderPath, "inner ring with fewer than 3 coordinates dropped")
+			continue
+		}
+
+		if !p.ringClosed(innerCoords) {
+			innerCoords = append(innerCoords, innerCoords[0])
+		}
+
+		var innerPoints []string
+		for _, c := range innerCoords {
+			innerPoints = append(innerPoints, p.position(c))
+		}
+
+		rings = append(rings, fmt.Sprintf("(%s)", strings.Join(innerPoints, ", ")))
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(rings, ", "))
+}
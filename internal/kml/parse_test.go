@@ -0,0 +1,280 @@
+package kml
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseCoordinateTuples(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		opts       Options
+		want       [][2]float64
+		wantFailed int
+	}{
+		{"whitespace", "-115.17,36.09,0\n\t-115.16,36.10", Options{}, [][2]float64{{-115.17, 36.09}, {-115.16, 36.10}}, 0},
+		{"semicolons", "-115.17,36.09;-115.16,36.10;", Options{}, [][2]float64{{-115.17, 36.09}, {-115.16, 36.10}}, 0},
+		{"byte order mark", "\ufeff-115.17,36.09", Options{}, [][2]float64{{-115.17, 36.09}}, 0},
+		{"trailing comma", "-115.17,36.09,", Options{}, [][2]float64{{-115.17, 36.09}}, 0},
+		{"one ordinate", "-115.17 -115.16,36.10", Options{}, [][2]float64{{-115.16, 36.10}}, 1},
+		{"not a number", "west,north -115.16,36.10", Options{}, [][2]float64{{-115.16, 36.10}}, 1},
+		{"NaN", "NaN,36.09 -115.16,Inf", Options{}, nil, 2},
+		{"decimal comma", "-115,17,36,09 -115,16,36,10,0,0", Options{DecimalComma: true}, [][2]float64{{-115.17, 36.09}, {-115.16, 36.10}}, 0},
+		{"decimal comma off", "-115,17,36,09", Options{}, [][2]float64{{-115, 17}}, 0},
+		{"empty", "  ", Options{}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coords, failed := ParseCoordinateTuples(tt.text, tt.opts)
+			if len(coords) == 0 && len(tt.want) == 0 {
+				coords = nil
+			}
+			if !reflect.DeepEqual(coords, tt.want) {
+				t.Errorf("coords = %v, want %v", coords, tt.want)
+			}
+			if failed != tt.wantFailed {
+				t.Errorf("failed = %d, want %d", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+// parseDoc parses placemarks wrapped in a KML Document.
+func parseDoc(t *testing.T, placemarks string, opts Options) *Result {
+	t.Helper()
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+<Document>` + placemarks + `</Document>
+</kml>`
+	result, err := Parse(context.Background(), []byte(doc), opts)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return result
+}
+
+func TestParseGeometry(t *testing.T) {
+	tests := []struct {
+		name        string
+		geometry    string
+		wantType    string
+		wantWKT     string
+		wantWarning string
+	}{
+		{
+			"point", `<Point><coordinates>-115.17,36.09,0</coordinates></Point>`,
+			"Point", "POINT(-115.170000 36.090000)", "",
+		},
+		{
+			"line", `<LineString><coordinates>-115.17,36.09 -115.16,36.10</coordinates></LineString>`,
+			"LineString", "LINESTRING(-115.170000 36.090000, -115.160000 36.100000)", "",
+		},
+		{
+			"open polygon", `<Polygon><outerBoundaryIs><LinearRing><coordinates>0,0 1,0 1,1</coordinates></LinearRing></outerBoundaryIs></Polygon>`,
+			"Polygon", "POLYGON((0.000000 0.000000, 1.000000 0.000000, 1.000000 1.000000, 0.000000 0.000000))",
+			"outer ring was not closed; closed automatically",
+		},
+		{
+			"polygon with hole", `<Polygon>
+				<outerBoundaryIs><LinearRing><coordinates>0,0 4,0 4,4 0,0</coordinates></LinearRing></outerBoundaryIs>
+				<innerBoundaryIs><LinearRing><coordinates>1,1 2,1 2,2 1,1</coordinates></LinearRing></innerBoundaryIs>
+				<innerBoundaryIs><LinearRing><coordinates>3,3 3,3</coordinates></LinearRing></innerBoundaryIs>
+			</Polygon>`,
+			"Polygon", "POLYGON((0.000000 0.000000, 4.000000 0.000000, 4.000000 4.000000, 0.000000 0.000000), " +
+				"(1.000000 1.000000, 2.000000 1.000000, 2.000000 2.000000, 1.000000 1.000000))",
+			"inner ring with fewer than 3 coordinates dropped",
+		},
+		{
+			"multipoint", `<MultiGeometry><Point><coordinates>0,0</coordinates></Point><Point><coordinates>1,1</coordinates></Point></MultiGeometry>`,
+			"MultiPoint", "MULTIPOINT((0.000000 0.000000), (1.000000 1.000000))", "",
+		},
+		{
+			"nested multilinestring", `<MultiGeometry>
+				<LineString><coordinates>0,0 1,1</coordinates></LineString>
+				<MultiGeometry><LineString><coordinates>2,2 3,3</coordinates></LineString></MultiGeometry>
+			</MultiGeometry>`,
+			"MultiLineString", "MULTILINESTRING((0.000000 0.000000, 1.000000 1.000000), (2.000000 2.000000, 3.000000 3.000000))", "",
+		},
+		{
+			"mixed collection", `<MultiGeometry>
+				<Point><coordinates>0,0</coordinates></Point>
+				<LineString><coordinates>0,0 1,1</coordinates></LineString>
+				<LineString><coordinates>5,5</coordinates></LineString>
+			</MultiGeometry>`,
+			"GeometryCollection", "GEOMETRYCOLLECTION(POINT(0.000000 0.000000), LINESTRING(0.000000 0.000000, 1.000000 1.000000))",
+			"1 MultiGeometry member(s) without usable coordinates dropped",
+		},
+		{
+			"swapped lat lon", `<Point><coordinates>36.09,-115.17</coordinates></Point>`,
+			"Point", "POINT(36.090000 -115.170000)",
+			"coordinates outside -180..180 / -90..90; check for swapped lat/lon",
+		},
+		{
+			"bad tuple dropped", `<LineString><coordinates>0,0 x,y 1,1</coordinates></LineString>`,
+			"LineString", "LINESTRING(0.000000 0.000000, 1.000000 1.000000)",
+			"1 unparseable coordinate tuple(s) dropped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseDoc(t, `<Placemark><name>Gate C</name>`+tt.geometry+`</Placemark>`, Options{})
+			if len(result.Placemarks) != 1 {
+				t.Fatalf("parsed %d placemarks (skipped %+v), want 1", len(result.Placemarks), result.Skipped)
+			}
+			pm := result.Placemarks[0]
+			if pm.GeometryType != tt.wantType {
+				t.Errorf("GeometryType = %q, want %q", pm.GeometryType, tt.wantType)
+			}
+			if pm.GeomWKT != tt.wantWKT {
+				t.Errorf("GeomWKT = %q\nwant %q", pm.GeomWKT, tt.wantWKT)
+			}
+
+			var messages []string
+			for _, w := range result.Warnings {
+				messages = append(messages, w.Message)
+			}
+			if tt.wantWarning == "" && len(messages) > 0 {
+				t.Errorf("unexpected warnings %q", messages)
+			}
+			if tt.wantWarning != "" && !slices.Contains(messages, tt.wantWarning) {
+				t.Errorf("warnings %q do not include %q", messages, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestParseAltitude(t *testing.T) {
+	const placemarks = `
+		<Placemark><name>Tower</name><Point><coordinates>-115.17,36.09,120</coordinates></Point></Placemark>
+		<Placemark><name>Gate C</name><LineString><coordinates>0,0,0 1,1</coordinates></LineString></Placemark>
+		<Placemark><name>Roof</name><Polygon><outerBoundaryIs><LinearRing>
+			<coordinates>0,0,10 1,0,10 1,1,12 0,0,10</coordinates>
+		</LinearRing></outerBoundaryIs></Polygon></Placemark>`
+
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{"dropped by default", Options{}, map[string]string{
+			"Tower":  "POINT(-115.170000 36.090000)",
+			"Gate C": "LINESTRING(0.000000 0.000000, 1.000000 1.000000)",
+			"Roof":   "POLYGON((0.000000 0.000000, 1.000000 0.000000, 1.000000 1.000000, 0.000000 0.000000))",
+		}},
+		{"kept", Options{Altitude: true}, map[string]string{
+			"Tower":  "POINT Z(-115.170000 36.090000 120.000000)",
+			"Gate C": "LINESTRING(0.000000 0.000000, 1.000000 1.000000)",
+			"Roof":   "POLYGON Z((0.000000 0.000000 10.000000, 1.000000 0.000000 10.000000, 1.000000 1.000000 12.000000, 0.000000 0.000000 10.000000))",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseDoc(t, placemarks, tt.opts)
+			got := make(map[string]string)
+			for _, pm := range result.Placemarks {
+				got[pm.Name] = pm.GeomWKT
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WKT = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimes(t *testing.T) {
+	at := func(s string) *time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &v
+	}
+
+	tests := []struct {
+		name        string
+		when        string
+		wantBegin   *time.Time
+		wantEnd     *time.Time
+		wantWarning bool
+	}{
+		{"none", "", nil, nil, false},
+		{"timestamp", `<TimeStamp><when>2017-10-01T21:41:56-07:00</when></TimeStamp>`, at("2017-10-02T04:41:56Z"), nil, false},
+		{"timestamp without zone", `<TimeStamp><when>2017-10-01T21:41:56</when></TimeStamp>`, at("2017-10-01T21:41:56Z"), nil, false},
+		{"date", `<TimeStamp><when>2017-10-01</when></TimeStamp>`, at("2017-10-01T00:00:00Z"), nil, false},
+		{"year and month", `<TimeStamp><when>2017-10</when></TimeStamp>`, at("2017-10-01T00:00:00Z"), nil, false},
+		{"year", `<TimeStamp><when>2017</when></TimeStamp>`, at("2017-01-01T00:00:00Z"), nil, false},
+		{"unparseable", `<TimeStamp><when>last Sunday</when></TimeStamp>`, nil, nil, true},
+		{
+			"span", `<TimeSpan><begin>2017-10-01T21:00:00Z</begin><end>2017-10-01T23:00:00Z</end></TimeSpan>`,
+			at("2017-10-01T21:00:00Z"), at("2017-10-01T23:00:00Z"), false,
+		},
+		{"open span", `<TimeSpan><end>2017-10-01T23:00:00Z</end></TimeSpan>`, nil, at("2017-10-01T23:00:00Z"), false},
+		{
+			"backwards span", `<TimeSpan><begin>2017-10-01T23:00:00Z</begin><end>2017-10-01T21:00:00Z</end></TimeSpan>`,
+			at("2017-10-01T23:00:00Z"), nil, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseDoc(t, `<Placemark><name>Gate C</name>`+tt.when+
+				`<Point><coordinates>-115.17,36.09</coordinates></Point></Placemark>`, Options{})
+			pm := result.Placemarks[0]
+			if !equalTimes(pm.TimeBegin, tt.wantBegin) {
+				t.Errorf("TimeBegin = %v, want %v", pm.TimeBegin, tt.wantBegin)
+			}
+			if !equalTimes(pm.TimeEnd, tt.wantEnd) {
+				t.Errorf("TimeEnd = %v, want %v", pm.TimeEnd, tt.wantEnd)
+			}
+			if got := len(result.Warnings) > 0; got != tt.wantWarning {
+				t.Errorf("warnings = %+v, want warning %v", result.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func TestParseTrack(t *testing.T) {
+	const coords = `<gx:coord>-115.17 36.09 0</gx:coord><gx:coord>-115.16 36.10 0</gx:coord>`
+	first := time.Date(2017, 10, 1, 21, 0, 0, 0, time.UTC)
+	last := time.Date(2017, 10, 1, 21, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		track       string
+		wantTimes   []time.Time
+		wantWarning bool
+	}{
+		{"timed", `<when>2017-10-01T21:00:00Z</when><when>2017-10-01T21:05:00Z</when>` + coords, []time.Time{first, last}, false},
+		{"untimed", coords, nil, false},
+		{"count mismatch", `<when>2017-10-01T21:00:00Z</when>` + coords, nil, true},
+		{"bad time", `<when>2017-10-01T21:00:00Z</when><when>soon</when>` + coords, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseDoc(t, `<Placemark><name>Shuttle</name><gx:Track>`+tt.track+`</gx:Track></Placemark>`, Options{})
+			pm := result.Placemarks[0]
+			if pm.GeometryType != "LineString" || pm.GeomWKT != "LINESTRING(-115.170000 36.090000, -115.160000 36.100000)" {
+				t.Errorf("geometry = %s %s", pm.GeometryType, pm.GeomWKT)
+			}
+			if !slices.EqualFunc(pm.TrackTimes, tt.wantTimes, time.Time.Equal) {
+				t.Errorf("TrackTimes = %v, want %v", pm.TrackTimes, tt.wantTimes)
+			}
+			if tt.wantTimes != nil && (!equalTimes(pm.TimeBegin, &first) || !equalTimes(pm.TimeEnd, &last)) {
+				t.Errorf("span = %v..%v, want the track's first and last times", pm.TimeBegin, pm.TimeEnd)
+			}
+			if got := len(result.Warnings) > 0; got != tt.wantWarning {
+				t.Errorf("warnings = %+v, want warning %v", result.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package kml
+
+import "strings"
+
+// SkipReason categorizes why a placemark was not imported.
+type SkipReason string
+
+const (
+	SkipNoGeometry        SkipReason = "no_geometry"
+	SkipInvalidCoords     SkipReason = "invalid_coords"
+	SkipEmptyName         SkipReason = "empty_name"
+	SkipDegeneratePolygon SkipReason = "degenerate_polygon"
+	// SkipInvalidGeometry is set by the importer when PostGIS rejects a
+	// geometry or ST_MakeValid can't repair it.
+	SkipInvalidGeometry SkipReason = "invalid_geometry"
+)
+
+// SkipReasons lists every reason, in the order they are reported.
+var SkipReasons = []SkipReason{
+	SkipNoGeometry,
+	SkipInvalidCoords,
+	SkipEmptyName,
+	SkipDegeneratePolygon,
+	SkipInvalidGeometry,
+}
+
+// Geometry reports whether r drops a placemark for its geometry, as
+// opposed to its name.
+func (r SkipReason) Geometry() bool {
+	switch r {
+	case SkipNoGeometry, SkipInvalidCoords, SkipDegeneratePolygon, SkipInvalidGeometry:
+		return true
+	}
+	return false
+}
+
+// SkippedPlacemark records a placemark dropped during parsing or import.
+type SkippedPlacemark struct {
+	Name           string     `json:"name"`
+	FolderPath     []string   `json:"folder_path"`
+	Reason         SkipReason `json:"reason"`
+	CoordinatesRaw string     `json:"coordinates_raw,omitempty"`
+}
+
+// Warning flags a placemark that was parsed but whose geometry needed
+// repair or looks suspect.
+type Warning struct {
+	Name       string   `json:"name"`
+	FolderPath []string `json:"folder_path"`
+	Message    string   `json:"message"`
+}
+
+// TallySkips counts skipped placemarks by reason, including zero counts.
+func TallySkips(skipped []SkippedPlacemark) map[SkipReason]int {
+	counts := make(map[SkipReason]int, len(SkipReasons))
+	for _, reason := range SkipReasons {
+		counts[reason] = 0
+	}
+	for _, skip := range skipped {
+		counts[skip.Reason]++
+	}
+	return counts
+}
+
+func newSkippedPlacemark(pm Placemark, folderPath []string, reason SkipReason, coordsRaw string) *SkippedPlacemark {
+	return &SkippedPlacemark{
+		Name:           strings.TrimSpace(pm.Name),
+		FolderPath:     folderPath,
+		Reason:         reason,
+		CoordinatesRaw: coordsRaw,
+	}
+}
@@ -0,0 +1,75 @@
+package kml
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const skippedDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+  <Folder>
+    <name>Venue</name>
+    <Placemark>
+      <name>Gate C</name>
+      <Polygon><outerBoundaryIs><LinearRing>
+        <coordinates>-115.17,36.09 -115.17,36.09</coordinates>
+      </LinearRing></outerBoundaryIs></Polygon>
+    </Placemark>
+    <Placemark>
+      <name>Stage</name>
+    </Placemark>
+    <Placemark>
+      <name>Lot</name>
+      <Point><coordinates>north,east</coordinates></Point>
+    </Placemark>
+    <Placemark>
+      <name>Tower</name>
+      <Polygon><outerBoundaryIs><LinearRing>
+        <coordinates>-115.17,36.09 -115.16,36.09 -115.16,36.10 -115.17,36.09</coordinates>
+      </LinearRing></outerBoundaryIs></Polygon>
+    </Placemark>
+  </Folder>
+</Document>
+</kml>`
+
+func TestParseRecordsSkippedPlacemarks(t *testing.T) {
+	result, err := Parse(context.Background(), []byte(skippedDoc), Options{})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(result.Placemarks) != 1 || result.Placemarks[0].Name != "Tower" {
+		t.Fatalf("imported %+v, want only Tower", result.Placemarks)
+	}
+
+	want := []SkippedPlacemark{
+		{Name: "Gate C", FolderPath: []string{"Venue"}, Reason: SkipDegeneratePolygon, CoordinatesRaw: "-115.17,36.09 -115.17,36.09"},
+		{Name: "Stage", FolderPath: []string{"Venue"}, Reason: SkipNoGeometry},
+		{Name: "Lot", FolderPath: []string{"Venue"}, Reason: SkipInvalidCoords, CoordinatesRaw: "north,east"},
+	}
+	if !reflect.DeepEqual(result.Skipped, want) {
+		t.Errorf("Skipped = %+v\nwant %+v", result.Skipped, want)
+	}
+
+	counts := TallySkips(result.Skipped)
+	wantCounts := map[SkipReason]int{
+		SkipNoGeometry:        1,
+		SkipInvalidCoords:     1,
+		SkipEmptyName:         0,
+		SkipDegeneratePolygon: 1,
+		SkipInvalidGeometry:   0,
+	}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("TallySkips = %v, want %v", counts, wantCounts)
+	}
+}
+
+func TestSkipReasonGeometry(t *testing.T) {
+	for _, reason := range SkipReasons {
+		if got, want := reason.Geometry(), reason != SkipEmptyName; got != want {
+			t.Errorf("%s.Geometry() = %v, want %v", reason, got, want)
+		}
+	}
+}
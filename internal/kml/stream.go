@@ -0,0 +1,157 @@
+package kml
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrStop may be returned by a Decode callback to end parsing early without
+// an error.
+var ErrStop = errors.New("stop parsing")
+
+// Decode streams a KML document from r, calling emit with each importable
+// placemark as soon as its closing tag is read, so memory stays bounded by
+// the largest placemark rather than by the document. Styles, skips,
+// warnings, and network links are collected in the returned Result; its
+// Placemarks is empty. References to StyleMaps are resolved against the
+// StyleMaps defined earlier in the document. Decoding ends after opts.Limit
+// placemarks when it is set, or when emit returns ErrStop.
+func Decode(ctx context.Context, r io.Reader, opts Options, emit func(PlacemarkRecord) error) (*Result, error) {
+	p := newParser(opts)
+	return p.decode(ctx, r, func(pm PlacemarkRecord) error {
+		p.resolveStyleMap(&pm)
+		return emit(pm)
+	})
+}
+
+// folderFrame is an open <Folder> element. Its name is filled in when the
+// folder's own <name> child is read.
+type folderFrame struct {
+	depth int
+	name  string
+}
+
+// decode walks the document token by token. Placemarks, Styles, and
+// StyleMaps are unmarshalled one element at a time; Folders are tracked on a
+// stack to build each placemark's folder path.
+func (p *parser) decode(ctx context.Context, r io.Reader, emit func(PlacemarkRecord) error) (*Result, error) {
+	decoder := xml.NewDecoder(r)
+	var folders []folderFrame
+	depth := 0
+	emitted := 0
+	sawRoot := false
+
+	for tokens := 0; ; tokens++ {
+		if tokens%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse KML XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !sawRoot {
+				if err := checkRoot(t); err != nil {
+					return nil, err
+				}
+				sawRoot = true
+			}
+
+			switch t.Name.Local {
+			case "Placemark":
+				var pm Placemark
+				if err := decoder.DecodeElement(&pm, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse KML XML: %w", err)
+				}
+				record, ok := p.processPlacemark(pm, folderPath(folders))
+				if !ok {
+					continue
+				}
+				if err := emit(record); err != nil {
+					if errors.Is(err, ErrStop) {
+						return p.finish(), nil
+					}
+					return nil, err
+				}
+				if emitted++; p.opts.Limit > 0 && emitted >= p.opts.Limit {
+					return p.finish(), nil
+				}
+				continue
+			case "NetworkLink":
+				var nl NetworkLink
+				if err := decoder.DecodeElement(&nl, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse KML XML: %w", err)
+				}
+				if ref, ok := newLinkRef(nl, folderPath(folders)); ok {
+					p.result.NetworkLinks = append(p.result.NetworkLinks, ref)
+				}
+				continue
+			case "Style":
+				var style Style
+				if err := decoder.DecodeElement(&style, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse KML XML: %w", err)
+				}
+				p.result.Styles = append(p.result.Styles, style)
+				continue
+			case "StyleMap":
+				var sm StyleMap
+				if err := decoder.DecodeElement(&sm, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse KML XML: %w", err)
+				}
+				p.addStyleMap(sm)
+				continue
+			case "name":
+				if n := len(folders); n > 0 && folders[n-1].depth == depth {
+					var name string
+					if err := decoder.DecodeElement(&name, &t); err != nil {
+						return nil, fmt.Errorf("failed to parse KML XML: %w", err)
+					}
+					folders[n-1].name = name
+					continue
+				}
+			}
+
+			depth++
+			if t.Name.Local == "Folder" {
+				folders = append(folders, folderFrame{depth: depth})
+			}
+
+		case xml.EndElement:
+			if n := len(folders); n > 0 && folders[n-1].depth == depth {
+				folders = folders[:n-1]
+			}
+			depth--
+		}
+	}
+
+	if !sawRoot {
+		return nil, fmt.Errorf("not a KML file: no root element found")
+	}
+	return p.finish(), nil
+}
+
+// folderPath is the names of the open folders, outermost first.
+func folderPath(folders []folderFrame) []string {
+	path := make([]string, len(folders))
+	for i, f := range folders {
+		path[i] = f.name
+	}
+	return path
+}
+
+// finish completes the result once decoding stops.
+func (p *parser) finish() *Result {
+	p.result.HighlightStyles = p.highlights()
+	return &p.result
+}
@@ -0,0 +1,165 @@
+package kml
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const streamDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+  <name>Route 91</name>
+  <StyleMap id="gateMap">
+    <Pair><key>normal</key><styleUrl>#gate</styleUrl></Pair>
+    <Pair><key>highlight</key><styleUrl>#gateHover</styleUrl></Pair>
+  </StyleMap>
+  <Style id="gate"><IconStyle><scale>1.1</scale></IconStyle></Style>
+  <Placemark>
+    <name>Info</name>
+    <Point><coordinates>-115.170,36.090</coordinates></Point>
+  </Placemark>
+  <Folder>
+    <name>Venue</name>
+    <Placemark>
+      <name>Gate C</name>
+      <styleUrl>#gateMap</styleUrl>
+      <ExtendedData>
+        <Data name="capacity"><value>500</value></Data>
+        <Data name="gx_media_links"><value>https://example.com/gate.jpg</value></Data>
+      </ExtendedData>
+      <Point><coordinates>-115.171,36.091</coordinates></Point>
+    </Placemark>
+    <Folder>
+      <name>North</name>
+      <Placemark>
+        <name>Tower</name>
+        <Point><coordinates>-115.172,36.092</coordinates></Point>
+      </Placemark>
+    </Folder>
+    <Placemark>
+      <name>Stage</name>
+      <Point><coordinates>-115.173,36.093</coordinates></Point>
+    </Placemark>
+  </Folder>
+</Document>
+</kml>`
+
+func decodeAll(t *testing.T, doc string, opts Options) ([]PlacemarkRecord, *Result) {
+	t.Helper()
+	var records []PlacemarkRecord
+	result, err := Decode(context.Background(), strings.NewReader(doc), opts, func(pm PlacemarkRecord) error {
+		records = append(records, pm)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return records, result
+}
+
+func TestDecode(t *testing.T) {
+	records, result := decodeAll(t, streamDoc, Options{})
+
+	type placed struct {
+		Name   string
+		Folder []string
+		Style  string
+	}
+	var got []placed
+	for _, pm := range records {
+		got = append(got, placed{pm.Name, pm.FolderPath, pm.StyleID})
+	}
+	want := []placed{
+		{"Info", []string{}, ""},
+		{"Gate C", []string{"Venue"}, "gate"},
+		{"Tower", []string{"Venue", "North"}, ""},
+		{"Stage", []string{"Venue"}, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("placemarks = %+v\nwant %+v", got, want)
+	}
+
+	gate := records[1]
+	if !reflect.DeepEqual(gate.ExtendedData, map[string]string{"capacity": "500"}) {
+		t.Errorf("ExtendedData = %v", gate.ExtendedData)
+	}
+	if !reflect.DeepEqual(gate.MediaLinks, []string{"https://example.com/gate.jpg"}) {
+		t.Errorf("MediaLinks = %v", gate.MediaLinks)
+	}
+
+	if len(result.Placemarks) != 0 {
+		t.Errorf("Decode kept %d placemarks in the result", len(result.Placemarks))
+	}
+	if len(result.Styles) != 1 || result.Styles[0].ID != "gate" {
+		t.Errorf("Styles = %+v", result.Styles)
+	}
+	if !reflect.DeepEqual(result.HighlightStyles, map[string]string{"gate": "gateHover"}) {
+		t.Errorf("HighlightStyles = %v", result.HighlightStyles)
+	}
+}
+
+func TestDecodeStopsEarly(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		stop int // emit returns ErrStop on this placemark, counting from 1
+		want int
+	}{
+		{"limit", Options{Limit: 2}, 0, 2},
+		{"limit above count", Options{Limit: 10}, 0, 4},
+		{"ErrStop", Options{}, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emitted := 0
+			_, err := Decode(context.Background(), strings.NewReader(streamDoc), tt.opts, func(PlacemarkRecord) error {
+				emitted++
+				if emitted == tt.stop {
+					return ErrStop
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if emitted != tt.want {
+				t.Errorf("emitted %d placemarks, want %d", emitted, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	emitErr := errors.New("disk full")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		doc     string
+		emit    func(PlacemarkRecord) error
+		wantErr string
+	}{
+		{"not KML", context.Background(), `<html><body/></html>`, nil, "not a KML"},
+		{"empty", context.Background(), ``, nil, "no root element"},
+		{"malformed", context.Background(), `<kml><Document><Placemark><name>x</Placemark></kml>`, nil, "failed to parse KML XML"},
+		{"emit error", context.Background(), streamDoc, func(PlacemarkRecord) error { return emitErr }, "disk full"},
+		{"cancelled", cancelled, streamDoc, nil, "context canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emit := tt.emit
+			if emit == nil {
+				emit = func(PlacemarkRecord) error { return nil }
+			}
+			_, err := Decode(tt.ctx, strings.NewReader(tt.doc), Options{}, emit)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
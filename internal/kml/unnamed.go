@@ -0,0 +1,68 @@
+package kml
+
+import "fmt"
+
+// Policies for placemarks with empty names, as selected by the importer's
+// -unnamed flag.
+const (
+	UnnamedKeep       = "keep"
+	UnnamedSkip       = "skip"
+	UnnamedSynthesize = "synthesize"
+	UnnamedCoords     = "coords"
+)
+
+// ValidUnnamedMode reports whether mode is one of the Unnamed* policies.
+func ValidUnnamedMode(mode string) bool {
+	switch mode {
+	case UnnamedKeep, UnnamedSkip, UnnamedSynthesize, UnnamedCoords:
+		return true
+	}
+	return false
+}
+
+// ApplyUnnamedPolicy skips or renames placemarks with empty names according to
+// mode and returns the resulting records along with how many were affected and
+// which were skipped.
+func ApplyUnnamedPolicy(placemarks []PlacemarkRecord, mode string, opts Options) ([]PlacemarkRecord, int, []SkippedPlacemark) {
+	affected := 0
+	var skipped []SkippedPlacemark
+	counters := make(map[string]int)
+	result := placemarks[:0]
+
+	for _, pm := range placemarks {
+		if pm.Name != "" {
+			result = append(result, pm)
+			continue
+		}
+		affected++
+
+		switch mode {
+		case UnnamedSkip:
+			skipped = append(skipped, SkippedPlacemark{
+				Name:           pm.Name,
+				FolderPath:     pm.FolderPath,
+				Reason:         SkipEmptyName,
+				CoordinatesRaw: pm.CoordinatesRaw,
+			})
+			continue
+		case UnnamedSynthesize:
+			counters[pm.GeometryType]++
+			pm.Name = fmt.Sprintf("Unnamed %s #%d", pm.GeometryType, counters[pm.GeometryType])
+		case UnnamedCoords:
+			pm.Name = coordinateName(pm, opts)
+		}
+
+		result = append(result, pm)
+	}
+
+	return result, affected, skipped
+}
+
+// coordinateName derives a display name from the first coordinate of a placemark.
+func coordinateName(pm PlacemarkRecord, opts Options) string {
+	coords, _ := ParseCoordinateTuples(pm.CoordinatesRaw, opts)
+	if len(coords) == 0 {
+		return fmt.Sprintf("Unnamed %s", pm.GeometryType)
+	}
+	return fmt.Sprintf("%s at %.6f, %.6f", pm.GeometryType, coords[0][1], coords[0][0])
+}
@@ -0,0 +1,69 @@
+package kml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyUnnamedPolicy(t *testing.T) {
+	records := func() []PlacemarkRecord {
+		return []PlacemarkRecord{
+			{Name: "Gate C", GeometryType: "Point", CoordinatesRaw: "-115.17,36.09"},
+			{GeometryType: "Point", FolderPath: []string{"Venue"}, CoordinatesRaw: "-115.171,36.091"},
+			{GeometryType: "LineString", CoordinatesRaw: "-115.17,36.09 -115.16,36.10"},
+			{GeometryType: "Point", CoordinatesRaw: "-115.172,36.092"},
+			{GeometryType: "Polygon", CoordinatesRaw: ""},
+		}
+	}
+
+	tests := []struct {
+		mode        string
+		wantNames   []string
+		wantSkipped int
+	}{
+		{UnnamedKeep, []string{"Gate C", "", "", "", ""}, 0},
+		{UnnamedSkip, []string{"Gate C"}, 4},
+		{UnnamedSynthesize, []string{"Gate C", "Unnamed Point #1", "Unnamed LineString #1", "Unnamed Point #2", "Unnamed Polygon #1"}, 0},
+		{UnnamedCoords, []string{
+			"Gate C",
+			"Point at 36.091000, -115.171000",
+			"LineString at 36.090000, -115.170000",
+			"Point at 36.092000, -115.172000",
+			"Unnamed Polygon",
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if !ValidUnnamedMode(tt.mode) {
+				t.Fatalf("ValidUnnamedMode(%q) = false", tt.mode)
+			}
+			result, affected, skipped := ApplyUnnamedPolicy(records(), tt.mode, Options{})
+
+			var names []string
+			for _, pm := range result {
+				names = append(names, pm.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("names = %q, want %q", names, tt.wantNames)
+			}
+			if affected != 4 {
+				t.Errorf("affected = %d, want 4", affected)
+			}
+			if len(skipped) != tt.wantSkipped {
+				t.Fatalf("skipped %d, want %d", len(skipped), tt.wantSkipped)
+			}
+			for _, skip := range skipped {
+				if skip.Reason != SkipEmptyName {
+					t.Errorf("skip reason = %s, want %s", skip.Reason, SkipEmptyName)
+				}
+			}
+			if tt.wantSkipped > 0 && !reflect.DeepEqual(skipped[0].FolderPath, []string{"Venue"}) {
+				t.Errorf("first skip = %+v, want the Venue placemark", skipped[0])
+			}
+		})
+	}
+
+	if ValidUnnamedMode("drop") {
+		t.Error(`ValidUnnamedMode("drop") = true`)
+	}
+}
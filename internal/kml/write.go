@@ -0,0 +1,211 @@
+package kml
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer streams a KML document. Folders are opened and closed as the
+// folder path changes between placemarks, so placemarks should arrive
+// grouped by folder path; a path that comes back after being left opens a
+// second folder with the same name.
+type Writer struct {
+	enc  *xml.Encoder
+	open []string
+}
+
+var (
+	kmlStart      = xml.StartElement{Name: xml.Name{Local: "kml"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "http://www.opengis.net/kml/2.2"}}}
+	documentStart = xml.StartElement{Name: xml.Name{Local: "Document"}}
+	folderStart   = xml.StartElement{Name: xml.Name{Local: "Folder"}}
+	nameStart     = xml.StartElement{Name: xml.Name{Local: "name"}}
+)
+
+// NewWriter writes the KML header and opens a Document called name.
+func NewWriter(w io.Writer, name string) (*Writer, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	kw := &Writer{enc: xml.NewEncoder(w)}
+	kw.enc.Indent("", "  ")
+	if err := kw.enc.EncodeToken(kmlStart); err != nil {
+		return nil, err
+	}
+	if err := kw.enc.EncodeToken(documentStart); err != nil {
+		return nil, err
+	}
+	if err := kw.enc.EncodeElement(name, nameStart); err != nil {
+		return nil, err
+	}
+	return kw, nil
+}
+
+// WriteStyle writes a shared style. Styles should come before placemarks.
+func (w *Writer) WriteStyle(s Style) error {
+	return w.enc.Encode(s)
+}
+
+// WritePlacemark writes pm inside the folders named by folderPath.
+func (w *Writer) WritePlacemark(folderPath []string, pm Placemark) error {
+	common := 0
+	for common < len(w.open) && common < len(folderPath) && w.open[common] == folderPath[common] {
+		common++
+	}
+	if err := w.closeFolders(common); err != nil {
+		return err
+	}
+	for _, name := range folderPath[common:] {
+		if err := w.enc.EncodeToken(folderStart); err != nil {
+			return err
+		}
+		if err := w.enc.EncodeElement(name, nameStart); err != nil {
+			return err
+		}
+		w.open = append(w.open, name)
+	}
+	return w.enc.Encode(pm)
+}
+
+// closeFolders closes open folders until depth remain.
+func (w *Writer) closeFolders(depth int) error {
+	for len(w.open) > depth {
+		if err := w.enc.EncodeToken(folderStart.End()); err != nil {
+			return err
+		}
+		w.open = w.open[:len(w.open)-1]
+	}
+	return nil
+}
+
+// Close ends the document and flushes it. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if err := w.closeFolders(0); err != nil {
+		return err
+	}
+	if err := w.enc.EncodeToken(documentStart.End()); err != nil {
+		return err
+	}
+	if err := w.enc.EncodeToken(kmlStart.End()); err != nil {
+		return err
+	}
+	return w.enc.Close()
+}
+
+// geoJSONGeometry is the subset of a GeoJSON geometry SetGeoJSON reads.
+type geoJSONGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometries  []geoJSONGeometry `json:"geometries"`
+}
+
+// SetGeoJSON sets pm's geometry from a GeoJSON geometry, as stored
+// placemarks return it. Multi* types and GeometryCollections become a
+// MultiGeometry.
+func (pm *Placemark) SetGeoJSON(data []byte) error {
+	var g geoJSONGeometry
+	if err := json.Unmarshal(data, &g); err != nil {
+		return fmt.Errorf("invalid GeoJSON geometry: %w", err)
+	}
+
+	var mg MultiGeometry
+	if err := addGeoJSON(&mg, g); err != nil {
+		return err
+	}
+
+	pm.Point, pm.LineString, pm.Polygon, pm.MultiGeometry = nil, nil, nil, nil
+	switch g.Type {
+	case "Point":
+		pm.Point = &mg.Points[0]
+	case "LineString":
+		pm.LineString = &mg.LineStrings[0]
+	case "Polygon":
+		pm.Polygon = &mg.Polygons[0]
+	default:
+		pm.MultiGeometry = &mg
+	}
+	return nil
+}
+
+// addGeoJSON appends g's members to mg.
+func addGeoJSON(mg *MultiGeometry, g geoJSONGeometry) error {
+	var err error
+	switch g.Type {
+	case "Point":
+		var c []float64
+		if err = json.Unmarshal(g.Coordinates, &c); err == nil {
+			mg.Points = append(mg.Points, Point{Coordinates: coordinatesText([][]float64{c})})
+		}
+	case "MultiPoint", "LineString":
+		var cs [][]float64
+		if err = json.Unmarshal(g.Coordinates, &cs); err == nil {
+			if g.Type == "LineString" {
+				mg.LineStrings = append(mg.LineStrings, LineString{Coordinates: coordinatesText(cs)})
+			} else {
+				for _, c := range cs {
+					mg.Points = append(mg.Points, Point{Coordinates: coordinatesText([][]float64{c})})
+				}
+			}
+		}
+	case "MultiLineString", "Polygon":
+		var lines [][][]float64
+		if err = json.Unmarshal(g.Coordinates, &lines); err == nil {
+			if g.Type == "Polygon" {
+				mg.Polygons = append(mg.Polygons, polygonFromRings(lines))
+			} else {
+				for _, cs := range lines {
+					mg.LineStrings = append(mg.LineStrings, LineString{Coordinates: coordinatesText(cs)})
+				}
+			}
+		}
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err = json.Unmarshal(g.Coordinates, &polygons); err == nil {
+			for _, rings := range polygons {
+				mg.Polygons = append(mg.Polygons, polygonFromRings(rings))
+			}
+		}
+	case "GeometryCollection":
+		for _, member := range g.Geometries {
+			if err := addGeoJSON(mg, member); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported GeoJSON geometry type %q", g.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s coordinates: %w", g.Type, err)
+	}
+	return nil
+}
+
+func polygonFromRings(rings [][][]float64) Polygon {
+	var polygon Polygon
+	for i, ring := range rings {
+		lr := LinearRing{Coordinates: coordinatesText(ring)}
+		if i == 0 {
+			polygon.OuterBoundary.LinearRing = lr
+		} else {
+			polygon.InnerBoundary = append(polygon.InnerBoundary, InnerBoundary{LinearRing: lr})
+		}
+	}
+	return polygon
+}
+
+// coordinatesText formats positions as KML coordinate tuples.
+func coordinatesText(positions [][]float64) string {
+	tuples := make([]string, len(positions))
+	for i, pos := range positions {
+		parts := make([]string, len(pos))
+		for j, v := range pos {
+			parts[j] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		tuples[i] = strings.Join(parts, ",")
+	}
+	return strings.Join(tuples, " ")
+}
@@ -0,0 +1,133 @@
+package kml
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetGeoJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		geojson string
+		want    Placemark
+		wantErr string
+	}{
+		{
+			"point", `{"type":"Point","coordinates":[-115.17,36.09]}`,
+			Placemark{Point: &Point{Coordinates: "-115.17,36.09"}}, "",
+		},
+		{
+			"point with altitude", `{"type":"Point","coordinates":[-115.17,36.09,12.5]}`,
+			Placemark{Point: &Point{Coordinates: "-115.17,36.09,12.5"}}, "",
+		},
+		{
+			"line", `{"type":"LineString","coordinates":[[0,0],[1,1]]}`,
+			Placemark{LineString: &LineString{Coordinates: "0,0 1,1"}}, "",
+		},
+		{
+			"polygon with hole", `{"type":"Polygon","coordinates":[[[0,0],[4,0],[4,4],[0,0]],[[1,1],[2,1],[2,2],[1,1]]]}`,
+			Placemark{Polygon: &Polygon{
+				OuterBoundary: OuterBoundary{LinearRing: LinearRing{Coordinates: "0,0 4,0 4,4 0,0"}},
+				InnerBoundary: []InnerBoundary{{LinearRing: LinearRing{Coordinates: "1,1 2,1 2,2 1,1"}}},
+			}}, "",
+		},
+		{
+			"multipoint", `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`,
+			Placemark{MultiGeometry: &MultiGeometry{Points: []Point{{Coordinates: "0,0"}, {Coordinates: "1,1"}}}}, "",
+		},
+		{
+			"collection", `{"type":"GeometryCollection","geometries":[
+				{"type":"Point","coordinates":[0,0]},
+				{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3]]]}
+			]}`,
+			Placemark{MultiGeometry: &MultiGeometry{
+				Points:      []Point{{Coordinates: "0,0"}},
+				LineStrings: []LineString{{Coordinates: "0,0 1,1"}, {Coordinates: "2,2 3,3"}},
+			}}, "",
+		},
+		{"not JSON", `{`, Placemark{}, "invalid GeoJSON geometry"},
+		{"unknown type", `{"type":"Circle","coordinates":[0,0]}`, Placemark{}, "unsupported GeoJSON geometry type"},
+		{"bad coordinates", `{"type":"LineString","coordinates":[0,0]}`, Placemark{}, "invalid LineString coordinates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := Placemark{Point: &Point{Coordinates: "9,9"}}
+			err := pm.SetGeoJSON([]byte(tt.geojson))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SetGeoJSON error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetGeoJSON: %v", err)
+			}
+			if !reflect.DeepEqual(pm, tt.want) {
+				t.Errorf("placemark = %+v\nwant %+v", pm, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	placed := []struct {
+		folder []string
+		name   string
+	}{
+		{nil, "Info"},
+		{[]string{"Venue"}, "Gate C"},
+		{[]string{"Venue", "North"}, "Tower"},
+		{[]string{"Venue"}, "Stage"},
+		{[]string{"Parking"}, "Lot A"},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Route 91 & friends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteStyle(Style{ID: "gate", IconStyle: &IconStyle{Scale: 1.1}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range placed {
+		pm := Placemark{Name: p.name, Description: "<b>5 & 6</b>"}
+		if err := pm.SetGeoJSON([]byte(`{"type":"Point","coordinates":[-115.17,36.09]}`)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WritePlacemark(p.folder, pm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Parse(context.Background(), buf.Bytes(), Options{})
+	if err != nil {
+		t.Fatalf("written KML does not parse: %v\n%s", err, buf.String())
+	}
+	if len(result.Placemarks) != len(placed) {
+		t.Fatalf("parsed %d placemarks, want %d", len(result.Placemarks), len(placed))
+	}
+	for i, pm := range result.Placemarks {
+		folder := placed[i].folder
+		if folder == nil {
+			folder = []string{}
+		}
+		if pm.Name != placed[i].name || !reflect.DeepEqual(pm.FolderPath, folder) {
+			t.Errorf("placemark %d = %s in %v, want %s in %v", i, pm.Name, pm.FolderPath, placed[i].name, folder)
+		}
+		if pm.Description != "<b>5 & 6</b>" {
+			t.Errorf("description = %q", pm.Description)
+		}
+	}
+	if len(result.Styles) != 1 || result.Styles[0].ID != "gate" {
+		t.Errorf("styles = %+v", result.Styles)
+	}
+	if strings.Count(buf.String(), "<name>Venue</name>") != 1 {
+		t.Errorf("Venue folder was opened more than once:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,88 @@
+// Package sanitize cleans HTML taken from KML descriptions before it is
+// served to clients.
+package sanitize
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Mode selects how description HTML is returned.
+type Mode string
+
+const (
+	// ModeSafe keeps formatting, links, and images but removes scripts,
+	// event handlers, and other active content.
+	ModeSafe Mode = "safe"
+	// ModeText strips all markup, leaving plain text.
+	ModeText Mode = "text"
+	// ModeRaw returns the source HTML unchanged.
+	ModeRaw Mode = "raw"
+)
+
+// Description source formats, recorded per placemark at import.
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+)
+
+var (
+	safePolicy  = bluemonday.UGCPolicy()
+	stripPolicy = bluemonday.StrictPolicy()
+)
+
+// ParseMode parses a mode name. An empty string selects ModeSafe.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "":
+		return ModeSafe, nil
+	case ModeSafe, ModeText, ModeRaw:
+		return Mode(s), nil
+	}
+	return "", fmt.Errorf("description must be one of raw, text, or safe")
+}
+
+// Apply returns s processed according to mode.
+func Apply(mode Mode, s string) string {
+	switch mode {
+	case ModeRaw:
+		return s
+	case ModeText:
+		return Text(s)
+	default:
+		return HTML(s)
+	}
+}
+
+// ApplyFormat is Apply for a description stored in format. Markdown keeps
+// its line structure in safe mode: embedded HTML is stripped rather than
+// sanitized, so clients can hand the result to a Markdown renderer.
+func ApplyFormat(mode Mode, format, s string) string {
+	if format == FormatMarkdown && mode == ModeSafe {
+		return Markdown(s)
+	}
+	return Apply(mode, s)
+}
+
+// Markdown removes HTML tags from Markdown source. Entities the stripper
+// introduces are decoded, except &lt;, so no markup can reappear.
+func Markdown(s string) string {
+	return markdownUnescaper.Replace(stripPolicy.Sanitize(s))
+}
+
+var markdownUnescaper = strings.NewReplacer("&gt;", ">", "&#34;", `"`, "&#39;", "'", "&amp;", "&")
+
+// HTML runs s through an allowlist sanitizer.
+func HTML(s string) string {
+	return safePolicy.Sanitize(s)
+}
+
+// Text strips tags from s, decodes entities, and collapses whitespace.
+func Text(s string) string {
+	// Pad common block-level tags so words on either side don't merge.
+	s = strings.NewReplacer("<br", " <br", "<p", " <p", "<div", " <div", "<li", " <li").Replace(s)
+	return strings.Join(strings.Fields(html.UnescapeString(stripPolicy.Sanitize(s))), " ")
+}
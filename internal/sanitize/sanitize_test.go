@@ -0,0 +1,93 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+// maliciousDescriptions are XSS payloads of the kind KML descriptions can
+// carry.
+var maliciousDescriptions = []string{
+	`<p onclick="alert(1)">Hi <b>there</b></p><script>alert(1)</script>`,
+	`<a href="javascript:alert(1)">x</a>`,
+	`<A HREF="JaVaScRiPt:alert(1)">x</A>`,
+	`<img src="x" onerror="alert(1)">`,
+	`<iframe src="https://evil.example"></iframe>ok`,
+	`<svg onload="alert(1)"><script>alert(1)</script></svg>`,
+	`<div style="background:url(javascript:alert(1))">y</div>`,
+	`<object data="https://evil.example/x.swf"></object>`,
+	`<form action="https://evil.example"><input name="q"></form>`,
+	`<body onload="alert(1)">`,
+}
+
+func TestSafeRemovesActiveContent(t *testing.T) {
+	forbidden := []string{"<script", "javascript:", "onclick", "onerror", "onload", "<iframe", "<object", "<form", "style="}
+	for _, desc := range maliciousDescriptions {
+		t.Run(desc, func(t *testing.T) {
+			for _, got := range []string{HTML(desc), Markdown(desc), Text(desc)} {
+				lower := strings.ToLower(got)
+				for _, f := range forbidden {
+					if strings.Contains(lower, f) {
+						t.Errorf("output %q still contains %q", got, f)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestApplyFormat(t *testing.T) {
+	const html = `<p onclick="alert(1)">Hi <b>there</b></p><script>alert(1)</script>`
+	const markdown = "# Title\n\n<script>x</script>**bold** & <b>b</b>"
+
+	tests := []struct {
+		name   string
+		mode   Mode
+		format string
+		in     string
+		want   string
+	}{
+		{"safe html", ModeSafe, FormatHTML, html, "<p>Hi <b>there</b></p>"},
+		{"text html", ModeText, FormatHTML, html, "Hi there"},
+		{"raw html", ModeRaw, FormatHTML, html, html},
+		{"safe keeps links", ModeSafe, FormatHTML, `<a href="https://example.com">x</a>`, `<a href="https://example.com" rel="nofollow">x</a>`},
+		{"safe drops javascript links", ModeSafe, FormatHTML, `<a href="javascript:alert(1)">x</a>`, "x"},
+		{"text collapses blocks", ModeText, FormatHTML, "<p>one</p><p>two</p><br>three", "one two three"},
+		{"safe markdown", ModeSafe, FormatMarkdown, markdown, "# Title\n\n**bold** & b"},
+		{"text markdown", ModeText, FormatMarkdown, markdown, "# Title **bold** & b"},
+		{"raw markdown", ModeRaw, FormatMarkdown, markdown, markdown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ApplyFormat(tt.mode, tt.format, tt.in); got != tt.want {
+				t.Errorf("ApplyFormat(%s, %s) = %q, want %q", tt.mode, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{"", ModeSafe, false},
+		{"safe", ModeSafe, false},
+		{"text", ModeText, false},
+		{"raw", ModeRaw, false},
+		{"html", "", true},
+		{"SAFE", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMode(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+// Package shapefile writes ESRI Shapefiles (.shp/.shx/.dbf/.prj) from GeoJSON
+// geometries, bundled into a zip archive.
+package shapefile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ShapeType is the shape type code stored in .shp headers and records.
+type ShapeType int32
+
+const (
+	TypePoint      ShapeType = 1
+	TypePolyLine   ShapeType = 3
+	TypePolygon    ShapeType = 5
+	TypeMultiPoint ShapeType = 8
+)
+
+// DBF format limits. Field names longer than MaxFieldNameLength are
+// truncated and character values are cut at MaxCharLength bytes.
+const (
+	MaxFieldNameLength = 10
+	MaxCharLength      = 254
+)
+
+// prjWGS84 describes EPSG:4326, the SRID used for all stored geometries.
+const prjWGS84 = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+// Field is a character attribute column in the .dbf file.
+type Field struct {
+	Name   string
+	Length int
+}
+
+// Feature is a single record: a GeoJSON geometry plus one value per Field.
+type Feature struct {
+	Geometry string
+	Values   []string
+}
+
+type shape struct {
+	parts [][][2]float64
+}
+
+type layer struct {
+	shapeType ShapeType
+	shapes    []shape
+	values    [][]string
+}
+
+var layerSuffixes = map[ShapeType]string{
+	TypePoint:      "points",
+	TypeMultiPoint: "multipoints",
+	TypePolyLine:   "lines",
+	TypePolygon:    "polygons",
+}
+
+// WriteZip groups features by shape type, since a shapefile holds a single
+// type, and writes one <baseName>_<type> file set per group into a zip
+// written to w. Features with unsupported geometry types are skipped; the
+// number skipped is returned.
+func WriteZip(w io.Writer, baseName string, fields []Field, features []Feature) (int, error) {
+	layers := make(map[ShapeType]*layer)
+	skipped := 0
+
+	for _, f := range features {
+		shapeType, shp, err := fromGeoJSON(f.Geometry)
+		if err != nil || shp.numPoints() == 0 {
+			skipped++
+			continue
+		}
+
+		l, ok := layers[shapeType]
+		if !ok {
+			l = &layer{shapeType: shapeType}
+			layers[shapeType] = l
+		}
+		l.shapes = append(l.shapes, shp)
+		l.values = append(l.values, f.Values)
+	}
+
+	types := make([]ShapeType, 0, len(layers))
+	for t := range layers {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	zw := zip.NewWriter(w)
+	for _, t := range types {
+		name := fmt.Sprintf("%s_%s", baseName, layerSuffixes[t])
+		if err := writeLayer(zw, name, fields, layers[t]); err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, zw.Close()
+}
+
+func writeLayer(zw *zip.Writer, name string, fields []Field, l *layer) error {
+	var shp, shx bytes.Buffer
+	writeShapes(&shp, &shx, l)
+
+	var dbf bytes.Buffer
+	writeDBF(&dbf, fields, l.values)
+
+	files := []struct {
+		ext  string
+		data []byte
+	}{
+		{"shp", shp.Bytes()},
+		{"shx", shx.Bytes()},
+		{"dbf", dbf.Bytes()},
+		{"prj", []byte(prjWGS84)},
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(name + "." + file.ext)
+		if err != nil {
+			return fmt.Errorf("failed to create %s.%s: %w", name, file.ext, err)
+		}
+		if _, err := fw.Write(file.data); err != nil {
+			return fmt.Errorf("failed to write %s.%s: %w", name, file.ext, err)
+		}
+	}
+
+	return nil
+}
+
+// fromGeoJSON converts a GeoJSON geometry into a shape of the matching type.
+// Only the X/Y ordinates are kept.
+func fromGeoJSON(geojson string) (ShapeType, shape, error) {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(geojson), &g); err != nil {
+		return 0, shape{}, fmt.Errorf("invalid geometry: %w", err)
+	}
+
+	switch g.Type {
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil || len(c) < 2 {
+			return 0, shape{}, fmt.Errorf("invalid point coordinates")
+		}
+		return TypePoint, shape{parts: [][][2]float64{{{c[0], c[1]}}}}, nil
+	case "MultiPoint":
+		pts, err := decodePositions(g.Coordinates)
+		if err != nil {
+			return 0, shape{}, err
+		}
+		return TypeMultiPoint, shape{parts: [][][2]float64{pts}}, nil
+	case "LineString":
+		pts, err := decodePositions(g.Coordinates)
+		if err != nil {
+			return 0, shape{}, err
+		}
+		return TypePolyLine, shape{parts: [][][2]float64{pts}}, nil
+	case "MultiLineString", "Polygon":
+		var raw []json.RawMessage
+		if err := json.Unmarshal(g.Coordinates, &raw); err != nil {
+			return 0, shape{}, fmt.Errorf("invalid %s coordinates", g.Type)
+		}
+		var parts [][][2]float64
+		for i, r := range raw {
+			pts, err := decodePositions(r)
+			if err != nil {
+				return 0, shape{}, err
+			}
+			if g.Type == "Polygon" {
+				pts = orientRing(pts, i == 0)
+			}
+			parts = append(parts, pts)
+		}
+		if g.Type == "Polygon" {
+			return TypePolygon, shape{parts: parts}, nil
+		}
+		return TypePolyLine, shape{parts: parts}, nil
+	case "MultiPolygon":
+		var polys [][]json.RawMessage
+		if err := json.Unmarshal(g.Coordinates, &polys); err != nil {
+			return 0, shape{}, fmt.Errorf("invalid MultiPolygon coordinates")
+		}
+		var parts [][][2]float64
+		for _, rings := range polys {
+			for i, r := range rings {
+				pts, err := decodePositions(r)
+				if err != nil {
+					return 0, shape{}, err
+				}
+				parts = append(parts, orientRing(pts, i == 0))
+			}
+		}
+		return TypePolygon, shape{parts: parts}, nil
+	}
+
+	return 0, shape{}, fmt.Errorf("unsupported geometry type %q", g.Type)
+}
+
+func decodePositions(raw json.RawMessage) ([][2]float64, error) {
+	var coords [][]float64
+	if err := json.Unmarshal(raw, &coords); err != nil {
+		return nil, fmt.Errorf("invalid coordinates: %w", err)
+	}
+
+	pts := make([][2]float64, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("coordinate has fewer than two ordinates")
+		}
+		pts = append(pts, [2]float64{c[0], c[1]})
+	}
+	return pts, nil
+}
+
+// orientRing returns ring wound clockwise for outer rings and
+// counter-clockwise for holes, as the shapefile spec requires.
+func orientRing(ring [][2]float64, outer bool) [][2]float64 {
+	var area float64
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+
+	clockwise := area < 0
+	if clockwise == outer {
+		return ring
+	}
+
+	reversed := make([][2]float64, len(ring))
+	for i, p := range ring {
+		reversed[len(ring)-1-i] = p
+	}
+	return reversed
+}
+
+type bounds struct {
+	minX, minY, maxX, maxY float64
+}
+
+func newBounds() bounds {
+	return bounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+func (b *bounds) extend(o bounds) {
+	b.minX = math.Min(b.minX, o.minX)
+	b.minY = math.Min(b.minY, o.minY)
+	b.maxX = math.Max(b.maxX, o.maxX)
+	b.maxY = math.Max(b.maxY, o.maxY)
+}
+
+func (s shape) bounds() bounds {
+	b := newBounds()
+	for _, part := range s.parts {
+		for _, p := range part {
+			b.extend(bounds{p[0], p[1], p[0], p[1]})
+		}
+	}
+	return b
+}
+
+func (s shape) numPoints() int {
+	n := 0
+	for _, part := range s.parts {
+		n += len(part)
+	}
+	return n
+}
+
+// content encodes a record's contents (without the record header).
+func (s shape) content(t ShapeType) []byte {
+	var buf bytes.Buffer
+	le := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+
+	le(int32(t))
+	if t == TypePoint {
+		p := s.parts[0][0]
+		le(p[0])
+		le(p[1])
+		return buf.Bytes()
+	}
+
+	b := s.bounds()
+	le([4]float64{b.minX, b.minY, b.maxX, b.maxY})
+
+	if t != TypeMultiPoint {
+		le(int32(len(s.parts)))
+	}
+	le(int32(s.numPoints()))
+
+	if t != TypeMultiPoint {
+		offset := 0
+		for _, part := range s.parts {
+			le(int32(offset))
+			offset += len(part)
+		}
+	}
+
+	for _, part := range s.parts {
+		for _, p := range part {
+			le(p[0])
+			le(p[1])
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func writeShapes(shp, shx *bytes.Buffer, l *layer) {
+	total := newBounds()
+	contents := make([][]byte, len(l.shapes))
+	shpLen := 100
+	for i, s := range l.shapes {
+		contents[i] = s.content(l.shapeType)
+		shpLen += 8 + len(contents[i])
+		total.extend(s.bounds())
+	}
+	shxLen := 100 + 8*len(l.shapes)
+
+	writeHeader(shp, l.shapeType, shpLen, total)
+	writeHeader(shx, l.shapeType, shxLen, total)
+
+	offset := 100
+	for i, c := range contents {
+		binary.Write(shp, binary.BigEndian, int32(i+1))
+		binary.Write(shp, binary.BigEndian, int32(len(c)/2))
+		shp.Write(c)
+
+		binary.Write(shx, binary.BigEndian, int32(offset/2))
+		binary.Write(shx, binary.BigEndian, int32(len(c)/2))
+		offset += 8 + len(c)
+	}
+}
+
+// writeHeader writes the 100-byte header shared by .shp and .shx files.
+// Lengths are given in bytes and stored as 16-bit words.
+func writeHeader(buf *bytes.Buffer, t ShapeType, length int, b bounds) {
+	binary.Write(buf, binary.BigEndian, int32(9994))
+	buf.Write(make([]byte, 20))
+	binary.Write(buf, binary.BigEndian, int32(length/2))
+	binary.Write(buf, binary.LittleEndian, int32(1000))
+	binary.Write(buf, binary.LittleEndian, int32(t))
+	binary.Write(buf, binary.LittleEndian, [8]float64{b.minX, b.minY, b.maxX, b.maxY, 0, 0, 0, 0})
+}
+
+// writeDBF writes a dBASE III table with one character column per field.
+func writeDBF(buf *bytes.Buffer, fields []Field, values [][]string) {
+	recordLen := 1
+	for _, f := range fields {
+		recordLen += fieldLength(f)
+	}
+	headerLen := 32 + 32*len(fields) + 1
+
+	now := time.Now()
+	buf.WriteByte(0x03)
+	buf.Write([]byte{byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())})
+	binary.Write(buf, binary.LittleEndian, uint32(len(values)))
+	binary.Write(buf, binary.LittleEndian, uint16(headerLen))
+	binary.Write(buf, binary.LittleEndian, uint16(recordLen))
+	buf.Write(make([]byte, 20))
+
+	for _, f := range fields {
+		name := make([]byte, 11)
+		copy(name, truncateBytes(strings.ToUpper(f.Name), MaxFieldNameLength))
+		buf.Write(name)
+		buf.WriteByte('C')
+		buf.Write(make([]byte, 4))
+		buf.WriteByte(byte(fieldLength(f)))
+		buf.WriteByte(0)
+		buf.Write(make([]byte, 14))
+	}
+	buf.WriteByte(0x0D)
+
+	for _, row := range values {
+		buf.WriteByte(' ')
+		for i, f := range fields {
+			var v string
+			if i < len(row) {
+				v = row[i]
+			}
+			n := fieldLength(f)
+			v = truncateBytes(v, n)
+			buf.WriteString(v)
+			buf.Write(bytes.Repeat([]byte{' '}, n-len(v)))
+		}
+	}
+	buf.WriteByte(0x1A)
+}
+
+func fieldLength(f Field) int {
+	if f.Length <= 0 || f.Length > MaxCharLength {
+		return MaxCharLength
+	}
+	return f.Length
+}
+
+// truncateBytes shortens s to at most n bytes without splitting a UTF-8
+// sequence.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,172 @@
+package shapefile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFromGeoJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		geojson   string
+		wantType  ShapeType
+		wantParts [][][2]float64
+		wantErr   bool
+	}{
+		{"point", `{"type":"Point","coordinates":[-115.17,36.09,12]}`, TypePoint, [][][2]float64{{{-115.17, 36.09}}}, false},
+		{"multipoint", `{"type":"MultiPoint","coordinates":[[0,0],[1,1]]}`, TypeMultiPoint, [][][2]float64{{{0, 0}, {1, 1}}}, false},
+		{"line", `{"type":"LineString","coordinates":[[0,0],[1,1]]}`, TypePolyLine, [][][2]float64{{{0, 0}, {1, 1}}}, false},
+		{"multiline", `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3]]]}`, TypePolyLine,
+			[][][2]float64{{{0, 0}, {1, 1}}, {{2, 2}, {3, 3}}}, false},
+		{
+			// GeoJSON winds outer rings counter-clockwise; shapefiles want
+			// them clockwise and holes the other way.
+			"polygon rewound", `{"type":"Polygon","coordinates":[[[0,0],[4,0],[4,4],[0,0]],[[1,1],[1,2],[2,2],[1,1]]]}`, TypePolygon,
+			[][][2]float64{{{0, 0}, {4, 4}, {4, 0}, {0, 0}}, {{1, 1}, {2, 2}, {1, 2}, {1, 1}}}, false,
+		},
+		{
+			"multipolygon", `{"type":"MultiPolygon","coordinates":[[[[0,0],[0,1],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}`, TypePolygon,
+			[][][2]float64{{{0, 0}, {0, 1}, {1, 1}, {0, 0}}, {{5, 5}, {6, 6}, {6, 5}, {5, 5}}}, false,
+		},
+		{"collection", `{"type":"GeometryCollection","geometries":[]}`, 0, nil, true},
+		{"short point", `{"type":"Point","coordinates":[1]}`, 0, nil, true},
+		{"short position", `{"type":"LineString","coordinates":[[0,0],[1]]}`, 0, nil, true},
+		{"not JSON", `{`, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shapeType, shp, err := fromGeoJSON(tt.geojson)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("fromGeoJSON accepted %s", tt.geojson)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fromGeoJSON: %v", err)
+			}
+			if shapeType != tt.wantType {
+				t.Errorf("type = %d, want %d", shapeType, tt.wantType)
+			}
+			if !reflect.DeepEqual(shp.parts, tt.wantParts) {
+				t.Errorf("parts = %v\nwant %v", shp.parts, tt.wantParts)
+			}
+		})
+	}
+}
+
+func TestTruncateBytes(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Gate C", 10, "Gate C"},
+		{"Mandalay Bay", 8, "Mandalay"},
+		{"Café", 4, "Caf"},
+		{"Café", 5, "Café"},
+		{"日本", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateBytes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateBytes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	fields := []Field{{Name: "name", Length: 8}, {Name: "description_text"}}
+	features := []Feature{
+		{Geometry: `{"type":"Point","coordinates":[-115.17,36.09]}`, Values: []string{"Gate C", "North entrance"}},
+		{Geometry: `{"type":"LineString","coordinates":[[0,0],[1,1],[2,0]]}`, Values: []string{"Mandalay Bay Road"}},
+		{Geometry: `{"type":"Point","coordinates":[-115.16,36.10]}`, Values: []string{"Tower", ""}},
+		{Geometry: `{"type":"GeometryCollection","geometries":[]}`, Values: []string{"skipped"}},
+		{Geometry: `{"type":"LineString","coordinates":[]}`, Values: []string{"empty"}},
+	}
+
+	var buf bytes.Buffer
+	skipped, err := WriteZip(&buf, "placemarks", fields, features)
+	if err != nil {
+		t.Fatalf("WriteZip: %v", err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	files := make(map[string][]byte)
+	var names []string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = data
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	wantNames := []string{
+		"placemarks_lines.dbf", "placemarks_lines.prj", "placemarks_lines.shp", "placemarks_lines.shx",
+		"placemarks_points.dbf", "placemarks_points.prj", "placemarks_points.shp", "placemarks_points.shx",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("archive holds %v, want %v", names, wantNames)
+	}
+
+	shp, shx := files["placemarks_points.shp"], files["placemarks_points.shx"]
+	if code := binary.BigEndian.Uint32(shp[0:4]); code != 9994 {
+		t.Errorf(".shp file code = %d, want 9994", code)
+	}
+	if words := binary.BigEndian.Uint32(shp[24:28]); int(words)*2 != len(shp) {
+		t.Errorf(".shp header length = %d bytes, file is %d", words*2, len(shp))
+	}
+	if st := binary.LittleEndian.Uint32(shp[32:36]); ShapeType(st) != TypePoint {
+		t.Errorf(".shp shape type = %d, want %d", st, TypePoint)
+	}
+	// Two point records of 8 bytes of header and 20 of content.
+	if len(shp) != 100+2*28 {
+		t.Errorf(".shp is %d bytes, want %d", len(shp), 100+2*28)
+	}
+	if len(shx) != 100+2*8 {
+		t.Errorf(".shx is %d bytes, want %d", len(shx), 100+2*8)
+	}
+	if offset := binary.BigEndian.Uint32(shx[108:112]); offset*2 != 100+28 {
+		t.Errorf("second .shx offset = %d bytes, want %d", offset*2, 100+28)
+	}
+
+	dbf := files["placemarks_points.dbf"]
+	if records := binary.LittleEndian.Uint32(dbf[4:8]); records != 2 {
+		t.Errorf(".dbf records = %d, want 2", records)
+	}
+	recordLen := int(binary.LittleEndian.Uint16(dbf[10:12]))
+	if recordLen != 1+8+MaxCharLength {
+		t.Errorf(".dbf record length = %d, want %d", recordLen, 1+8+MaxCharLength)
+	}
+	if name := string(bytes.TrimRight(dbf[64:75], "\x00")); name != "DESCRIPTIO" {
+		t.Errorf("second field name = %q, want DESCRIPTIO", name)
+	}
+	headerLen := int(binary.LittleEndian.Uint16(dbf[8:10]))
+	first := string(dbf[headerLen : headerLen+recordLen])
+	if first[:9] != " Gate C  " || !bytes.HasPrefix([]byte(first[9:]), []byte("North entrance ")) {
+		t.Errorf("first record = %q", first)
+	}
+	if dbf[len(dbf)-1] != 0x1A {
+		t.Error(".dbf is missing its end-of-file marker")
+	}
+
+	lines := files["placemarks_lines.dbf"]
+	headerLen = int(binary.LittleEndian.Uint16(lines[8:10]))
+	if got := string(lines[headerLen+1 : headerLen+9]); got != "Mandalay" {
+		t.Errorf("line name = %q, want it cut to the field's 8 bytes", got)
+	}
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/onnwee/mandalay/internal/cache"
+)
+
+// ChangesChannel is the Postgres NOTIFY channel signalled whenever placemark
+// data is replaced in bulk, e.g. at the end of an import.
+const ChangesChannel = "placemarks_changed"
+
+// EnableDetailCache puts an LRU cache of the given size in front of GetByID.
+// A size of zero or less leaves caching disabled. With a positive ttl,
+// entries are refetched once they are that old, which bounds staleness from
+// writes the change listener doesn't see.
+func (s *PlacemarkStore) EnableDetailCache(size int, ttl time.Duration) {
+	if size <= 0 {
+		s.detailCache = nil
+		return
+	}
+	s.detailCache = cache.NewLRUWithTTL[int, Placemark](size, ttl)
+}
+
+// DetailCacheStats returns hit/miss counters for the detail cache, or nil
+// when caching is disabled.
+func (s *PlacemarkStore) DetailCacheStats() *cache.Stats {
+	if s.detailCache == nil {
+		return nil
+	}
+	stats := s.detailCache.Stats()
+	return &stats
+}
+
+// InvalidatePlacemark drops a single placemark from the detail cache.
+func (s *PlacemarkStore) InvalidatePlacemark(id int) {
+	if s.detailCache != nil {
+		s.detailCache.Remove(id)
+	}
+}
+
+// PurgeCaches drops all cached placemark data.
+func (s *PlacemarkStore) PurgeCaches() {
+	if s.detailCache != nil {
+		s.detailCache.Purge()
+	}
+	s.geometryReport.Clear()
+	s.dataKeys.Clear()
+	s.folderHulls.Purge()
+}
+
+// ListenForChanges purges caches whenever a notification arrives on
+// ChangesChannel. It blocks until ctx is cancelled, reconnecting on errors.
+func (s *PlacemarkStore) ListenForChanges(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := s.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Change listener error: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+func (s *PlacemarkStore) listen(ctx context.Context) error {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+ChangesChannel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", ChangesChannel, err)
+	}
+
+	// Anything cached before LISTEN took effect may be stale.
+	s.PurgeCaches()
+
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			return err
+		}
+		s.PurgeCaches()
+	}
+}
+
+// NotifyChanges signals listening API servers that placemark data changed.
+func NotifyChanges(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, "SELECT pg_notify($1, '')", ChangesChannel)
+	return err
+}
+
+// clonePlacemark deep-copies p so cached values are never shared with callers.
+func clonePlacemark(p *Placemark) *Placemark {
+	c := *p
+	if p.StyleID != nil {
+		styleID := *p.StyleID
+		c.StyleID = &styleID
+	}
+	if p.Timestamp != nil {
+		ts := *p.Timestamp
+		c.Timestamp = &ts
+	}
+	if p.EndTimestamp != nil {
+		ts := *p.EndTimestamp
+		c.EndTimestamp = &ts
+	}
+	c.FolderPath = slices.Clone(p.FolderPath)
+	c.MediaLinks = slices.Clone(p.MediaLinks)
+	c.Media = slices.Clone(p.Media)
+	c.TrackTimes = slices.Clone(p.TrackTimes)
+	c.ExtendedData = slices.Clone(p.ExtendedData)
+	return &c
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// clusterCellsPerTile is how many grid cells GetClusters fits across one
+// 256-pixel web map tile, so each cell is about 64 pixels wide at any zoom.
+const clusterCellsPerTile = 4
+
+// MaxClusterZoom is the deepest zoom level GetClusters accepts.
+const MaxClusterZoom = 22
+
+// Cluster is a group of placemarks that fall in the same grid cell at a zoom
+// level. Center is the centroid of their locations. ID is only set when the
+// cluster holds a single placemark, so the client can link to it directly.
+type Cluster struct {
+	Center Point `json:"center"`
+	Count  int   `json:"count"`
+	ID     *int  `json:"id,omitempty"`
+}
+
+// ClusterCellSize is the grid cell size in degrees GetClusters uses at zoom.
+func ClusterCellSize(zoom int) float64 {
+	return 360 / math.Exp2(float64(zoom)) / clusterCellsPerTile
+}
+
+// GetClusters groups the placemarks inside bbox by snapping their locations
+// (the centroid, for non-point geometries) to a grid sized for zoom, and
+// returns one cluster per occupied cell, largest first.
+func (s *PlacemarkStore) GetClusters(ctx context.Context, bbox BoundingBox, zoom int) ([]Cluster, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT ST_X(ST_Centroid(ST_Collect(location))), ST_Y(ST_Centroid(ST_Collect(location))),
+		       COUNT(*), CASE WHEN COUNT(*) = 1 THEN MIN(id) END
+		FROM (
+			SELECT id, ST_Centroid(geom) AS location
+			FROM placemarks
+			WHERE ST_Intersects(geom, ST_MakeEnvelope($1, $2, $3, $4, 4326))
+		) p
+		GROUP BY ST_SnapToGrid(location, $5)
+		ORDER BY COUNT(*) DESC, MIN(id)
+	`, bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat, ClusterCellSize(zoom))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query clusters: %w", err)
+	}
+	defer rows.Close()
+
+	clusters := []Cluster{}
+	for rows.Next() {
+		var c Cluster
+		if err := rows.Scan(&c.Center.Lon, &c.Center.Lat, &c.Count, &c.ID); err != nil {
+			return nil, fmt.Errorf("failed to scan cluster: %w", err)
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, rows.Err()
+}
@@ -0,0 +1,20 @@
+package store
+
+import "testing"
+
+func TestClusterCellSize(t *testing.T) {
+	tests := []struct {
+		zoom int
+		want float64
+	}{
+		{0, 90},
+		{1, 45},
+		{4, 5.625},
+		{MaxClusterZoom, 360.0 / (1 << MaxClusterZoom) / 4},
+	}
+	for _, tt := range tests {
+		if got := ClusterCellSize(tt.zoom); got != tt.want {
+			t.Errorf("ClusterCellSize(%d) = %v, want %v", tt.zoom, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// DataKey is an extended-data key and how many values it has across all
+// placemarks.
+type DataKey struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// ListDataKeys returns the distinct extended-data keys, most used first and
+// then by key. Results are cached briefly since this scans placemark_data.
+func (s *PlacemarkStore) ListDataKeys(ctx context.Context) ([]DataKey, error) {
+	if keys, ok := s.dataKeys.Get(); ok {
+		return keys, nil
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT key, COUNT(*)
+		FROM placemark_data
+		WHERE key IS NOT NULL
+		GROUP BY key
+		ORDER BY COUNT(*) DESC, key
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []DataKey{}
+	for rows.Next() {
+		var k DataKey
+		if err := rows.Scan(&k.Key, &k.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan data key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read data keys: %w", err)
+	}
+
+	s.dataKeys.Set(keys)
+	return keys, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DistanceUnit is a unit distances can be reported in. Every distance the
+// store computes is in meters; callers convert with FromMeters.
+type DistanceUnit string
+
+const (
+	Meters     DistanceUnit = "m"
+	Kilometers DistanceUnit = "km"
+	Miles      DistanceUnit = "mi"
+)
+
+const metersPerMile = 1609.344
+
+// ParseDistanceUnit parses a unit name. An empty string selects Meters.
+func ParseDistanceUnit(s string) (DistanceUnit, error) {
+	switch DistanceUnit(s) {
+	case "":
+		return Meters, nil
+	case Meters, Kilometers, Miles:
+		return DistanceUnit(s), nil
+	}
+	return "", fmt.Errorf("units must be one of m, km, or mi")
+}
+
+// FromMeters converts a distance in meters to u.
+func (u DistanceUnit) FromMeters(meters float64) float64 {
+	switch u {
+	case Kilometers:
+		return meters / 1000
+	case Miles:
+		return meters / metersPerMile
+	default:
+		return meters
+	}
+}
+
+// GetDistance returns the geodesic distance in meters between two
+// placemarks' geometries, and false if either does not exist.
+//
+// Geometries are stored in SRID 4326, where ST_Distance on geometry returns
+// degrees. Casting to geography gives meters on the WGS84 spheroid; any new
+// distance query should do the same.
+func (s *PlacemarkStore) GetDistance(ctx context.Context, fromID, toID int) (float64, bool, error) {
+	var meters float64
+	err := s.db.QueryRow(ctx, `
+		SELECT ST_Distance(a.geom::geography, b.geom::geography)
+		FROM placemarks a, placemarks b
+		WHERE a.id = $1 AND b.id = $2
+	`, fromID, toID).Scan(&meters)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to compute distance: %w", err)
+	}
+	return meters, true, nil
+}
+
+// NearbyPlacemark is a placemark with its distance from a query point.
+type NearbyPlacemark struct {
+	Placemark
+	DistanceMeters float64 `json:"distance_meters"`
+}
+
+// GetNearby returns up to limit placemarks within radiusMeters of (lon, lat),
+// nearest first, ties broken by id. Distances are to the nearest point of
+// each geometry, so a line or polygon counts as near when any part of it is.
+func (s *PlacemarkStore) GetNearby(ctx context.Context, lon, lat, radiusMeters float64, limit int) ([]NearbyPlacemark, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+placemarkColumns+`, ST_Distance(geom::geography, pt) AS distance
+		FROM placemarks, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography AS pt
+		WHERE ST_DWithin(geom::geography, pt, $3)
+		ORDER BY distance, id
+		LIMIT $4
+	`, lon, lat, radiusMeters, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query nearby placemarks: %w", err)
+	}
+	defer rows.Close()
+
+	var nearby []NearbyPlacemark
+	for rows.Next() {
+		var n NearbyPlacemark
+		if err := rows.Scan(append(placemarkScanTargets(&n.Placemark), &n.DistanceMeters)...); err != nil {
+			return nil, fmt.Errorf("failed to scan nearby placemark: %w", err)
+		}
+		fillDerived(&n.Placemark)
+		nearby = append(nearby, n)
+	}
+
+	return nearby, rows.Err()
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseDistanceUnit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DistanceUnit
+		wantErr bool
+	}{
+		{"", Meters, false},
+		{"m", Meters, false},
+		{"km", Kilometers, false},
+		{"mi", Miles, false},
+		{"ft", "", true},
+		{"KM", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDistanceUnit(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDistanceUnit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDistanceUnit(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistanceUnitFromMeters(t *testing.T) {
+	tests := []struct {
+		unit DistanceUnit
+		want float64
+	}{
+		{Meters, 1609.344},
+		{Kilometers, 1.609344},
+		{Miles, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.unit), func(t *testing.T) {
+			if got := tt.unit.FromMeters(1609.344); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("FromMeters = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
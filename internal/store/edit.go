@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Create inserts p with its extended data in one transaction and sets p.ID.
+// p.Geometry is a GeoJSON geometry in WGS 84; geometry_type is derived from
+// it. Source, thumbnail, TrackTimes, and timestamps other than Timestamp and
+// EndTimestamp are ignored.
+func (s *PlacemarkStore) Create(ctx context.Context, p *Placemark) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin create: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	err = tx.QueryRow(ctx, `
+		WITH g AS (SELECT ST_SetSRID(ST_GeomFromGeoJSON($6), 4326) AS geom)
+		INSERT INTO placemarks
+		(name, description, description_format, style_id, folder_path, geometry_type, geom,
+		 coordinates_raw, gx_media_links, time_begin, time_end)
+		SELECT $1, $2, $3, $4, $5, substr(ST_GeometryType(g.geom), 4), g.geom, '', $7, $8, $9
+		FROM g
+		RETURNING id
+	`, p.Name, p.Description, p.DescriptionFormat, p.StyleID, p.FolderPath, p.Geometry,
+		p.MediaLinks, p.Timestamp, p.EndTimestamp).Scan(&p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert placemark: %w", err)
+	}
+
+	if err := insertExtendedData(ctx, tx, p.ID, p.ExtendedData); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit create: %w", err)
+	}
+
+	s.geometryReport.Clear()
+	s.dataKeys.Clear()
+	s.folderHulls.Purge()
+	return nil
+}
+
+// Update replaces placemark id's editable fields with p's, as Create
+// describes them, and replaces its extended data in the same transaction.
+// Any gx:Track times are cleared, since they belonged to the old geometry,
+// as is the description_raw kept by the importer's -description-mode.
+// When ifVersion is set the update only applies at that version, otherwise
+// ErrVersionMismatch is returned. It returns ErrPlacemarkNotFound if the
+// placemark does not exist.
+func (s *PlacemarkStore) Update(ctx context.Context, id int, p *Placemark, ifVersion *int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin update: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	tag, err := tx.Exec(ctx, `
+		WITH g AS (SELECT ST_SetSRID(ST_GeomFromGeoJSON($7), 4326) AS geom)
+		UPDATE placemarks SET
+			name = $2, description = $3, description_format = $4, style_id = $5, folder_path = $6,
+			geometry_type = substr(ST_GeometryType(g.geom), 4), geom = g.geom, coordinates_raw = '',
+			gx_media_links = $8, time_begin = $9, time_end = $10, track_times = NULL,
+			description_raw = NULL
+		FROM g
+		WHERE id = $1 AND ($11::bigint IS NULL OR version = $11)
+	`, id, p.Name, p.Description, p.DescriptionFormat, p.StyleID, p.FolderPath, p.Geometry,
+		p.MediaLinks, p.Timestamp, p.EndTimestamp, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to update placemark: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return s.updateMissError(ctx, id, ifVersion)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM placemark_data WHERE placemark_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to clear extended data: %w", err)
+	}
+	if err := insertExtendedData(ctx, tx, id, p.ExtendedData); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit update: %w", err)
+	}
+
+	s.InvalidatePlacemark(id)
+	s.geometryReport.Clear()
+	s.dataKeys.Clear()
+	s.folderHulls.Purge()
+	return nil
+}
+
+func insertExtendedData(ctx context.Context, tx pgx.Tx, id int, data []KVPair) error {
+	if len(data) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, len(data))
+	for i, kv := range data {
+		rows[i] = []interface{}{id, kv.Key, kv.Value}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"placemark_data"},
+		[]string{"placemark_id", "key", "value"}, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to insert extended data: %w", err)
+	}
+	return nil
+}
+
+// PatchExtendedData applies a partial update to placemark id's extended
+// data in one transaction: every key in del is removed, then each key in
+// set is written, replacing any existing values under that key. It bumps
+// the placemark's version and returns the resulting extended data, ordered
+// by key, with the new version. When ifVersion is set the patch only applies at that version,
+// otherwise ErrVersionMismatch is returned. It returns ErrPlacemarkNotFound
+// if the placemark does not exist.
+func (s *PlacemarkStore) PatchExtendedData(ctx context.Context, id int, set map[string]string, del []string, ifVersion *int64) ([]KVPair, int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to begin extended data patch: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	// Touching the row locks it for the patch and takes a new version.
+	var version int64
+	err = tx.QueryRow(ctx, `
+		UPDATE placemarks SET updated_at = NOW()
+		WHERE id = $1 AND ($2::bigint IS NULL OR version = $2)
+		RETURNING version
+	`, id, ifVersion).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, s.updateMissError(ctx, id, ifVersion)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to lock placemark: %w", err)
+	}
+
+	keys := make([]string, 0, len(del)+len(set))
+	keys = append(keys, del...)
+	data := make([]KVPair, 0, len(set))
+	for k, v := range set {
+		keys = append(keys, k)
+		data = append(data, KVPair{Key: k, Value: v})
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM placemark_data WHERE placemark_id = $1 AND key = ANY($2)`, id, keys); err != nil {
+		return nil, 0, fmt.Errorf("failed to delete extended data: %w", err)
+	}
+	if err := insertExtendedData(ctx, tx, id, data); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT key, value FROM placemark_data WHERE placemark_id = $1 ORDER BY key, id`, id)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read extended data: %w", err)
+	}
+	result := []KVPair{}
+	for rows.Next() {
+		var kv KVPair
+		if err := rows.Scan(&kv.Key, &kv.Value); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("failed to scan extended data: %w", err)
+		}
+		result = append(result, kv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read extended data: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, fmt.Errorf("failed to commit extended data patch: %w", err)
+	}
+
+	s.InvalidatePlacemark(id)
+	s.dataKeys.Clear()
+	return result, version, nil
+}
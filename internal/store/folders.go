@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FolderNode is one folder in the tree rebuilt from placemarks'
+// folder_path arrays. Folders are identified by their full path, so
+// same-named folders under different parents are separate nodes.
+type FolderNode struct {
+	Name string   `json:"name"`
+	Path []string `json:"path"`
+	// Count is how many placemarks are filed directly in this folder;
+	// Total adds those in every subfolder.
+	Count    int           `json:"count"`
+	Total    int           `json:"total"`
+	Children []*FolderNode `json:"children"`
+}
+
+// GetFolderTree returns the folder hierarchy as a root node with an empty
+// name and path, whose Count is the placemarks in no folder and whose Total
+// is every placemark. Children are sorted by name at each level.
+func (s *PlacemarkStore) GetFolderTree(ctx context.Context) (*FolderNode, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT COALESCE(folder_path, '{}'), COUNT(*)
+		FROM placemarks
+		GROUP BY 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query folder paths: %w", err)
+	}
+	defer rows.Close()
+
+	root := &FolderNode{Path: []string{}, Children: []*FolderNode{}}
+	for rows.Next() {
+		var path []string
+		var count int
+		if err := rows.Scan(&path, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan folder path: %w", err)
+		}
+		root.add(path, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query folder paths: %w", err)
+	}
+
+	root.sort()
+	return root, nil
+}
+
+// add files count placemarks under path below n, creating folders as
+// needed.
+func (n *FolderNode) add(path []string, count int) {
+	node := n
+	node.Total += count
+	for i, name := range path {
+		var child *FolderNode
+		for _, c := range node.Children {
+			if c.Name == name {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			child = &FolderNode{Name: name, Path: slices.Clone(path[:i+1]), Children: []*FolderNode{}}
+			node.Children = append(node.Children, child)
+		}
+		node = child
+		node.Total += count
+	}
+	node.Count += count
+}
+
+func (n *FolderNode) sort() {
+	slices.SortFunc(n.Children, func(a, b *FolderNode) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// GetFolderBounds returns the extent of the placemarks filed under folder at
+// any depth, or nil if the folder has none.
+func (s *PlacemarkStore) GetFolderBounds(ctx context.Context, folder string) (*BoundingBox, error) {
+	return s.queryExtent(ctx, `WHERE $1 = ANY(folder_path)`, folder)
+}
+
+// queryExtent returns the ST_Extent of the placemarks matching where (an
+// SQL WHERE clause, or "" for all of them), or nil when none match.
+func (s *PlacemarkStore) queryExtent(ctx context.Context, where string, args ...interface{}) (*BoundingBox, error) {
+	var minLon, minLat, maxLon, maxLat *float64
+	err := s.db.QueryRow(ctx, `
+		SELECT ST_XMin(extent), ST_YMin(extent), ST_XMax(extent), ST_YMax(extent)
+		FROM (SELECT ST_Extent(geom) AS extent FROM placemarks `+where+`) e
+	`, args...).Scan(&minLon, &minLat, &maxLon, &maxLat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute extent: %w", err)
+	}
+	if minLon == nil || minLat == nil || maxLon == nil || maxLat == nil {
+		return nil, nil
+	}
+	return &BoundingBox{MinLon: *minLon, MinLat: *minLat, MaxLon: *maxLon, MaxLat: *maxLat}, nil
+}
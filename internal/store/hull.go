@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// folderHullCacheSize bounds how many folder hulls are kept in memory.
+const folderHullCacheSize = 256
+
+// FolderHull is the convex hull of every geometry in a folder.
+type FolderHull struct {
+	Folder string `json:"folder"`
+	// Count is how many placemarks contributed to the hull.
+	Count int `json:"count"`
+	// Geometry is GeoJSON. It is a Point or LineString when the folder's
+	// geometries are fewer than three distinct points or collinear.
+	Geometry string `json:"geometry"`
+}
+
+// GetFolderHull returns the convex hull of the placemarks filed under folder
+// at any depth, or nil if the folder has none. Hulls are cached until the
+// next import or edit purges the caches.
+func (s *PlacemarkStore) GetFolderHull(ctx context.Context, folder string) (*FolderHull, error) {
+	if hull, ok := s.folderHulls.Get(folder); ok {
+		return &hull, nil
+	}
+
+	var count int
+	var geometry *string
+	err := s.db.QueryRow(ctx, `
+		SELECT COUNT(*), ST_AsGeoJSON(ST_ConvexHull(ST_Collect(geom)))
+		FROM placemarks
+		WHERE $1 = ANY(folder_path)
+	`, folder).Scan(&count, &geometry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute folder hull: %w", err)
+	}
+	if count == 0 || geometry == nil {
+		return nil, nil
+	}
+
+	hull := FolderHull{Folder: folder, Count: count, Geometry: *geometry}
+	s.folderHulls.Add(folder, hull)
+	return &hull, nil
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/onnwee/mandalay/internal/kml"
+)
+
+// ImportRun is the audit record written at the end of each import.
+type ImportRun struct {
+	ID         int                    `json:"id"`
+	KMLPath    string                 `json:"kml_path"`
+	Source     *string                `json:"source,omitempty"`
+	Imported   int                    `json:"imported"`
+	Skipped    map[kml.SkipReason]int `json:"skipped"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+}
+
+// RecordImportRun inserts an import_runs row for a completed import.
+func RecordImportRun(ctx context.Context, db *pgxpool.Pool, run ImportRun) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO import_runs (kml_path, source, imported, skipped, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, run.KMLPath, run.Source, run.Imported, run.Skipped, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record import run: %w", err)
+	}
+	return nil
+}
+
+// ListImportRuns returns the most recent import runs, newest first.
+func (s *PlacemarkStore) ListImportRuns(ctx context.Context, limit int) ([]ImportRun, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, kml_path, source, imported, skipped, started_at, finished_at
+		FROM import_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query import runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []ImportRun
+	for rows.Next() {
+		var run ImportRun
+		if err := rows.Scan(&run.ID, &run.KMLPath, &run.Source, &run.Imported, &run.Skipped, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan import run: %w", err)
+		}
+		if run.Skipped == nil {
+			run.Skipped = make(map[kml.SkipReason]int)
+		}
+		// Older rows may predate a reason; report it as zero.
+		for _, reason := range kml.SkipReasons {
+			if _, ok := run.Skipped[reason]; !ok {
+				run.Skipped[reason] = 0
+			}
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// GeometryIssue counts placemarks with a particular geometry problem and
+// lists a few of their ids.
+type GeometryIssue struct {
+	Count     int   `json:"count"`
+	SampleIDs []int `json:"sample_ids"`
+}
+
+// GeometryReport summarizes geometry health for one geometry type.
+type GeometryReport struct {
+	GeometryType     string        `json:"geometry_type"`
+	Total            int           `json:"total"`
+	Invalid          GeometryIssue `json:"invalid"`
+	Empty            GeometryIssue `json:"empty"`
+	OutOfBounds      GeometryIssue `json:"out_of_bounds"`
+	SelfIntersecting GeometryIssue `json:"self_intersecting"`
+}
+
+// geometryReportSamples is how many offending ids are listed per category.
+const geometryReportSamples = 5
+
+// GetGeometryReport scans all placemarks for invalid, empty, out-of-range,
+// and self-intersecting geometries. Results are cached briefly since this is
+// a full table scan.
+func (s *PlacemarkStore) GetGeometryReport(ctx context.Context) ([]GeometryReport, error) {
+	if reports, ok := s.geometryReport.Get(); ok {
+		return reports, nil
+	}
+
+	query := `
+		WITH checks AS (
+			SELECT id, geometry_type,
+			       NOT ST_IsValid(geom) AS invalid,
+			       ST_IsEmpty(geom) AS empty,
+			       NOT ST_CoveredBy(geom, ST_MakeEnvelope(-180, -90, 180, 90, 4326)) AS out_of_bounds,
+			       (GeometryType(geom) IN ('LINESTRING', 'MULTILINESTRING') AND NOT ST_IsSimple(geom))
+			       OR (NOT ST_IsValid(geom) AND ST_IsValidReason(geom) LIKE 'Self-intersection%') AS self_intersecting
+			FROM placemarks
+		)
+		SELECT geometry_type, COUNT(*),
+		       COUNT(*) FILTER (WHERE invalid),
+		       COALESCE((array_agg(id ORDER BY id) FILTER (WHERE invalid))[1:$1], '{}'),
+		       COUNT(*) FILTER (WHERE empty),
+		       COALESCE((array_agg(id ORDER BY id) FILTER (WHERE empty))[1:$1], '{}'),
+		       COUNT(*) FILTER (WHERE out_of_bounds),
+		       COALESCE((array_agg(id ORDER BY id) FILTER (WHERE out_of_bounds))[1:$1], '{}'),
+		       COUNT(*) FILTER (WHERE self_intersecting),
+		       COALESCE((array_agg(id ORDER BY id) FILTER (WHERE self_intersecting))[1:$1], '{}')
+		FROM checks
+		GROUP BY geometry_type
+		ORDER BY geometry_type
+	`
+
+	rows, err := s.db.Query(ctx, query, geometryReportSamples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query geometry report: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []GeometryReport{}
+	for rows.Next() {
+		var r GeometryReport
+		err := rows.Scan(
+			&r.GeometryType, &r.Total,
+			&r.Invalid.Count, &r.Invalid.SampleIDs,
+			&r.Empty.Count, &r.Empty.SampleIDs,
+			&r.OutOfBounds.Count, &r.OutOfBounds.SampleIDs,
+			&r.SelfIntersecting.Count, &r.SelfIntersecting.SampleIDs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan geometry report: %w", err)
+		}
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read geometry report: %w", err)
+	}
+
+	s.geometryReport.Set(reports)
+	return reports, nil
+}
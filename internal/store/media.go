@@ -0,0 +1,66 @@
+package store
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Media link types, as reported in Placemark.Media.
+const (
+	MediaImage = "image"
+	MediaVideo = "video"
+	MediaAudio = "audio"
+	MediaOther = "other"
+)
+
+// MediaLink is a gx_media_links URL with the kind of media it points to.
+type MediaLink struct {
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+var mediaExtensions = map[string]string{
+	".jpg": MediaImage, ".jpeg": MediaImage, ".png": MediaImage, ".gif": MediaImage,
+	".webp": MediaImage, ".bmp": MediaImage, ".svg": MediaImage, ".heic": MediaImage,
+	".tif": MediaImage, ".tiff": MediaImage, ".avif": MediaImage,
+	".mp4": MediaVideo, ".m4v": MediaVideo, ".mov": MediaVideo, ".webm": MediaVideo,
+	".avi": MediaVideo, ".mkv": MediaVideo, ".ogv": MediaVideo, ".mpg": MediaVideo,
+	".mpeg": MediaVideo, ".3gp": MediaVideo, ".m3u8": MediaVideo,
+	".mp3": MediaAudio, ".wav": MediaAudio, ".m4a": MediaAudio, ".aac": MediaAudio,
+	".ogg": MediaAudio, ".oga": MediaAudio, ".flac": MediaAudio, ".opus": MediaAudio,
+}
+
+// videoHosts serve video pages whose URLs carry no file extension.
+var videoHosts = []string{"youtube.com", "youtu.be", "vimeo.com"}
+
+// ClassifyMediaLink guesses a media link's type from its file extension or,
+// for extensionless video pages, its host. Anything else is MediaOther.
+func ClassifyMediaLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return MediaOther
+	}
+	if t, ok := mediaExtensions[strings.ToLower(path.Ext(u.Path))]; ok {
+		return t
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range videoHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return MediaVideo
+		}
+	}
+	return MediaOther
+}
+
+// classifyMediaLinks types each of links; it returns nil for none.
+func classifyMediaLinks(links []string) []MediaLink {
+	if len(links) == 0 {
+		return nil
+	}
+	media := make([]MediaLink, len(links))
+	for i, link := range links {
+		media[i] = MediaLink{URL: link, Type: ClassifyMediaLink(link)}
+	}
+	return media
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyMediaLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"https://example.com/photos/stage.jpg", MediaImage},
+		{"https://example.com/photos/STAGE.JPEG?size=large", MediaImage},
+		{" https://example.com/a.png ", MediaImage},
+		{"https://example.com/clip.mp4#t=10", MediaVideo},
+		{"https://example.com/live/index.m3u8", MediaVideo},
+		{"https://www.youtube.com/watch?v=abc", MediaVideo},
+		{"https://youtu.be/abc", MediaVideo},
+		{"https://player.vimeo.com/video/1", MediaVideo},
+		{"https://notyoutube.com/watch", MediaOther},
+		{"https://example.com/set.mp3", MediaAudio},
+		{"https://example.com/page.html", MediaOther},
+		{"https://example.com/", MediaOther},
+		{"http://%zz", MediaOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			if got := ClassifyMediaLink(tt.link); got != tt.want {
+				t.Errorf("ClassifyMediaLink(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyMediaLinks(t *testing.T) {
+	if got := classifyMediaLinks(nil); got != nil {
+		t.Errorf("classifyMediaLinks(nil) = %v, want nil", got)
+	}
+	got := classifyMediaLinks([]string{"a.gif", "b.ogg"})
+	want := []MediaLink{{URL: "a.gif", Type: MediaImage}, {URL: "b.ogg", Type: MediaAudio}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("classifyMediaLinks = %v, want %v", got, want)
+	}
+}
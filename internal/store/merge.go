@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPlacemarkNotFound is returned when an operation names a placemark id
+// that does not exist.
+var ErrPlacemarkNotFound = errors.New("placemark not found")
+
+// MergePlacemarks folds mergeID into keepID and deletes mergeID. keepID keeps
+// its own name, description, style, and geometry; its media links and folder
+// path gain mergeID's entries (in order, without duplicates) and mergeID's
+// extended data is reassigned to it. Everything happens in one transaction.
+func (s *PlacemarkStore) MergePlacemarks(ctx context.Context, keepID, mergeID int) error {
+	if keepID == mergeID {
+		return fmt.Errorf("cannot merge placemark %d into itself", keepID)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	// Lock both rows in id order so concurrent merges can't deadlock.
+	rows, err := tx.Query(ctx, `
+		SELECT id, gx_media_links, folder_path
+		FROM placemarks
+		WHERE id = ANY($1)
+		ORDER BY id
+		FOR UPDATE
+	`, []int{keepID, mergeID})
+	if err != nil {
+		return fmt.Errorf("failed to lock placemarks: %w", err)
+	}
+
+	type mergeFields struct {
+		mediaLinks []string
+		folderPath []string
+	}
+	found := make(map[int]mergeFields, 2)
+	for rows.Next() {
+		var id int
+		var f mergeFields
+		if err := rows.Scan(&id, &f.mediaLinks, &f.folderPath); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan placemark: %w", err)
+		}
+		found[id] = f
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	keep, ok := found[keepID]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrPlacemarkNotFound, keepID)
+	}
+	merge, ok := found[mergeID]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrPlacemarkNotFound, mergeID)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE placemark_data SET placemark_id = $1 WHERE placemark_id = $2`, keepID, mergeID); err != nil {
+		return fmt.Errorf("failed to reassign extended data: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE placemarks SET gx_media_links = $2, folder_path = $3 WHERE id = $1
+	`, keepID, unionStrings(keep.mediaLinks, merge.mediaLinks), unionStrings(keep.folderPath, merge.folderPath))
+	if err != nil {
+		return fmt.Errorf("failed to update merged placemark: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM placemarks WHERE id = $1`, mergeID); err != nil {
+		return fmt.Errorf("failed to delete merged placemark: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	s.InvalidatePlacemark(keepID)
+	s.InvalidatePlacemark(mergeID)
+	s.geometryReport.Clear()
+	s.dataKeys.Clear()
+	s.folderHulls.Purge()
+	return nil
+}
+
+// unionStrings appends the values of b missing from a, preserving order.
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, v := range append(append([]string{}, a...), b...) {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
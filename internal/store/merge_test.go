@@ -0,0 +1,26 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnionStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{"both empty", nil, nil, []string{}},
+		{"disjoint", []string{"a", "b"}, []string{"c"}, []string{"a", "b", "c"}},
+		{"overlap keeps order of a", []string{"b", "a"}, []string{"a", "c", "b"}, []string{"b", "a", "c"}},
+		{"duplicates within one", []string{"a", "a"}, []string{"b", "b"}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unionStrings(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unionStrings(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,39 +3,79 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/onnwee/mandalay/internal/cache"
 )
 
 type Placemark struct {
-	ID             int       `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description,omitempty"`
-	StyleID        *string   `json:"style_id,omitempty"`
-	FolderPath     []string  `json:"folder_path"`
-	GeometryType   string    `json:"geometry_type"`
-	Geometry       string    `json:"geometry"`
-	CoordinatesRaw string    `json:"coordinates_raw,omitempty"`
-	MediaLinks     []string  `json:"media_links,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
-	ExtendedData   []KVPair  `json:"extended_data,omitempty"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// DescriptionRaw is the source description, set only by GetByID and
+	// only when the importer's -description-mode stored another form.
+	DescriptionRaw *string `json:"description_raw,omitempty"`
+	// DescriptionFormat is "html" or "markdown", as chosen at import.
+	DescriptionFormat string   `json:"description_format"`
+	StyleID           *string  `json:"style_id,omitempty"`
+	FolderPath        []string `json:"folder_path"`
+	GeometryType      string   `json:"geometry_type"`
+	Geometry          string   `json:"geometry"`
+	CoordinatesRaw    string   `json:"coordinates_raw,omitempty"`
+	MediaLinks        []string `json:"media_links,omitempty"`
+	// Media is MediaLinks with each link's type guessed from its URL.
+	Media        []MediaLink `json:"media,omitempty"`
+	ThumbnailURL *string     `json:"thumbnail_url"`
+	Source       *string     `json:"source,omitempty"`
+	// Timestamp is the KML TimeStamp or TimeSpan begin, falling back to a
+	// date at the start of the name. EndTimestamp is set for TimeSpans.
+	Timestamp    *time.Time `json:"timestamp,omitempty"`
+	EndTimestamp *time.Time `json:"end_timestamp,omitempty"`
+	// TimestampSource says where Timestamp came from: TimestampFromColumn
+	// or TimestampFromName. It is empty for undated placemarks.
+	TimestampSource string `json:"timestamp_source,omitempty"`
+	// TrackTimes are a gx:Track's vertex times, in geometry order.
+	TrackTimes []time.Time `json:"track_times,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	// UpdatedAt is set on every write, along with Version.
+	UpdatedAt    time.Time `json:"updated_at"`
+	ExtendedData []KVPair  `json:"extended_data,omitempty"`
+	// Version changes on every update; it backs delta sync and ETags.
+	Version int64 `json:"version"`
 }
 
+// Placemark.TimestampSource values.
+const (
+	// TimestampFromColumn is a timestamp stored at import, from a KML
+	// TimeStamp, TimeSpan, or gx:Track, or set through the API.
+	TimestampFromColumn = "column"
+	// TimestampFromName is a timestamp parsed from the start of the name.
+	TimestampFromName = "name"
+)
+
 type KVPair struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
 type TimelineEvent struct {
-	Timestamp   *time.Time `json:"timestamp,omitempty"`
-	Name        string     `json:"name"`
-	Description string     `json:"description,omitempty"`
-	Location    *Point     `json:"location,omitempty"`
-	MediaLinks  []string   `json:"media_links,omitempty"`
-	PlacemarkID int        `json:"placemark_id"`
-	FolderPath  []string   `json:"folder_path"`
+	Timestamp    *time.Time `json:"timestamp,omitempty"`
+	EndTimestamp *time.Time `json:"end_timestamp,omitempty"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description,omitempty"`
+	// DescriptionFormat is "html" or "markdown", as chosen at import.
+	DescriptionFormat string   `json:"description_format"`
+	Location          *Point   `json:"location,omitempty"`
+	MediaLinks        []string `json:"media_links,omitempty"`
+	PlacemarkID       int      `json:"placemark_id"`
+	FolderPath        []string `json:"folder_path"`
 }
 
 type Point struct {
@@ -50,254 +90,1261 @@ type BoundingBox struct {
 	MaxLat float64 `json:"max_lat"`
 }
 
+// PlacemarkMarker is the minimal projection used to place map markers.
+type PlacemarkMarker struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Centroid Point  `json:"centroid"`
+}
+
+// FolderCount is the number of placemarks at or below a folder path.
+type FolderCount struct {
+	Path  []string `json:"path"`
+	Count int      `json:"count"`
+}
+
+// FolderPathSeparator joins folder path segments into a display name.
+const FolderPathSeparator = " / "
+
+type HeatmapCell struct {
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Count int     `json:"count"`
+}
+
 type PlacemarkStore struct {
-	db *pgxpool.Pool
+	db             *pgxpool.Pool
+	detailCache    *cache.LRU[int, Placemark]
+	geometryReport *cache.Value[[]GeometryReport]
+	dataKeys       *cache.Value[[]DataKey]
+	folderHulls    *cache.LRU[string, FolderHull]
 }
 
+// NewPlacemarkStore wraps a pool whose connections have been set up with
+// PrepareStatements (normally via pgxpool.Config.AfterConnect).
 func NewPlacemarkStore(db *pgxpool.Pool) *PlacemarkStore {
-	return &PlacemarkStore{db: db}
+	return &PlacemarkStore{
+		db:             db,
+		geometryReport: cache.NewValue[[]GeometryReport](time.Minute),
+		dataKeys:       cache.NewValue[[]DataKey](time.Minute),
+		folderHulls:    cache.NewLRU[string, FolderHull](folderHullCacheSize),
+	}
 }
 
-func (s *PlacemarkStore) List(ctx context.Context, limit, offset int, folderFilter string) ([]Placemark, error) {
-	query := `
-		SELECT id, name, description, style_id, folder_path, geometry_type,
-		       ST_AsGeoJSON(geom) as geometry, coordinates_raw, gx_media_links, created_at
+// Ping checks that the database is reachable.
+func (s *PlacemarkStore) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+// Names of the statements prepared on every connection for hot queries.
+const (
+	listPlacemarksStmt = "list_placemarks"
+	listAfterStmt      = "list_placemarks_after"
+	listByDistanceStmt = "list_placemarks_by_distance"
+	bboxPlacemarksStmt = "bbox_placemarks"
+	bboxMarkersStmt    = "bbox_markers"
+)
+
+// dataFilterCondition keeps placemarks that have every extended-data pair
+// given as parallel text arrays in the keys and values query parameters.
+// Empty arrays keep everything.
+func dataFilterCondition(keys, values string) string {
+	return `NOT EXISTS (
+			SELECT 1 FROM unnest(` + keys + `::text[], ` + values + `::text[]) AS f(key, value)
+			WHERE NOT EXISTS (
+				SELECT 1 FROM placemark_data d
+				WHERE d.placemark_id = placemarks.id AND d.key = f.key AND d.value = f.value
+			)
+		)`
+}
+
+// extendedDataColumns select a placemark's extended data as parallel key
+// and value arrays, in document order.
+const extendedDataColumns = `(SELECT array_agg(key ORDER BY id) FROM placemark_data WHERE placemark_id = placemarks.id),
+		       (SELECT array_agg(value ORDER BY id) FROM placemark_data WHERE placemark_id = placemarks.id)`
+
+// listColumns is the select list of the list queries: the placemark
+// columns, simplified at the tolerance in param, then with withData the
+// extendedDataColumns.
+func listColumns(param string, withData bool) string {
+	columns := simplifiedPlacemarkColumns(param)
+	if withData {
+		columns += `,
+		       ` + extendedDataColumns
+	}
+	return columns
+}
+
+// listPlacemarksQuery is the filtered list query, ordered by orderBy. Only
+// listOrderBy's output may be passed in.
+func listPlacemarksQuery(orderBy string, withData bool) string {
+	return `
+		SELECT ` + listColumns("$6", withData) + `
 		FROM placemarks
 		WHERE ($3 = '' OR $3 = ANY(folder_path))
-		ORDER BY id
+		  AND ($4 = '' OR source = $4)
+		  AND (COALESCE(cardinality($5::text[]), 0) = 0 OR geometry_type = ANY($5))
+		  AND ` + dataFilterCondition("$7", "$8") + `
+		ORDER BY ` + orderBy + `
+		LIMIT $1 OFFSET $2
+	`
+}
+
+// listByDistanceQuery is the filtered list query ordered by distance from
+// the point in $5, $6. The KNN operator orders by planar distance in
+// degrees, which matches true distance ordering closely at city scale and
+// can use the GIST index.
+func listByDistanceQuery(withData bool) string {
+	return `
+		SELECT ` + listColumns("$8", withData) + `
+		FROM placemarks
+		WHERE ($3 = '' OR $3 = ANY(folder_path))
+		  AND ($4 = '' OR source = $4)
+		  AND (COALESCE(cardinality($7::text[]), 0) = 0 OR geometry_type = ANY($7))
+		  AND ` + dataFilterCondition("$9", "$10") + `
+		ORDER BY geom <-> ST_SetSRID(ST_MakePoint($5, $6), 4326), id
 		LIMIT $1 OFFSET $2
 	`
+}
 
-	rows, err := s.db.Query(ctx, query, limit, offset, folderFilter)
+var preparedStatements = map[string]string{
+	listPlacemarksStmt: listPlacemarksQuery("id ASC", false),
+	listAfterStmt: `
+		SELECT ` + simplifiedPlacemarkColumns("$6") + `
+		FROM placemarks
+		WHERE id > $2
+		  AND ($3 = '' OR $3 = ANY(folder_path))
+		  AND ($4 = '' OR source = $4)
+		  AND (COALESCE(cardinality($5::text[]), 0) = 0 OR geometry_type = ANY($5))
+		  AND ` + dataFilterCondition("$7", "$8") + `
+		ORDER BY id
+		LIMIT $1
+	`,
+	listByDistanceStmt: listByDistanceQuery(false),
+	bboxPlacemarksStmt: `
+		SELECT ` + simplifiedPlacemarkColumns("$6") + `
+		FROM placemarks
+		WHERE ST_Intersects(
+			geom,
+			ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		)
+		LIMIT $5
+	`,
+	bboxMarkersStmt: `
+		SELECT id, name, ST_X(ST_Centroid(geom)), ST_Y(ST_Centroid(geom))
+		FROM placemarks
+		WHERE ST_Intersects(
+			geom,
+			ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		)
+		LIMIT $5
+	`,
+}
+
+// PrepareStatements prepares the store's hot queries on conn so their plans
+// are reused across calls. It matches the pgxpool AfterConnect signature.
+func PrepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for name, sql := range preparedStatements {
+		if _, err := conn.Prepare(ctx, name, sql); err != nil {
+			return fmt.Errorf("failed to prepare %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ListFilter narrows the placemarks returned by List. Empty fields match
+// everything.
+type ListFilter struct {
+	Folder string
+	Source string
+	// GeometryTypes, when non-empty, keeps placemarks whose geometry_type
+	// is one of these.
+	GeometryTypes []string
+	// NearestTo, when set, orders results by distance from this point
+	// instead of by id.
+	NearestTo *Point
+	// Sort, one of ListSortKeys, orders results by that field, ties broken
+	// by id; empty means id. SortDesc reverses the order. Both are ignored
+	// with NearestTo.
+	Sort     string
+	SortDesc bool
+	// Tolerance, when positive, simplifies line and polygon geometries
+	// with ST_SimplifyPreserveTopology at this many degrees.
+	Tolerance float64
+	// Data keeps placemarks with every one of these extended-data values.
+	Data []KVPair
+}
+
+// dataArgs splits Data into the key and value arrays dataFilterCondition
+// takes.
+func (f ListFilter) dataArgs() (keys, values []string) {
+	keys, values = make([]string, len(f.Data)), make([]string, len(f.Data))
+	for i, kv := range f.Data {
+		keys[i], values[i] = kv.Key, kv.Value
+	}
+	return keys, values
+}
+
+// ListSortKeys are the fields List can sort by.
+var ListSortKeys = []string{"id", "name", "created_at"}
+
+// listOrderBy translates a sort key and direction into an ORDER BY list. It
+// reports false for keys outside ListSortKeys, so user input never reaches
+// the SQL.
+func listOrderBy(key string, desc bool) (string, bool) {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	switch key {
+	case "", "id":
+		return "id" + dir, true
+	case "name":
+		return "name" + dir + ", id" + dir, true
+	case "created_at":
+		return "created_at" + dir + ", id" + dir, true
+	}
+	return "", false
+}
+
+// List returns a page of placemarks matching filter, with the number of
+// placemarks matching it in total.
+func (s *PlacemarkStore) List(ctx context.Context, limit, offset int, filter ListFilter) ([]Placemark, int, error) {
+	var placemarks []Placemark
+	err := s.EachListed(ctx, limit, offset, filter, false, func(p *Placemark) error {
+		placemarks = append(placemarks, *p)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query placemarks: %w", err)
+		return nil, 0, err
+	}
+	total, err := s.PageTotal(ctx, filter, limit, offset, len(placemarks))
+	if err != nil {
+		return nil, 0, err
+	}
+	return placemarks, total, nil
+}
+
+// EachListed calls fn for each placemark of the page List would return, in
+// order, as rows arrive. With withData set, placemarks carry their
+// ExtendedData. The Placemark passed to fn is reused between calls.
+func (s *PlacemarkStore) EachListed(ctx context.Context, limit, offset int, filter ListFilter, withData bool, fn func(*Placemark) error) error {
+	var (
+		rows pgx.Rows
+		err  error
+	)
+	dataKeys, dataValues := filter.dataArgs()
+	if filter.NearestTo != nil {
+		query := listByDistanceStmt
+		if withData {
+			query = listByDistanceQuery(true)
+		}
+		rows, err = s.db.Query(ctx, query, limit, offset, filter.Folder, filter.Source,
+			filter.NearestTo.Lon, filter.NearestTo.Lat, filter.GeometryTypes, filter.Tolerance, dataKeys, dataValues)
+	} else {
+		query := listPlacemarksStmt
+		if (filter.Sort != "" && filter.Sort != "id") || filter.SortDesc || withData {
+			orderBy, ok := listOrderBy(filter.Sort, filter.SortDesc)
+			if !ok {
+				return fmt.Errorf("unknown sort key %q", filter.Sort)
+			}
+			query = listPlacemarksQuery(orderBy, withData)
+		}
+		rows, err = s.db.Query(ctx, query, limit, offset, filter.Folder, filter.Source, filter.GeometryTypes,
+			filter.Tolerance, dataKeys, dataValues)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query placemarks: %w", err)
 	}
 	defer rows.Close()
 
-	var placemarks []Placemark
+	var (
+		p            Placemark
+		keys, values []string
+	)
 	for rows.Next() {
-		var p Placemark
-		err := rows.Scan(
-			&p.ID, &p.Name, &p.Description, &p.StyleID, &p.FolderPath,
-			&p.GeometryType, &p.Geometry, &p.CoordinatesRaw, &p.MediaLinks, &p.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan placemark: %w", err)
+		p = Placemark{}
+		targets := placemarkScanTargets(&p)
+		if withData {
+			targets = append(targets, &keys, &values)
 		}
-		placemarks = append(placemarks, p)
+		if err := rows.Scan(targets...); err != nil {
+			return fmt.Errorf("failed to scan placemark: %w", err)
+		}
+		fillDerived(&p)
+		for i := range keys {
+			p.ExtendedData = append(p.ExtendedData, KVPair{Key: keys[i], Value: values[i]})
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query placemarks: %w", err)
 	}
+	return nil
+}
 
-	return placemarks, nil
+// PageTotal returns the number of placemarks matching filter, given that
+// the page at limit and offset held count of them. A short page is the
+// last one, so unless it is empty past the first page the total follows
+// without another query; counting separately keeps the list query free to
+// send its first rows before the whole result is known.
+func (s *PlacemarkStore) PageTotal(ctx context.Context, filter ListFilter, limit, offset, count int) (int, error) {
+	if count < limit && (count > 0 || offset == 0) {
+		return offset + count, nil
+	}
+
+	dataKeys, dataValues := filter.dataArgs()
+	query := `
+		SELECT COUNT(*)
+		FROM placemarks
+		WHERE ($1 = '' OR $1 = ANY(folder_path))
+		  AND ($2 = '' OR source = $2)
+		  AND (COALESCE(cardinality($3::text[]), 0) = 0 OR geometry_type = ANY($3))
+		  AND ` + dataFilterCondition("$4", "$5")
+	var total int
+	err := s.db.QueryRow(ctx, query, filter.Folder, filter.Source, filter.GeometryTypes, dataKeys, dataValues).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count placemarks: %w", err)
+	}
+	return total, nil
 }
 
+// ListAfter returns up to limit placemarks with an id greater than afterID,
+// in id order. Unlike List's OFFSET it seeks on the primary key, so deep
+// pages cost the same as the first and rows inserted between fetches never
+// shift a page. filter.NearestTo is ignored.
+func (s *PlacemarkStore) ListAfter(ctx context.Context, afterID, limit int, filter ListFilter) ([]Placemark, error) {
+	dataKeys, dataValues := filter.dataArgs()
+	rows, err := s.db.Query(ctx, listAfterStmt, limit, afterID, filter.Folder, filter.Source, filter.GeometryTypes,
+		filter.Tolerance, dataKeys, dataValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query placemarks: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPlacemarks(rows)
+}
+
+// GetByID returns a placemark with its extended data, from the detail cache
+// when it is enabled. It returns ErrPlacemarkNotFound if the placemark does
+// not exist.
 func (s *PlacemarkStore) GetByID(ctx context.Context, id int) (*Placemark, error) {
+	if s.detailCache != nil {
+		if p, ok := s.detailCache.Get(id); ok {
+			return clonePlacemark(&p), nil
+		}
+	}
+
+	p, err := s.loadByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.detailCache != nil {
+		s.detailCache.Add(id, *clonePlacemark(p))
+	}
+
+	return p, nil
+}
+
+// loadByID fetches a placemark with its extended data and source
+// description.
+func (s *PlacemarkStore) loadByID(ctx context.Context, id int) (*Placemark, error) {
 	query := `
-		SELECT p.id, p.name, p.description, p.style_id, p.folder_path, p.geometry_type,
-		       ST_AsGeoJSON(p.geom) as geometry, p.coordinates_raw, p.gx_media_links, p.created_at
-		FROM placemarks p
-		WHERE p.id = $1
+		SELECT ` + placemarkColumns + `, NULLIF(description_raw, description)
+		FROM placemarks
+		WHERE id = $1
 	`
 
-	var p Placemark
-	err := s.db.QueryRow(ctx, query, id).Scan(
-		&p.ID, &p.Name, &p.Description, &p.StyleID, &p.FolderPath,
-		&p.GeometryType, &p.Geometry, &p.CoordinatesRaw, &p.MediaLinks, &p.CreatedAt,
-	)
+	p := &Placemark{}
+	err := s.db.QueryRow(ctx, query, id).Scan(append(placemarkScanTargets(p), &p.DescriptionRaw)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPlacemarkNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get placemark: %w", err)
 	}
+	fillDerived(p)
 
 	// Fetch extended data
-	extQuery := `SELECT key, value FROM placemark_data WHERE placemark_id = $1`
+	extQuery := `SELECT key, value FROM placemark_data WHERE placemark_id = $1 ORDER BY id`
 	extRows, err := s.db.Query(ctx, extQuery, id)
 	if err != nil {
-		return &p, nil
+		return nil, fmt.Errorf("failed to load extended data: %w", err)
 	}
 	defer extRows.Close()
 
 	for extRows.Next() {
 		var kv KVPair
-		if err := extRows.Scan(&kv.Key, &kv.Value); err == nil {
-			p.ExtendedData = append(p.ExtendedData, kv)
+		if err := extRows.Scan(&kv.Key, &kv.Value); err != nil {
+			return nil, fmt.Errorf("failed to load extended data: %w", err)
 		}
+		p.ExtendedData = append(p.ExtendedData, kv)
+	}
+	if err := extRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load extended data: %w", err)
+	}
+
+	return p, nil
+}
+
+// LoadExtendedData fills ExtendedData for a page of placemarks with one query.
+func (s *PlacemarkStore) LoadExtendedData(ctx context.Context, placemarks []Placemark) error {
+	if len(placemarks) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(placemarks))
+	ids := make([]int, len(placemarks))
+	for i, p := range placemarks {
+		index[p.ID] = i
+		ids[i] = p.ID
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT placemark_id, key, value
+		FROM placemark_data
+		WHERE placemark_id = ANY($1)
+		ORDER BY placemark_id, id
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to query extended data: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var kv KVPair
+		if err := rows.Scan(&id, &kv.Key, &kv.Value); err != nil {
+			return fmt.Errorf("failed to scan extended data: %w", err)
+		}
+		p := &placemarks[index[id]]
+		p.ExtendedData = append(p.ExtendedData, kv)
+	}
+
+	return rows.Err()
+}
+
+// ErrVersionMismatch is returned by conditional updates when the placemark
+// has changed since the version the caller read.
+var ErrVersionMismatch = errors.New("placemark version mismatch")
+
+// SetThumbnailURL sets or, when url is nil, clears the placemark's explicit
+// thumbnail. When ifVersion is set the update only applies at that version,
+// otherwise ErrVersionMismatch is returned. It returns ErrPlacemarkNotFound
+// if the placemark does not exist.
+func (s *PlacemarkStore) SetThumbnailURL(ctx context.Context, id int, url *string, ifVersion *int64) error {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE placemarks SET thumbnail_url = $2
+		WHERE id = $1 AND ($3::bigint IS NULL OR version = $3)
+	`, id, url, ifVersion)
+	if err != nil {
+		return fmt.Errorf("failed to set thumbnail: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return s.updateMissError(ctx, id, ifVersion)
 	}
+	s.InvalidatePlacemark(id)
+	return nil
+}
 
-	return &p, nil
+// updateMissError explains why a conditional update matched no row.
+func (s *PlacemarkStore) updateMissError(ctx context.Context, id int, ifVersion *int64) error {
+	if ifVersion == nil {
+		return ErrPlacemarkNotFound
+	}
+	var exists bool
+	if err := s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM placemarks WHERE id = $1)", id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check placemark: %w", err)
+	}
+	if !exists {
+		return ErrPlacemarkNotFound
+	}
+	return ErrVersionMismatch
 }
 
-func (s *PlacemarkStore) GetInBBox(ctx context.Context, bbox BoundingBox, limit int) ([]Placemark, error) {
+// GetBufferedGeometry returns the placemark's geometry grown by meters as
+// GeoJSON. The buffer is computed on the geography type, so the result
+// approximates a metric buffer in WGS 84.
+func (s *PlacemarkStore) GetBufferedGeometry(ctx context.Context, id int, meters float64) (string, error) {
+	query := `SELECT ST_AsGeoJSON(ST_Buffer(geom::geography, $2)::geometry) FROM placemarks WHERE id = $1`
+
+	var geometry string
+	if err := s.db.QueryRow(ctx, query, id, meters).Scan(&geometry); err != nil {
+		return "", fmt.Errorf("failed to buffer geometry: %w", err)
+	}
+	return geometry, nil
+}
+
+// GetInBBox returns up to limit placemarks intersecting bbox, simplified at
+// tolerance degrees as ListFilter.Tolerance describes.
+func (s *PlacemarkStore) GetInBBox(ctx context.Context, bbox BoundingBox, limit int, tolerance float64) ([]Placemark, error) {
+	rows, err := s.db.Query(ctx, bboxPlacemarksStmt, bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat, limit, tolerance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bbox: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPlacemarks(rows)
+}
+
+// GetInBBoxLight is GetInBBox without geometry or descriptions: it returns only
+// each placemark's id, name, and centroid.
+func (s *PlacemarkStore) GetInBBoxLight(ctx context.Context, bbox BoundingBox, limit int) ([]PlacemarkMarker, error) {
+	rows, err := s.db.Query(ctx, bboxMarkersStmt, bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bbox markers: %w", err)
+	}
+	defer rows.Close()
+
+	var markers []PlacemarkMarker
+	for rows.Next() {
+		var m PlacemarkMarker
+		if err := rows.Scan(&m.ID, &m.Name, &m.Centroid.Lon, &m.Centroid.Lat); err != nil {
+			return nil, fmt.Errorf("failed to scan bbox marker: %w", err)
+		}
+		markers = append(markers, m)
+	}
+
+	return markers, rows.Err()
+}
+
+// GetHeatmapGrid aggregates point placemarks inside bbox into a regular grid of
+// cellSize degrees, returning at most maxCells cells ordered by density.
+func (s *PlacemarkStore) GetHeatmapGrid(ctx context.Context, bbox BoundingBox, cellSize float64, maxCells int) ([]HeatmapCell, error) {
 	query := `
-		SELECT id, name, description, style_id, folder_path, geometry_type,
-		       ST_AsGeoJSON(geom) as geometry, coordinates_raw, gx_media_links, created_at
-		FROM placemarks
-		WHERE ST_Intersects(
-			geom,
-			ST_MakeEnvelope($1, $2, $3, $4, 4326)
-		)
-		LIMIT $5
+		SELECT ST_X(cell), ST_Y(cell), count
+		FROM (
+			SELECT ST_SnapToGrid(geom, $5) AS cell, COUNT(*) AS count
+			FROM placemarks
+			WHERE geometry_type = 'Point'
+			  AND ST_Intersects(geom, ST_MakeEnvelope($1, $2, $3, $4, 4326))
+			GROUP BY cell
+		) grid
+		ORDER BY count DESC
+		LIMIT $6
 	`
 
-	rows, err := s.db.Query(ctx, query, bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat, limit)
+	rows, err := s.db.Query(ctx, query, bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat, cellSize, maxCells)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query bbox: %w", err)
+		return nil, fmt.Errorf("failed to query heatmap grid: %w", err)
 	}
 	defer rows.Close()
 
-	var placemarks []Placemark
+	var cells []HeatmapCell
 	for rows.Next() {
-		var p Placemark
-		err := rows.Scan(
-			&p.ID, &p.Name, &p.Description, &p.StyleID, &p.FolderPath,
-			&p.GeometryType, &p.Geometry, &p.CoordinatesRaw, &p.MediaLinks, &p.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan placemark: %w", err)
+		var c HeatmapCell
+		if err := rows.Scan(&c.Lon, &c.Lat, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan heatmap cell: %w", err)
 		}
-		placemarks = append(placemarks, p)
+		cells = append(cells, c)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query heatmap grid: %w", err)
+	}
+
+	return cells, nil
+}
 
+// ListAll returns every placemark matching folderFilter and dated inside
+// window, for exports.
+func (s *PlacemarkStore) ListAll(ctx context.Context, folderFilter string, window TimeWindow) ([]Placemark, error) {
+	var placemarks []Placemark
+	err := s.EachPlacemark(ctx, folderFilter, window, func(p *Placemark) error {
+		placemarks = append(placemarks, *p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return placemarks, nil
 }
 
-func (s *PlacemarkStore) GetTimeline(ctx context.Context) ([]TimelineEvent, error) {
+// exportCondition is the WHERE clause shared by the export queries: the
+// folder filter on $1, and with $2 set, only rows that can be dated. The
+// window itself is applied after scanning, since timestamps may come from
+// names.
+const exportCondition = `($1 = '' OR $1 = ANY(folder_path))
+		  AND (NOT $2::boolean OR time_begin IS NOT NULL OR name ~ '` + nameDatePrefix + `')`
+
+// EachPlacemark calls fn for every placemark matching folderFilter, in id
+// order, as rows arrive from the database, so callers can stream large
+// result sets without holding them in memory. Placemarks not dated inside
+// window are skipped. It stops at the first error fn returns.
+func (s *PlacemarkStore) EachPlacemark(ctx context.Context, folderFilter string, window TimeWindow, fn func(*Placemark) error) error {
 	query := `
-		SELECT id, name, description, geometry_type, ST_AsGeoJSON(geom) as geometry,
-		       gx_media_links, folder_path
+		SELECT ` + placemarkColumns + `
 		FROM placemarks
-		WHERE name ~ '^\d{1,2}/\d{1,2}/\d{4}'
-		ORDER BY name
+		WHERE ` + exportCondition + `
+		ORDER BY id
 	`
 
-	rows, err := s.db.Query(ctx, query)
+	rows, err := s.db.Query(ctx, query, folderFilter, window.Bounded())
 	if err != nil {
-		return nil, fmt.Errorf("failed to query timeline: %w", err)
+		return fmt.Errorf("failed to query placemarks: %w", err)
 	}
 	defer rows.Close()
 
-	var events []TimelineEvent
+	var p Placemark
 	for rows.Next() {
-		var (
-			id          int
-			name        string
-			description string
-			geomType    string
-			geometry    string
-			mediaLinks  []string
-			folderPath  []string
-		)
+		p = Placemark{}
+		if err := rows.Scan(placemarkScanTargets(&p)...); err != nil {
+			return fmt.Errorf("failed to scan placemark: %w", err)
+		}
+		fillDerived(&p)
+		if !window.Contains(p.Timestamp) {
+			continue
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
 
-		err := rows.Scan(&id, &name, &description, &geomType, &geometry, &mediaLinks, &folderPath)
-		if err != nil {
+	return rows.Err()
+}
+
+// EachPlacemarkWithData is EachPlacemark with ExtendedData filled in. Rows
+// are ordered by folder path, then id, so placemarks in the same folder, and
+// folders under the same parent, arrive together.
+func (s *PlacemarkStore) EachPlacemarkWithData(ctx context.Context, folderFilter string, window TimeWindow, fn func(*Placemark) error) error {
+	query := `
+		SELECT ` + placemarkColumns + `,
+		       ` + extendedDataColumns + `
+		FROM placemarks
+		WHERE ` + exportCondition + `
+		ORDER BY folder_path, id
+	`
+
+	rows, err := s.db.Query(ctx, query, folderFilter, window.Bounded())
+	if err != nil {
+		return fmt.Errorf("failed to query placemarks: %w", err)
+	}
+	defer rows.Close()
+
+	var p Placemark
+	for rows.Next() {
+		p = Placemark{}
+		var keys, values []string
+		if err := rows.Scan(append(placemarkScanTargets(&p), &keys, &values)...); err != nil {
+			return fmt.Errorf("failed to scan placemark: %w", err)
+		}
+		fillDerived(&p)
+		if !window.Contains(p.Timestamp) {
 			continue
 		}
+		for i := range keys {
+			p.ExtendedData = append(p.ExtendedData, KVPair{Key: keys[i], Value: values[i]})
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
 
-		event := TimelineEvent{
-			PlacemarkID: id,
-			Name:        name,
-			Description: description,
-			MediaLinks:  mediaLinks,
-			FolderPath:  folderPath,
+	return rows.Err()
+}
+
+// PlacemarkRow is the flat projection written by the CSV placemark list.
+// Centroid is nil for an empty geometry.
+type PlacemarkRow struct {
+	ID                int
+	Name              string
+	Description       string
+	DescriptionFormat string
+	GeometryType      string
+	Centroid          *Point
+	FolderPath        []string
+	MediaLinks        int
+}
+
+// EachPlacemarkRow calls fn with a PlacemarkRow for every placemark matching
+// filter, in id order, streaming like EachPlacemark. NearestTo is ignored.
+// Centroids are computed by ST_Centroid, so points report their own position.
+func (s *PlacemarkStore) EachPlacemarkRow(ctx context.Context, filter ListFilter, fn func(*PlacemarkRow) error) error {
+	query := `
+		SELECT id, name, description, description_format, geometry_type,
+		       ST_X(ST_Centroid(geom)), ST_Y(ST_Centroid(geom)),
+		       folder_path, COALESCE(cardinality(gx_media_links), 0)
+		FROM placemarks
+		WHERE ($1 = '' OR $1 = ANY(folder_path))
+		  AND ($2 = '' OR source = $2)
+		  AND (COALESCE(cardinality($3::text[]), 0) = 0 OR geometry_type = ANY($3))
+		  AND ` + dataFilterCondition("$4", "$5") + `
+		ORDER BY id
+	`
+
+	dataKeys, dataValues := filter.dataArgs()
+	rows, err := s.db.Query(ctx, query, filter.Folder, filter.Source, filter.GeometryTypes, dataKeys, dataValues)
+	if err != nil {
+		return fmt.Errorf("failed to query placemarks: %w", err)
+	}
+	defer rows.Close()
+
+	var row PlacemarkRow
+	for rows.Next() {
+		row = PlacemarkRow{}
+		var lon, lat *float64
+		if err := rows.Scan(&row.ID, &row.Name, &row.Description, &row.DescriptionFormat, &row.GeometryType,
+			&lon, &lat, &row.FolderPath, &row.MediaLinks); err != nil {
+			return fmt.Errorf("failed to scan placemark: %w", err)
 		}
+		if lon != nil && lat != nil {
+			row.Centroid = &Point{Lon: *lon, Lat: *lat}
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
 
-		// Parse timestamp from name
-		event.Timestamp = parseTimestampFromName(name)
+	return rows.Err()
+}
 
-		// Extract point if geometry is a point
-		if geomType == "Point" {
-			event.Location = extractPointFromGeoJSON(geometry)
+// Delete removes a placemark; its extended data goes with it by cascade and
+// a tombstone records the deletion for delta sync. It returns
+// ErrPlacemarkNotFound if the placemark does not exist.
+func (s *PlacemarkStore) Delete(ctx context.Context, id int) error {
+	tag, err := s.db.Exec(ctx, "DELETE FROM placemarks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete placemark: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPlacemarkNotFound
+	}
+	s.InvalidatePlacemark(id)
+	s.geometryReport.Clear()
+	s.dataKeys.Clear()
+	s.folderHulls.Purge()
+	return nil
+}
+
+// DeleteBySource removes every placemark imported with the given source
+// label and returns how many were deleted.
+func (s *PlacemarkStore) DeleteBySource(ctx context.Context, source string) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM placemarks WHERE source = $1", source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete source: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		s.PurgeCaches()
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DuplicateGroup is a set of placemarks sharing the same (or nearly the same)
+// geometry. Count is the full group size even when IDs is truncated.
+type DuplicateGroup struct {
+	IDs   []int `json:"ids"`
+	Count int   `json:"count"`
+}
+
+// GetGeometryDuplicates groups placemarks whose geometries are identical, or
+// when toleranceMeters > 0, within that distance of each other. Each group
+// lists at most maxGroupSize ids.
+func (s *PlacemarkStore) GetGeometryDuplicates(ctx context.Context, folderFilter string, toleranceMeters float64, maxGroupSize int) ([]DuplicateGroup, error) {
+	if toleranceMeters <= 0 {
+		return s.getExactDuplicates(ctx, folderFilter, maxGroupSize)
+	}
+
+	// ST_DWithin finds nearby candidates; the Hausdorff check (tolerance
+	// converted to degrees, roughly) requires the shapes themselves to match
+	// rather than merely touch.
+	query := `
+		SELECT a.id, b.id
+		FROM placemarks a
+		JOIN placemarks b
+		  ON a.id < b.id
+		 AND a.geometry_type = b.geometry_type
+		 AND ST_DWithin(a.geom::geography, b.geom::geography, $2)
+		WHERE ($1 = '' OR $1 = ANY(a.folder_path))
+		  AND ($1 = '' OR $1 = ANY(b.folder_path))
+		  AND ST_HausdorffDistance(a.geom, b.geom) <= $2 / 111320.0
+		LIMIT 100000
+	`
+
+	rows, err := s.db.Query(ctx, query, folderFilter, toleranceMeters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query near-duplicate geometries: %w", err)
+	}
+	defer rows.Close()
+
+	// Union-find over matching pairs so chains of near matches form one group.
+	parent := make(map[int]int)
+	var find func(int) int
+	find = func(x int) int {
+		if p, ok := parent[x]; ok && p != x {
+			parent[x] = find(p)
+			return parent[x]
 		}
+		parent[x] = x
+		return x
+	}
 
-		events = append(events, event)
+	for rows.Next() {
+		var a, b int
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate pair: %w", err)
+		}
+		ra, rb := find(a), find(b)
+		if ra != rb {
+			if ra < rb {
+				parent[rb] = ra
+			} else {
+				parent[ra] = rb
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read duplicate pairs: %w", err)
+	}
+
+	members := make(map[int][]int)
+	for id := range parent {
+		root := find(id)
+		members[root] = append(members[root], id)
+	}
+
+	groups := make([]DuplicateGroup, 0, len(members))
+	for _, ids := range members {
+		sort.Ints(ids)
+		groups = append(groups, newDuplicateGroup(ids, len(ids), maxGroupSize))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].IDs[0] < groups[j].IDs[0] })
+
+	return groups, nil
+}
+
+func (s *PlacemarkStore) getExactDuplicates(ctx context.Context, folderFilter string, maxGroupSize int) ([]DuplicateGroup, error) {
+	query := `
+		SELECT array_agg(id ORDER BY id), COUNT(*)
+		FROM placemarks
+		WHERE ($1 = '' OR $1 = ANY(folder_path))
+		GROUP BY ST_AsBinary(geom)
+		HAVING COUNT(*) > 1
+		ORDER BY MIN(id)
+	`
+
+	rows, err := s.db.Query(ctx, query, folderFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query duplicate geometries: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []DuplicateGroup
+	for rows.Next() {
+		var ids []int
+		var count int
+		if err := rows.Scan(&ids, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate group: %w", err)
+		}
+		groups = append(groups, newDuplicateGroup(ids, count, maxGroupSize))
+	}
+
+	return groups, rows.Err()
+}
+
+func newDuplicateGroup(ids []int, count, maxGroupSize int) DuplicateGroup {
+	if maxGroupSize > 0 && len(ids) > maxGroupSize {
+		ids = ids[:maxGroupSize]
+	}
+	return DuplicateGroup{IDs: ids, Count: count}
+}
+
+// StyleExists reports whether a style with the given id has been imported.
+func (s *PlacemarkStore) StyleExists(ctx context.Context, styleID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM styles WHERE id = $1)", styleID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check style: %w", err)
+	}
+	return exists, nil
+}
+
+func (s *PlacemarkStore) GetByStyle(ctx context.Context, styleID string, limit, offset int) ([]Placemark, error) {
+	query := `
+		SELECT ` + placemarkColumns + `
+		FROM placemarks
+		WHERE style_id = $1
+		ORDER BY id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := s.db.Query(ctx, query, styleID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query placemarks by style: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPlacemarks(rows)
+}
+
+// GetTimeline returns dated events within window in chronological order.
+func (s *PlacemarkStore) GetTimeline(ctx context.Context, window TimeWindow) ([]TimelineEvent, error) {
+	query := `
+		SELECT id, name, COALESCE(description, ''), geometry_type, ST_AsGeoJSON(geom) as geometry,
+		       gx_media_links, folder_path, description_format, time_begin, time_end
+		FROM placemarks
+		WHERE (time_begin IS NOT NULL OR name ~ '` + nameDatePrefix + `')
+		ORDER BY id
+	`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline: %w", err)
 	}
+	defer rows.Close()
 
+	// Stored and name-parsed timestamps mix, so order after scanning. Rows
+	// arrive in id order, which breaks ties and orders undated events.
+	events, err := scanTimelineEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline: %w", err)
+	}
+	events = window.filter(events)
+	sortTimelineEvents(events)
 	return events, nil
 }
 
-func (s *PlacemarkStore) ListFolders(ctx context.Context) ([]string, error) {
+// GetTimelineInBBox returns dated events within window whose location falls
+// inside bbox, using the centroid for non-point geometries, in chronological
+// order.
+func (s *PlacemarkStore) GetTimelineInBBox(ctx context.Context, bbox BoundingBox, window TimeWindow) ([]TimelineEvent, error) {
 	query := `
-		SELECT DISTINCT unnest(folder_path) as folder
+		SELECT id, name, COALESCE(description, ''), geometry_type, ST_AsGeoJSON(geom) as geometry,
+		       gx_media_links, folder_path, description_format, time_begin, time_end
 		FROM placemarks
-		WHERE array_length(folder_path, 1) > 0
+		WHERE (time_begin IS NOT NULL OR name ~ '` + nameDatePrefix + `')
+		  AND geom && ST_MakeEnvelope($1, $2, $3, $4, 4326)
+		  AND ST_Intersects(ST_Centroid(geom), ST_MakeEnvelope($1, $2, $3, $4, 4326))
+		ORDER BY id
+	`
+
+	rows, err := s.db.Query(ctx, query, bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline in bbox: %w", err)
+	}
+	defer rows.Close()
+
+	events, err := scanTimelineEvents(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline in bbox: %w", err)
+	}
+	events = window.filter(events)
+	sortTimelineEvents(events)
+	return events, nil
+}
+
+// ListFolders returns a page of distinct folder names along with the total
+// number of distinct folders.
+func (s *PlacemarkStore) ListFolders(ctx context.Context, limit, offset int) ([]string, int, error) {
+	query := `
+		SELECT folder, COUNT(*) OVER()
+		FROM (
+			SELECT DISTINCT unnest(folder_path) as folder
+			FROM placemarks
+			WHERE array_length(folder_path, 1) > 0
+		) f
 		ORDER BY folder
+		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := s.db.Query(ctx, query)
+	rows, err := s.db.Query(ctx, query, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query folders: %w", err)
+		return nil, 0, fmt.Errorf("failed to query folders: %w", err)
 	}
 	defer rows.Close()
 
 	var folders []string
+	total := 0
 	for rows.Next() {
 		var folder string
-		if err := rows.Scan(&folder); err == nil {
-			folders = append(folders, folder)
+		if err := rows.Scan(&folder, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan folder: %w", err)
 		}
+		folders = append(folders, folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to query folders: %w", err)
 	}
 
-	return folders, nil
+	// An empty page past the end carries no window count; ask directly.
+	if len(folders) == 0 && offset > 0 {
+		countQuery := `SELECT COUNT(DISTINCT folder) FROM placemarks, unnest(folder_path) AS folder`
+		if err := s.db.QueryRow(ctx, countQuery).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("failed to count folders: %w", err)
+		}
+	}
+
+	return folders, total, nil
 }
 
-func (s *PlacemarkStore) GetStats(ctx context.Context) (map[string]interface{}, error) {
+// GetStats returns dataset counts and the topFolders most populated folders.
+func (s *PlacemarkStore) GetStats(ctx context.Context, topFolders int) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
 	// Total counts
 	var totalPlacemarks, totalStyles int
-	s.db.QueryRow(ctx, "SELECT COUNT(*) FROM placemarks").Scan(&totalPlacemarks)
-	s.db.QueryRow(ctx, "SELECT COUNT(*) FROM styles").Scan(&totalStyles)
+	if err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM placemarks").Scan(&totalPlacemarks); err != nil {
+		return nil, fmt.Errorf("failed to count placemarks: %w", err)
+	}
+	if err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM styles").Scan(&totalStyles); err != nil {
+		return nil, fmt.Errorf("failed to count styles: %w", err)
+	}
 
 	stats["total_placemarks"] = totalPlacemarks
 	stats["total_styles"] = totalStyles
 
+	// Overall extent, for the map's initial fit; null while the table is empty
+	bounds, err := s.queryExtent(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	stats["bounds"] = bounds
+
 	// Geometry type breakdown
 	geomQuery := `SELECT geometry_type, COUNT(*) FROM placemarks GROUP BY geometry_type`
 	rows, err := s.db.Query(ctx, geomQuery)
-	if err == nil {
-		defer rows.Close()
-		geomTypes := make(map[string]int)
-		for rows.Next() {
-			var gtype string
-			var count int
-			if rows.Scan(&gtype, &count) == nil {
-				geomTypes[gtype] = count
-			}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query geometry types: %w", err)
+	}
+	defer rows.Close()
+	geomTypes := make(map[string]int)
+	for rows.Next() {
+		var gtype string
+		var count int
+		if err := rows.Scan(&gtype, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan geometry type: %w", err)
 		}
-		stats["geometry_types"] = geomTypes
+		geomTypes[gtype] = count
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query geometry types: %w", err)
+	}
+	stats["geometry_types"] = geomTypes
 
-	// Folders
-	folderQuery := `SELECT unnest(folder_path) as folder, COUNT(*) FROM placemarks GROUP BY folder ORDER BY COUNT(*) DESC LIMIT 10`
-	rows2, err := s.db.Query(ctx, folderQuery)
-	if err == nil {
-		defer rows2.Close()
-		folders := make(map[string]int)
-		for rows2.Next() {
-			var folder string
-			var count int
-			if rows2.Scan(&folder, &count) == nil {
-				folders[folder] = count
-			}
+	// Folders, counted per full path so same-named folders under different
+	// parents stay distinct. Each placemark counts toward every ancestor.
+	folderQuery := `
+		SELECT folder_path[1:i] AS path, COUNT(*)
+		FROM placemarks, generate_subscripts(folder_path, 1) AS i
+		GROUP BY path
+		ORDER BY COUNT(*) DESC, path
+		LIMIT $1
+	`
+	rows2, err := s.db.Query(ctx, folderQuery, topFolders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top folders: %w", err)
+	}
+	defer rows2.Close()
+	folders := make(map[string]int)
+	paths := []FolderCount{}
+	for rows2.Next() {
+		var fc FolderCount
+		if err := rows2.Scan(&fc.Path, &fc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan top folder: %w", err)
 		}
-		stats["top_folders"] = folders
+		folders[strings.Join(fc.Path, FolderPathSeparator)] = fc.Count
+		paths = append(paths, fc)
+	}
+	if err := rows2.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query top folders: %w", err)
 	}
+	stats["top_folders"] = folders
+	stats["top_folder_paths"] = paths
 
 	return stats, nil
 }
 
-func parseTimestampFromName(name string) *time.Time {
-	layouts := []string{
-		"1/2/2006  3:04:05 PM",
-		"01/02/2006  03:04:05 PM",
-		"1/2/2006 3:04:05 PM",
-		"01/02/2006 03:04:05 PM",
+// placemarkColumns is the standard column list for selecting placemarks;
+// placemarkScanTargets returns matching Scan destinations.
+const placemarkColumns = `id, name, description, style_id, folder_path, geometry_type,
+		       ST_AsGeoJSON(geom) as geometry, ` + placemarkColumnsAfterGeometry
+
+// simplifiedPlacemarkColumns is placemarkColumns with the geometry passed
+// through ST_SimplifyPreserveTopology at the tolerance in the query
+// parameter named by param (such as "$6"), in degrees. A tolerance of zero
+// or less, and point geometries, are left as stored.
+func simplifiedPlacemarkColumns(param string) string {
+	return `id, name, description, style_id, folder_path, geometry_type,
+		       ST_AsGeoJSON(CASE
+		           WHEN ` + param + `::float8 > 0 AND geometry_type NOT IN ('Point', 'MultiPoint')
+		           THEN ST_SimplifyPreserveTopology(geom, ` + param + `::float8)
+		           ELSE geom
+		       END) as geometry, ` + placemarkColumnsAfterGeometry
+}
+
+const placemarkColumnsAfterGeometry = `coordinates_raw, gx_media_links, source, created_at, updated_at,
+		       ` + thumbnailColumn + `, description_format, placemarks.version,
+		       time_begin, time_end, track_times`
+
+// thumbnailColumn picks a placemark's representative image: an explicitly set
+// thumbnail_url, then a primary_image extended-data value, then the first
+// media link. It is NULL when none exist.
+const thumbnailColumn = `COALESCE(
+			NULLIF(placemarks.thumbnail_url, ''),
+			(SELECT NULLIF(value, '') FROM placemark_data
+			 WHERE placemark_id = placemarks.id AND key = '` + primaryImageKey + `'
+			 ORDER BY id LIMIT 1),
+			placemarks.gx_media_links[1]
+		) AS thumbnail_url`
+
+// primaryImageKey is the extended-data key that flags a placemark's preferred
+// thumbnail in the source KML.
+const primaryImageKey = "primary_image"
+
+func placemarkScanTargets(p *Placemark) []interface{} {
+	return []interface{}{
+		&p.ID, &p.Name, &p.Description, &p.StyleID, &p.FolderPath,
+		&p.GeometryType, &p.Geometry, &p.CoordinatesRaw, &p.MediaLinks, &p.Source, &p.CreatedAt, &p.UpdatedAt,
+		&p.ThumbnailURL, &p.DescriptionFormat, &p.Version,
+		&p.Timestamp, &p.EndTimestamp, &p.TrackTimes,
 	}
+}
 
-	for _, layout := range layouts {
-		if len(name) < len(layout) {
-			continue
+// fillDerived sets the fields computed from a scanned placemark's columns:
+// a date at the start of the name for placemarks imported without a KML
+// TimeStamp or TimeSpan, where the timestamp came from, and the typed Media
+// list.
+func fillDerived(p *Placemark) {
+	if p.Timestamp != nil {
+		p.TimestampSource = TimestampFromColumn
+	} else if p.Timestamp = parseTimestampFromName(p.Name); p.Timestamp != nil {
+		p.TimestampSource = TimestampFromName
+	}
+	p.Media = classifyMediaLinks(p.MediaLinks)
+}
+
+// scanPlacemarks reads rows selected with the standard placemark column list.
+func scanPlacemarks(rows pgx.Rows) ([]Placemark, error) {
+	var placemarks []Placemark
+	for rows.Next() {
+		var p Placemark
+		err := rows.Scan(placemarkScanTargets(&p)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan placemark: %w", err)
 		}
-		timeStr := name[:len(layout)]
-		if t, err := time.Parse(layout, timeStr); err == nil {
+		fillDerived(&p)
+		placemarks = append(placemarks, p)
+	}
+
+	return placemarks, rows.Err()
+}
+
+// scanTimelineEvents reads rows selected with the timeline column list.
+func scanTimelineEvents(rows pgx.Rows) ([]TimelineEvent, error) {
+	var events []TimelineEvent
+	for rows.Next() {
+		var (
+			id          int
+			name        string
+			description string
+			geomType    string
+			geometry    string
+			mediaLinks  []string
+			folderPath  []string
+			format      string
+			begin, end  *time.Time
+		)
+
+		err := rows.Scan(&id, &name, &description, &geomType, &geometry, &mediaLinks, &folderPath, &format, &begin, &end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan timeline event: %w", err)
+		}
+
+		event := TimelineEvent{
+			PlacemarkID:       id,
+			Name:              name,
+			Description:       description,
+			DescriptionFormat: format,
+			MediaLinks:        mediaLinks,
+			FolderPath:        folderPath,
+		}
+
+		// Prefer the stored KML time; fall back to parsing the name.
+		event.Timestamp, event.EndTimestamp = begin, end
+		if event.Timestamp == nil {
+			event.Timestamp = parseTimestampFromName(name)
+		}
+
+		// Extract point if geometry is a point
+		if geomType == "Point" {
+			event.Location = extractPointFromGeoJSON(geometry)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// sortTimelineEvents orders events chronologically, keeping undated events
+// at the end in their original order.
+func sortTimelineEvents(events []TimelineEvent) {
+	SortTimeline(events, false)
+}
+
+// SortTimeline orders events by timestamp, newest first when descending is
+// set. Undated events stay at the end either way, and events with equal
+// timestamps keep their original order.
+func SortTimeline(events []TimelineEvent, descending bool) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i].Timestamp, events[j].Timestamp
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		if descending {
+			return a.After(*b)
+		}
+		return a.Before(*b)
+	})
+}
+
+// nameDatePrefix matches names that start with something date-shaped. It is
+// written to work both as a Go regexp and as a PostgreSQL one, so queries
+// can prefilter the rows that parseTimestampFromName might date.
+const nameDatePrefix = `^\d{1,4}[-/.]\d{1,2}[-/.]\d{1,4}`
+
+// nameTimestampToken extracts the leading timestamp from a name: a date,
+// then optionally a time with seconds, fraction, AM/PM, and zone.
+var nameTimestampToken = regexp.MustCompile(nameDatePrefix +
+	`(?:(?:T|\s+)\d{1,2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:\s*[AaPp][Mm])?(?:Z|[+-]\d{2}:?\d{2})?)?`)
+
+// nameTimestampLayouts are the timestamp formats recognized at the start of
+// a name, in priority order. Slashed dates are US month/day, dotted ones
+// European day.month. Runs of spaces are collapsed before parsing.
+var nameTimestampLayouts = []string{
+	// US, 12-hour then 24-hour
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 3:04 PM",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006",
+	// ISO 8601
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	// European
+	"2.1.2006 15:04:05",
+	"2.1.2006 15:04",
+	"2.1.2006",
+}
+
+// parseTimestampFromName parses a timestamp at the start of name, returning
+// the first of nameTimestampLayouts that matches the whole leading token.
+// Times without a zone are read as UTC.
+func parseTimestampFromName(name string) *time.Time {
+	token := nameTimestampToken.FindString(strings.TrimSpace(name))
+	if token == "" {
+		return nil
+	}
+	token = strings.ToUpper(strings.Join(strings.Fields(token), " "))
+
+	for _, layout := range nameTimestampLayouts {
+		if t, err := time.Parse(layout, token); err == nil {
 			return &t
 		}
 	}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFillDerivedTimestampSource(t *testing.T) {
+	stored := time.Date(2017, 10, 1, 21, 41, 56, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		placemark  Placemark
+		wantSource string
+		wantTime   *time.Time
+	}{
+		{"stored", Placemark{Name: "2016-01-01 Gate", Timestamp: &stored}, TimestampFromColumn, &stored},
+		{"from name", Placemark{Name: "2017-10-01T21:41:56Z Gate"}, TimestampFromName, &stored},
+		{"undated", Placemark{Name: "Gate"}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.placemark
+			fillDerived(&p)
+			if p.TimestampSource != tt.wantSource {
+				t.Errorf("TimestampSource = %q, want %q", p.TimestampSource, tt.wantSource)
+			}
+			if (p.Timestamp == nil) != (tt.wantTime == nil) || (p.Timestamp != nil && !p.Timestamp.Equal(*tt.wantTime)) {
+				t.Errorf("Timestamp = %v, want %v", p.Timestamp, tt.wantTime)
+			}
+		})
+	}
+}
+
+// TestPageTotalShortPage covers the pages whose total needs no count
+// query; the store has no database, so a query would panic.
+func TestPageTotalShortPage(t *testing.T) {
+	tests := []struct {
+		name                 string
+		limit, offset, count int
+		want                 int
+	}{
+		{"empty first page", 50, 0, 0, 0},
+		{"short first page", 50, 0, 12, 12},
+		{"short later page", 50, 100, 7, 107},
+	}
+	s := &PlacemarkStore{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, err := s.PageTotal(context.Background(), ListFilter{}, tt.limit, tt.offset, tt.count)
+			if err != nil {
+				t.Fatalf("PageTotal: %v", err)
+			}
+			if total != tt.want {
+				t.Errorf("PageTotal = %d, want %d", total, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestampFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"10/1/2017 9:41:56 PM Gate", "2017-10-01T21:41:56Z"},
+		{"10/1/2017  9:41 pm", "2017-10-01T21:41:00Z"},
+		{"10/1/2017 21:41:56", "2017-10-01T21:41:56Z"},
+		{"10/1/2017 Gate", "2017-10-01T00:00:00Z"},
+		{"2017-10-01T21:41:56Z", "2017-10-01T21:41:56Z"},
+		{"2017-10-01T23:41:56+02:00 Gate", "2017-10-01T21:41:56Z"},
+		{"2017-10-01 21:41 Gate", "2017-10-01T21:41:00Z"},
+		{"2017-10-01", "2017-10-01T00:00:00Z"},
+		{"1.10.2017 21:41", "2017-10-01T21:41:00Z"},
+		{"  1.10.2017", "2017-10-01T00:00:00Z"},
+		{"Gate 10/1/2017", ""},
+		{"13/45/2017", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTimestampFromName(tt.name)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("parseTimestampFromName(%q) = %v, want nil", tt.name, got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("parseTimestampFromName(%q) = nil, want %s", tt.name, tt.want)
+			}
+			if s := got.UTC().Format(time.RFC3339); s != tt.want {
+				t.Errorf("parseTimestampFromName(%q) = %s, want %s", tt.name, s, tt.want)
+			}
+		})
+	}
+}
+
+func TestListOrderBy(t *testing.T) {
+	tests := []struct {
+		key    string
+		desc   bool
+		want   string
+		wantOK bool
+	}{
+		{"", false, "id ASC", true},
+		{"id", true, "id DESC", true},
+		{"name", false, "name ASC, id ASC", true},
+		{"created_at", true, "created_at DESC, id DESC", true},
+		{"geom", false, "", false},
+		{"name; DROP TABLE placemarks", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := listOrderBy(tt.key, tt.desc)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("listOrderBy(%q, %v) = %q, %v; want %q, %v", tt.key, tt.desc, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSortTimeline(t *testing.T) {
+	day := func(d int) *time.Time {
+		ts := time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC)
+		return &ts
+	}
+	events := func() []TimelineEvent {
+		return []TimelineEvent{
+			{Name: "undated a"},
+			{Name: "third", Timestamp: day(3)},
+			{Name: "first", Timestamp: day(1)},
+			{Name: "undated b"},
+			{Name: "second", Timestamp: day(2)},
+			{Name: "also second", Timestamp: day(2)},
+		}
+	}
+	tests := []struct {
+		name       string
+		descending bool
+		want       []string
+	}{
+		{"ascending", false, []string{"first", "second", "also second", "third", "undated a", "undated b"}},
+		{"descending", true, []string{"third", "second", "also second", "first", "undated a", "undated b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evs := events()
+			SortTimeline(evs, tt.descending)
+			var got []string
+			for _, e := range evs {
+				got = append(got, e.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
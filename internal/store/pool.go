@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// defaultConnTimeout bounds the startup ping when neither DB_CONN_TIMEOUT
+// nor the URL's connect_timeout is set.
+const defaultConnTimeout = 10 * time.Second
+
+// Startup retry defaults, used when DB_CONNECT_RETRIES or
+// DB_CONNECT_BACKOFF is unset. Delays double from the backoff up to
+// maxConnectBackoff, so the defaults wait about a minute in all.
+const (
+	defaultConnectRetries = 6
+	defaultConnectBackoff = time.Second
+	maxConnectBackoff     = 30 * time.Second
+)
+
+// ConnectRetry is how ConnectWithRetry retries a database that isn't
+// reachable yet.
+type ConnectRetry struct {
+	// Retries is how many attempts follow the first; 0 disables retrying.
+	Retries int
+	// Backoff is the delay before the first retry.
+	Backoff time.Duration
+}
+
+// ParseConnectRetry reads the startup retry settings with getenv:
+//
+//   - DB_CONNECT_RETRIES: retries after the first attempt (default 6)
+//   - DB_CONNECT_BACKOFF: a duration such as "500ms" before the first
+//     retry, doubling for each one after (default 1s)
+func ParseConnectRetry(getenv func(string) string) (ConnectRetry, error) {
+	retry := ConnectRetry{Retries: defaultConnectRetries, Backoff: defaultConnectBackoff}
+	if v := getenv("DB_CONNECT_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return retry, fmt.Errorf("invalid DB_CONNECT_RETRIES %q: must be a non-negative integer", v)
+		}
+		retry.Retries = n
+	}
+	if v := getenv("DB_CONNECT_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return retry, fmt.Errorf("invalid DB_CONNECT_BACKOFF %q: must be a positive duration such as 1s", v)
+		}
+		retry.Backoff = d
+	}
+	return retry, nil
+}
+
+// Delay returns the wait before retry n, counting from 1: Backoff doubled
+// n-1 times, capped at 30s.
+func (r ConnectRetry) Delay(n int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < n && d < maxConnectBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxConnectBackoff)
+}
+
+// ParsePoolConfig parses databaseURL and applies the pool settings from the
+// environment, read with getenv (normally os.Getenv):
+//
+//   - DB_MAX_CONNS: maximum open connections (pgxpool's default otherwise)
+//   - DB_MIN_CONNS: connections kept open while idle
+//   - DB_CONN_TIMEOUT: a duration such as "5s" bounding each connection
+//     attempt, overriding the URL's connect_timeout
+func ParsePoolConfig(databaseURL string, getenv func(string) string) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATABASE_URL: %w", err)
+	}
+
+	if v := getenv("DB_MAX_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid DB_MAX_CONNS %q: must be a positive integer", v)
+		}
+		config.MaxConns = int32(n)
+	}
+	if v := getenv("DB_MIN_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid DB_MIN_CONNS %q: must be a non-negative integer", v)
+		}
+		config.MinConns = int32(n)
+	}
+	if config.MinConns > config.MaxConns {
+		return nil, fmt.Errorf("DB_MIN_CONNS (%d) exceeds DB_MAX_CONNS (%d)", config.MinConns, config.MaxConns)
+	}
+	if v := getenv("DB_CONN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid DB_CONN_TIMEOUT %q: must be a positive duration such as 5s", v)
+		}
+		config.ConnConfig.ConnectTimeout = d
+	}
+	return config, nil
+}
+
+// Connect opens a pool with config and pings the database, so a wrong
+// address or credentials fail at startup rather than on the first query.
+// The ping is bounded by the connect timeout (10s if none is set).
+func Connect(ctx context.Context, config *pgxpool.Config) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	timeout := config.ConnConfig.ConnectTimeout
+	if timeout <= 0 {
+		timeout = defaultConnTimeout
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("unable to reach database at %s:%d within %s: %w",
+			config.ConnConfig.Host, config.ConnConfig.Port, timeout, err)
+	}
+	return pool, nil
+}
+
+// ConnectWithRetry is Connect, retried with backoff while the database is
+// unreachable or still starting up, as when the server and Postgres start
+// together. Errors the server itself reports, such as bad credentials or a
+// missing database, fail at once. Each failed attempt is logged.
+func ConnectWithRetry(ctx context.Context, config *pgxpool.Config, retry ConnectRetry) (*pgxpool.Pool, error) {
+	for attempt := 1; ; attempt++ {
+		pool, err := Connect(ctx, config)
+		if err == nil {
+			return pool, nil
+		}
+		if !transientConnectError(err) {
+			return nil, err
+		}
+		if attempt > retry.Retries {
+			if retry.Retries == 0 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("giving up after %d connection attempts: %w", attempt, err)
+		}
+
+		delay := retry.Delay(attempt)
+		log.Printf("Database connection attempt %d of %d failed: %v; retrying in %s",
+			attempt, retry.Retries+1, err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// transientConnectError reports whether a failed Connect is worth retrying:
+// anything but an error response from the server, unless that response is
+// that the server is starting up or shutting down.
+func transientConnectError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return true
+	}
+	switch pgErr.Code {
+	case "57P03", "57P01": // cannot_connect_now, admin_shutdown
+		return true
+	}
+	return false
+}
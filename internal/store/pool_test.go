@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func envOf(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestParsePoolConfig(t *testing.T) {
+	const url = "postgres://mandalay@localhost:5432/mandalay?connect_timeout=3"
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantMax     int32
+		wantMin     int32
+		wantTimeout time.Duration
+		wantErr     string
+	}{
+		{"defaults", nil, 0, 0, 3 * time.Second, ""},
+		{"sizes", map[string]string{"DB_MAX_CONNS": "8", "DB_MIN_CONNS": "2"}, 8, 2, 3 * time.Second, ""},
+		{"timeout overrides url", map[string]string{"DB_CONN_TIMEOUT": "750ms"}, 0, 0, 750 * time.Millisecond, ""},
+		{"zero max", map[string]string{"DB_MAX_CONNS": "0"}, 0, 0, 0, "DB_MAX_CONNS"},
+		{"negative min", map[string]string{"DB_MIN_CONNS": "-1"}, 0, 0, 0, "DB_MIN_CONNS"},
+		{"min above max", map[string]string{"DB_MAX_CONNS": "2", "DB_MIN_CONNS": "3"}, 0, 0, 0, "exceeds"},
+		{"bad timeout", map[string]string{"DB_CONN_TIMEOUT": "soon"}, 0, 0, 0, "DB_CONN_TIMEOUT"},
+		{"zero timeout", map[string]string{"DB_CONN_TIMEOUT": "0s"}, 0, 0, 0, "DB_CONN_TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParsePoolConfig(url, envOf(tt.env))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePoolConfig error = %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePoolConfig: %v", err)
+			}
+			if tt.wantMax != 0 && config.MaxConns != tt.wantMax {
+				t.Errorf("MaxConns = %d, want %d", config.MaxConns, tt.wantMax)
+			}
+			if config.MinConns != tt.wantMin {
+				t.Errorf("MinConns = %d, want %d", config.MinConns, tt.wantMin)
+			}
+			if config.ConnConfig.ConnectTimeout != tt.wantTimeout {
+				t.Errorf("ConnectTimeout = %s, want %s", config.ConnConfig.ConnectTimeout, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestParsePoolConfigBadURL(t *testing.T) {
+	if _, err := ParsePoolConfig("postgres://%zz", envOf(nil)); err == nil || !strings.Contains(err.Error(), "DATABASE_URL") {
+		t.Errorf("ParsePoolConfig error = %v, want an invalid DATABASE_URL error", err)
+	}
+}
+
+func TestParseConnectRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    ConnectRetry
+		wantErr string
+	}{
+		{"defaults", nil, ConnectRetry{Retries: defaultConnectRetries, Backoff: defaultConnectBackoff}, ""},
+		{"set", map[string]string{"DB_CONNECT_RETRIES": "0", "DB_CONNECT_BACKOFF": "250ms"}, ConnectRetry{Retries: 0, Backoff: 250 * time.Millisecond}, ""},
+		{"negative retries", map[string]string{"DB_CONNECT_RETRIES": "-1"}, ConnectRetry{}, "DB_CONNECT_RETRIES"},
+		{"bad backoff", map[string]string{"DB_CONNECT_BACKOFF": "1"}, ConnectRetry{}, "DB_CONNECT_BACKOFF"},
+		{"zero backoff", map[string]string{"DB_CONNECT_BACKOFF": "0s"}, ConnectRetry{}, "DB_CONNECT_BACKOFF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, err := ParseConnectRetry(envOf(tt.env))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseConnectRetry error = %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConnectRetry: %v", err)
+			}
+			if retry != tt.want {
+				t.Errorf("ParseConnectRetry = %+v, want %+v", retry, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectRetryDelay(t *testing.T) {
+	retry := ConnectRetry{Retries: 10, Backoff: time.Second}
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 16 * time.Second},
+		{6, maxConnectBackoff},
+		{60, maxConnectBackoff},
+	}
+	for _, tt := range tests {
+		if got := retry.Delay(tt.n); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+
+	if got := (ConnectRetry{Backoff: time.Minute}).Delay(1); got != maxConnectBackoff {
+		t.Errorf("Delay(1) with a 1m backoff = %s, want the %s cap", got, maxConnectBackoff)
+	}
+}
+
+func TestTransientConnectError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network error", errors.New("dial tcp 127.0.0.1:5432: connect: connection refused"), true},
+		{"starting up", fmt.Errorf("ping: %w", &pgconn.PgError{Code: "57P03"}), true},
+		{"shutting down", &pgconn.PgError{Code: "57P01"}, true},
+		{"bad password", &pgconn.PgError{Code: "28P01"}, false},
+		{"missing database", &pgconn.PgError{Code: "3D000"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transientConnectError(tt.err); got != tt.want {
+				t.Errorf("transientConnectError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectWithRetryGivesUp(t *testing.T) {
+	// Nothing listens on port 1, so every attempt is refused at once.
+	config, err := ParsePoolConfig("postgres://mandalay@127.0.0.1:1/mandalay", envOf(map[string]string{"DB_CONN_TIMEOUT": "1s"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		retries int
+		want    string
+	}{
+		{0, "unable to reach database"},
+		{2, "giving up after 3 connection attempts"},
+	}
+	for _, tt := range tests {
+		retry := ConnectRetry{Retries: tt.retries, Backoff: time.Millisecond}
+		pool, err := ConnectWithRetry(context.Background(), config, retry)
+		if err == nil {
+			pool.Close()
+			t.Fatalf("connected to %s", config.ConnConfig.Host)
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("with %d retries: error = %v, want %q", tt.retries, err, tt.want)
+		}
+	}
+}
+
+func TestConnectWithRetryStopsOnCancel(t *testing.T) {
+	config, err := ParsePoolConfig("postgres://mandalay@127.0.0.1:1/mandalay", envOf(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = ConnectWithRetry(ctx, config, ConnectRetry{Retries: 5, Backoff: time.Hour})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the context's", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ConnectWithRetry took %s after the context ended", elapsed)
+	}
+}
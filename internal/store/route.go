@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrRoutingUnavailable means the routing topology has not been built; run
+// the importer with -build-routing.
+var ErrRoutingUnavailable = errors.New("routing network not built")
+
+// ErrNoRoute means the two placemarks are not connected by the network.
+var ErrNoRoute = errors.New("no route between placemarks")
+
+// Route is a shortest path along the LineString network.
+type Route struct {
+	Geometry     json.RawMessage `json:"geometry"`
+	LengthMeters float64         `json:"length_meters"`
+	// EdgePlacemarkIDs lists the LineString placemarks traversed, in order.
+	EdgePlacemarkIDs []int `json:"edge_placemark_ids"`
+}
+
+// GetRoute finds the shortest path between two placemarks along the routing
+// network built from LineString placemarks. Each placemark is snapped to the
+// network vertex nearest its centroid, and the path is found with
+// pgr_dijkstra over an undirected graph weighted by length in meters.
+// fromID and toID must differ.
+func (s *PlacemarkStore) GetRoute(ctx context.Context, fromID, toID int) (*Route, error) {
+	var count int
+	if err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM placemarks WHERE id = ANY($1)", []int{fromID, toID}).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to look up placemarks: %w", err)
+	}
+	if count != 2 {
+		return nil, ErrPlacemarkNotFound
+	}
+
+	query := `
+		WITH endpoints AS (
+			SELECT
+				(SELECT v.id FROM routing_edges_vertices_pgr v, placemarks p
+				 WHERE p.id = $1 ORDER BY v.the_geom <-> ST_Centroid(p.geom) LIMIT 1) AS start_vid,
+				(SELECT v.id FROM routing_edges_vertices_pgr v, placemarks p
+				 WHERE p.id = $2 ORDER BY v.the_geom <-> ST_Centroid(p.geom) LIMIT 1) AS end_vid
+		),
+		path AS (
+			SELECT d.seq, d.edge, d.cost
+			FROM endpoints, pgr_dijkstra(
+				'SELECT id, source, target, cost FROM routing_edges',
+				endpoints.start_vid, endpoints.end_vid,
+				directed := false
+			) d
+			WHERE d.edge <> -1
+		)
+		SELECT
+			ST_AsGeoJSON(ST_LineMerge(ST_Collect(e.the_geom ORDER BY path.seq))),
+			SUM(path.cost),
+			array_agg(e.placemark_id ORDER BY path.seq)
+		FROM path
+		JOIN routing_edges e ON e.id = path.edge
+	`
+
+	var (
+		geometry *string
+		length   *float64
+		route    Route
+	)
+	err := s.db.QueryRow(ctx, query, fromID, toID).Scan(&geometry, &length, &route.EdgePlacemarkIDs)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && (pgErr.Code == "42P01" || pgErr.Code == "42883") {
+			// undefined_table / undefined_function: topology or extension missing
+			return nil, ErrRoutingUnavailable
+		}
+		return nil, fmt.Errorf("failed to compute route: %w", err)
+	}
+	if geometry == nil || length == nil {
+		return nil, ErrNoRoute
+	}
+
+	route.Geometry = json.RawMessage(*geometry)
+	route.LengthMeters = *length
+	return &route, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// searchConfig is the text search configuration behind placemarks.search_tsv;
+// queries must use the same one to hit the GIN index.
+const searchConfig = "english"
+
+// SearchResult is a placemark matching a text search, with its rank and a
+// snippet of the matching text. Matched words are wrapped in <b> tags.
+type SearchResult struct {
+	Placemark
+	Rank     float32 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+// Search runs a full-text query over placemark names and descriptions, best
+// matches first, and returns a page of results with the total match count.
+// Words in query are ANDed together, as with plainto_tsquery.
+func (s *PlacemarkStore) Search(ctx context.Context, query string, limit, offset int) ([]SearchResult, int, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT `+placemarkColumns+`,
+		       ts_rank(search_tsv, q) AS rank,
+		       ts_headline('`+searchConfig+`', name || ' ' || COALESCE(description, ''), q,
+		                   'MaxFragments=2, MinWords=5, MaxWords=20'),
+		       COUNT(*) OVER()
+		FROM placemarks, plainto_tsquery('`+searchConfig+`', $1) AS q
+		WHERE search_tsv @@ q
+		ORDER BY rank DESC, id
+		LIMIT $2 OFFSET $3
+	`, query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search placemarks: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	total := 0
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(append(placemarkScanTargets(&r.Placemark), &r.Rank, &r.Headline, &total)...); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		fillDerived(&r.Placemark)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// An empty page past the end carries no window count; ask directly.
+	if len(results) == 0 && offset > 0 {
+		err := s.db.QueryRow(ctx, `
+			SELECT COUNT(*) FROM placemarks
+			WHERE search_tsv @@ plainto_tsquery('`+searchConfig+`', $1)
+		`, query).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+		}
+	}
+
+	return results, total, nil
+}
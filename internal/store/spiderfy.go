@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// metersPerDegree is the approximate length of one degree of latitude.
+const metersPerDegree = 111320.0
+
+// StackMember is one placemark in a stack of points sharing a location,
+// with the position a client should draw it at when the stack is expanded.
+type StackMember struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Location Point  `json:"location"`
+	Offset   Point  `json:"offset"`
+	// Angle is the member's direction from the center in degrees,
+	// clockwise from north.
+	Angle float64 `json:"angle"`
+}
+
+// Stack is the set of Point placemarks whose coordinates round to the same
+// value. Count is the full stack size even when Members is truncated.
+type Stack struct {
+	Center       Point         `json:"center"`
+	Precision    int           `json:"precision"`
+	RadiusMeters float64       `json:"radius_meters"`
+	Count        int           `json:"count"`
+	Members      []StackMember `json:"members"`
+}
+
+// GetStack finds the Point placemarks whose coordinates, rounded to precision
+// decimal places, match at's, and spreads up to limit of them evenly around
+// the rounded location at radiusMeters. Members are ordered by id, so the
+// same stack always gets the same offsets.
+func (s *PlacemarkStore) GetStack(ctx context.Context, at Point, precision int, radiusMeters float64, limit int) (*Stack, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, ST_X(geom), ST_Y(geom)
+		FROM placemarks
+		WHERE geometry_type = 'Point'
+		  AND geom && ST_Expand(ST_SetSRID(ST_MakePoint($1, $2), 4326), power(10, -$3::int))
+		  AND round(ST_X(geom)::numeric, $3) = round($1::numeric, $3)
+		  AND round(ST_Y(geom)::numeric, $3) = round($2::numeric, $3)
+		ORDER BY id
+	`, at.Lon, at.Lat, precision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stacked points: %w", err)
+	}
+	defer rows.Close()
+
+	var members []StackMember
+	for rows.Next() {
+		var m StackMember
+		if err := rows.Scan(&m.ID, &m.Name, &m.Location.Lon, &m.Location.Lat); err != nil {
+			return nil, fmt.Errorf("failed to scan stacked point: %w", err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	scale := math.Pow(10, float64(precision))
+	stack := &Stack{
+		Center: Point{
+			Lat: math.Round(at.Lat*scale) / scale,
+			Lon: math.Round(at.Lon*scale) / scale,
+		},
+		Precision:    precision,
+		RadiusMeters: radiusMeters,
+		Count:        len(members),
+	}
+	if len(members) > limit {
+		members = members[:limit]
+	}
+	stack.Members = spiderfy(stack.Center, members, radiusMeters)
+	return stack, nil
+}
+
+// spiderfy places members on a circle of radiusMeters around center, the
+// first due north and the rest clockwise at equal angles. A lone member stays
+// at the center.
+func spiderfy(center Point, members []StackMember, radiusMeters float64) []StackMember {
+	if len(members) == 0 {
+		return []StackMember{}
+	}
+	if len(members) == 1 {
+		members[0].Offset = center
+		return members
+	}
+
+	dLat := radiusMeters / metersPerDegree
+	dLon := dLat / math.Cos(center.Lat*math.Pi/180)
+	step := 2 * math.Pi / float64(len(members))
+	for i := range members {
+		theta := float64(i) * step
+		members[i].Angle = theta * 180 / math.Pi
+		members[i].Offset = Point{
+			Lat: center.Lat + dLat*math.Cos(theta),
+			Lon: center.Lon + dLon*math.Sin(theta),
+		}
+	}
+	return members
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSpiderfy(t *testing.T) {
+	center := Point{Lon: 10, Lat: 60}
+
+	if got := spiderfy(center, nil, 20); got == nil || len(got) != 0 {
+		t.Errorf("spiderfy(nil) = %v, want an empty slice", got)
+	}
+
+	lone := spiderfy(center, []StackMember{{ID: 1}}, 20)
+	if lone[0].Offset != center || lone[0].Angle != 0 {
+		t.Errorf("lone member = %+v, want it at the center", lone[0])
+	}
+
+	members := spiderfy(center, make([]StackMember, 4), 20)
+	wantAngles := []float64{0, 90, 180, 270}
+	for i, m := range members {
+		if math.Abs(m.Angle-wantAngles[i]) > 1e-9 {
+			t.Errorf("member %d angle = %v, want %v", i, m.Angle, wantAngles[i])
+		}
+		// Back to meters, every offset is radiusMeters from the center.
+		dy := (m.Offset.Lat - center.Lat) * metersPerDegree
+		dx := (m.Offset.Lon - center.Lon) * metersPerDegree * math.Cos(center.Lat*math.Pi/180)
+		if r := math.Hypot(dx, dy); math.Abs(r-20) > 1e-6 {
+			t.Errorf("member %d is %vm from the center, want 20", i, r)
+		}
+	}
+	if members[0].Offset.Lat <= center.Lat || members[1].Offset.Lon <= center.Lon {
+		t.Errorf("members go %+v, %+v; want north then east", members[0].Offset, members[1].Offset)
+	}
+}
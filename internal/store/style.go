@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Color is a KML color converted for web clients: Hex and Opacity for
+// APIs that take them separately, RGBA as a CSS #rrggbbaa value.
+type Color struct {
+	Hex     string  `json:"hex"`
+	Opacity float64 `json:"opacity"`
+	RGBA    string  `json:"rgba"`
+}
+
+type Style struct {
+	ID         string   `json:"id"`
+	IconHref   *string  `json:"icon_href,omitempty"`
+	IconScale  *float64 `json:"icon_scale,omitempty"`
+	LabelScale *float64 `json:"label_scale,omitempty"`
+	LabelColor *Color   `json:"label_color,omitempty"`
+	LineColor  *Color   `json:"line_color,omitempty"`
+	LineWidth  *float64 `json:"line_width,omitempty"`
+	PolyColor  *Color   `json:"poly_color,omitempty"`
+	// HighlightStyleID is the style to apply on hover, from a StyleMap.
+	HighlightStyleID *string `json:"highlight_style_id,omitempty"`
+}
+
+const styleColumns = "id, icon_href, icon_scale, label_scale, label_color, line_color, line_width, poly_color, highlight_style_id"
+
+func (s *PlacemarkStore) ListStyles(ctx context.Context) ([]Style, error) {
+	rows, err := s.db.Query(ctx, "SELECT "+styleColumns+" FROM styles ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query styles: %w", err)
+	}
+	defer rows.Close()
+
+	var styles []Style
+	for rows.Next() {
+		style, err := scanStyle(rows)
+		if err != nil {
+			return nil, err
+		}
+		styles = append(styles, *style)
+	}
+
+	return styles, rows.Err()
+}
+
+// GetStyle returns the style with the given id, or nil if it does not exist.
+func (s *PlacemarkStore) GetStyle(ctx context.Context, id string) (*Style, error) {
+	row := s.db.QueryRow(ctx, "SELECT "+styleColumns+" FROM styles WHERE id = $1", id)
+	style, err := scanStyle(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return style, err
+}
+
+func scanStyle(row pgx.Row) (*Style, error) {
+	var style Style
+	var labelColor, lineColor, polyColor *string
+	if err := row.Scan(&style.ID, &style.IconHref, &style.IconScale, &style.LabelScale,
+		&labelColor, &lineColor, &style.LineWidth, &polyColor, &style.HighlightStyleID); err != nil {
+		return nil, fmt.Errorf("failed to scan style: %w", err)
+	}
+
+	style.LabelColor = kmlColorToColor(labelColor)
+	style.LineColor = kmlColorToColor(lineColor)
+	style.PolyColor = kmlColorToColor(polyColor)
+	return &style, nil
+}
+
+// kmlColorToColor converts a stored KML color, returning nil when it is
+// missing or malformed so clients fall back to their defaults.
+func kmlColorToColor(raw *string) *Color {
+	if raw == nil {
+		return nil
+	}
+	r, g, b, a, err := parseKMLColor(*raw)
+	if err != nil {
+		return nil
+	}
+	return &Color{
+		Hex:     fmt.Sprintf("#%02x%02x%02x", r, g, b),
+		Opacity: float64(a) / 255,
+		RGBA:    fmt.Sprintf("#%02x%02x%02x%02x", r, g, b, a),
+	}
+}
+
+// parseKMLColor decodes a KML color. KML writes colors as aabbggrr: alpha
+// first, then blue, green, red. A six-digit bbggrr value is treated as
+// fully opaque.
+func parseKMLColor(s string) (r, g, b, a uint8, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+
+	switch len(s) {
+	case 8:
+	case 6:
+		s = "ff" + s
+	default:
+		return 0, 0, 0, 0, fmt.Errorf("invalid KML color %q", s)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid KML color %q", s)
+	}
+
+	a = uint8(v >> 24)
+	b = uint8(v >> 16)
+	g = uint8(v >> 8)
+	r = uint8(v)
+	return r, g, b, a, nil
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKMLColorToColor(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name string
+		raw  *string
+		want *Color
+	}{
+		{"nil", nil, nil},
+		{"aabbggrr", str("7f0000ff"), &Color{Hex: "#ff0000", Opacity: 127.0 / 255, RGBA: "#ff00007f"}},
+		{"opaque blue", str("ffff0000"), &Color{Hex: "#0000ff", Opacity: 1, RGBA: "#0000ffff"}},
+		{"six digits", str("00ff00"), &Color{Hex: "#00ff00", Opacity: 1, RGBA: "#00ff00ff"}},
+		{"hash and spaces", str(" #FF14F0AA "), &Color{Hex: "#aaf014", Opacity: 1, RGBA: "#aaf014ff"}},
+		{"short", str("fff"), nil},
+		{"not hex", str("zzzzzzzz"), nil},
+		{"empty", str(""), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kmlColorToColor(tt.raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kmlColorToColor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// TimeWindow bounds a timeline query. Both bounds are inclusive and a nil
+// bound is open. A bounded window drops undated events.
+type TimeWindow struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// Bounded reports whether w has either bound set.
+func (w TimeWindow) Bounded() bool {
+	return w.From != nil || w.To != nil
+}
+
+// Contains reports whether t falls inside w. Undated (nil) times are only
+// inside an unbounded window.
+func (w TimeWindow) Contains(t *time.Time) bool {
+	if !w.Bounded() {
+		return true
+	}
+	return t != nil &&
+		(w.From == nil || !t.Before(*w.From)) &&
+		(w.To == nil || !t.After(*w.To))
+}
+
+// filter keeps the events inside w, in order.
+func (w TimeWindow) filter(events []TimelineEvent) []TimelineEvent {
+	if !w.Bounded() {
+		return events
+	}
+	kept := events[:0]
+	for _, e := range events {
+		if w.Contains(e.Timestamp) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// TemporalNeighbor is a dated event and its distance in time from a
+// reference instant. DeltaSeconds is negative for events before it.
+type TemporalNeighbor struct {
+	TimelineEvent
+	DeltaSeconds float64 `json:"delta_seconds"`
+}
+
+// GetNearestInTime returns up to limit dated events closest in time to at,
+// regardless of location, nearest first, breaking ties by placemark id.
+// Timestamps may come from placemark names, so the ordering happens here
+// rather than in SQL.
+func (s *PlacemarkStore) GetNearestInTime(ctx context.Context, at time.Time, limit int) ([]TemporalNeighbor, error) {
+	events, err := s.GetTimeline(ctx, TimeWindow{})
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors := make([]TemporalNeighbor, 0, len(events))
+	for _, e := range events {
+		if e.Timestamp == nil {
+			continue
+		}
+		neighbors = append(neighbors, TemporalNeighbor{
+			TimelineEvent: e,
+			DeltaSeconds:  e.Timestamp.Sub(at).Seconds(),
+		})
+	}
+
+	sort.Slice(neighbors, func(i, j int) bool {
+		di, dj := math.Abs(neighbors[i].DeltaSeconds), math.Abs(neighbors[j].DeltaSeconds)
+		if di != dj {
+			return di < dj
+		}
+		return neighbors[i].PlacemarkID < neighbors[j].PlacemarkID
+	})
+
+	if len(neighbors) > limit {
+		neighbors = neighbors[:limit]
+	}
+	return neighbors, nil
+}
+
+// HistogramIntervals are the bucket widths GetTimelineHistogram accepts,
+// named as date_trunc units.
+var HistogramIntervals = []string{"day", "week", "month", "year"}
+
+// HistogramBucket counts the dated events starting in one interval. Bucket
+// is the start of the interval in UTC; weeks start on Monday.
+type HistogramBucket struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int       `json:"count"`
+}
+
+// TimelineHistogram is the timeline's event density over time.
+type TimelineHistogram struct {
+	Interval string            `json:"interval"`
+	Buckets  []HistogramBucket `json:"buckets"`
+	// Undated counts timeline events whose timestamp couldn't be parsed;
+	// they fall in no bucket.
+	Undated int `json:"undated"`
+}
+
+// GetTimelineHistogram counts timeline events per interval (one of
+// HistogramIntervals), by the same timestamps GetTimeline uses, in
+// chronological order. Empty buckets are omitted.
+func (s *PlacemarkStore) GetTimelineHistogram(ctx context.Context, interval string) (*TimelineHistogram, error) {
+	counts := make(map[time.Time]int)
+
+	rows, err := s.db.Query(ctx, `
+		SELECT date_trunc($1, time_begin, 'UTC'), COUNT(*)
+		FROM placemarks
+		WHERE time_begin IS NOT NULL
+		GROUP BY 1
+	`, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline histogram: %w", err)
+	}
+	for rows.Next() {
+		var bucket time.Time
+		var count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan timeline histogram: %w", err)
+		}
+		counts[bucket.UTC()] += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query timeline histogram: %w", err)
+	}
+
+	// Timestamps parsed from names aren't stored, so those are bucketed here.
+	rows, err = s.db.Query(ctx, `
+		SELECT name
+		FROM placemarks
+		WHERE time_begin IS NULL AND name ~ $1
+	`, nameDatePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline histogram: %w", err)
+	}
+	defer rows.Close()
+
+	histogram := &TimelineHistogram{Interval: interval, Buckets: []HistogramBucket{}}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan timeline histogram: %w", err)
+		}
+		if t := parseTimestampFromName(name); t != nil {
+			counts[truncateTime(*t, interval)]++
+		} else {
+			histogram.Undated++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query timeline histogram: %w", err)
+	}
+
+	for bucket, count := range counts {
+		histogram.Buckets = append(histogram.Buckets, HistogramBucket{Bucket: bucket, Count: count})
+	}
+	sort.Slice(histogram.Buckets, func(i, j int) bool {
+		return histogram.Buckets[i].Bucket.Before(histogram.Buckets[j].Bucket)
+	})
+	return histogram, nil
+}
+
+// truncateTime is date_trunc(interval, t, 'UTC') for HistogramIntervals.
+func truncateTime(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	y, m, d := t.Date()
+	switch interval {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
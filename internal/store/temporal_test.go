@@ -0,0 +1,62 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2017, 10, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		window TimeWindow
+		t      *time.Time
+		want   bool
+	}{
+		{"unbounded dated", TimeWindow{}, day(1), true},
+		{"unbounded undated", TimeWindow{}, nil, true},
+		{"bounded undated", TimeWindow{From: day(1)}, nil, false},
+		{"on from", TimeWindow{From: day(1), To: day(3)}, day(1), true},
+		{"on to", TimeWindow{From: day(1), To: day(3)}, day(3), true},
+		{"inside", TimeWindow{From: day(1), To: day(3)}, day(2), true},
+		{"before", TimeWindow{From: day(2)}, day(1), false},
+		{"after", TimeWindow{To: day(2)}, day(3), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateTime(t *testing.T) {
+	// A Thursday evening in New York, already the Friday in UTC.
+	at := time.Date(2024, 2, 29, 22, 30, 15, 0, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		interval string
+		want     time.Time
+	}{
+		{"year", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"month", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"week", time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC)},
+		{"day", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			if got := truncateTime(at, tt.interval); !got.Equal(tt.want) {
+				t.Errorf("truncateTime(%s) = %v, want %v", tt.interval, got, tt.want)
+			}
+		})
+	}
+
+	sunday := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	if got, want := truncateTime(sunday, "week"), time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("truncateTime(Sunday, week) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// MaxTileZoom is the deepest zoom level GetTile accepts.
+const MaxTileZoom = 22
+
+// TileLayer is the name of the layer GetTile's tiles carry.
+const TileLayer = "placemarks"
+
+// tileExtent and tileBuffer are the vector tile's coordinate resolution and
+// the margin, in tile units, kept around it so lines and polygons crossing a
+// tile edge join up with their neighbours.
+const (
+	tileExtent = 4096
+	tileBuffer = 64
+)
+
+// webMercatorHalfWidth is half the width of the Web Mercator (EPSG:3857)
+// world in meters.
+const webMercatorHalfWidth = math.Pi * 6378137
+
+// TileEnvelope is a slippy-map tile's bounds in Web Mercator meters.
+type TileEnvelope struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+// TileBounds returns the Web Mercator bounds of tile z/x/y, where x grows
+// eastward from the antimeridian and y grows southward from the top of the
+// map. It reports false when z is outside 0..MaxTileZoom or x or y is
+// outside 0..2^z-1.
+func TileBounds(z, x, y int) (TileEnvelope, bool) {
+	if z < 0 || z > MaxTileZoom {
+		return TileEnvelope{}, false
+	}
+	n := 1 << z
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return TileEnvelope{}, false
+	}
+	size := 2 * webMercatorHalfWidth / float64(n)
+	minX := -webMercatorHalfWidth + float64(x)*size
+	maxY := webMercatorHalfWidth - float64(y)*size
+	return TileEnvelope{MinX: minX, MinY: maxY - size, MaxX: minX + size, MaxY: maxY}, true
+}
+
+// LonLat returns the envelope in WGS 84 degrees.
+func (e TileEnvelope) LonLat() BoundingBox {
+	lon := func(x float64) float64 { return x / webMercatorHalfWidth * 180 }
+	lat := func(y float64) float64 { return math.Atan(math.Sinh(y/webMercatorHalfWidth*math.Pi)) * 180 / math.Pi }
+	return BoundingBox{MinLon: lon(e.MinX), MinLat: lat(e.MinY), MaxLon: lon(e.MaxX), MaxLat: lat(e.MaxY)}
+}
+
+// buffered grows the envelope by tileBuffer tile units on each side.
+func (e TileEnvelope) buffered() TileEnvelope {
+	margin := (e.MaxX - e.MinX) * tileBuffer / tileExtent
+	return TileEnvelope{MinX: e.MinX - margin, MinY: e.MinY - margin, MaxX: e.MaxX + margin, MaxY: e.MaxY + margin}
+}
+
+// GetTile renders the placemarks in tile z/x/y as a Mapbox Vector Tile with
+// one layer, TileLayer. Each feature's id is the placemark id, and it has
+// name and geometry_type properties. The tile is empty when no placemark
+// touches it. z, x, and y must be valid for TileBounds.
+func (s *PlacemarkStore) GetTile(ctx context.Context, z, x, y int) ([]byte, error) {
+	env, ok := TileBounds(z, x, y)
+	if !ok {
+		return nil, fmt.Errorf("invalid tile %d/%d/%d", z, x, y)
+	}
+	// Geometries not inside the buffered tile are clipped to it in WGS 84
+	// first: Web Mercator can't represent the poles, so anything reaching
+	// past about 85 degrees would not transform.
+	clip := env.buffered().LonLat()
+	clip.MinLat = math.Max(clip.MinLat, -85.06)
+	clip.MaxLat = math.Min(clip.MaxLat, 85.06)
+
+	var tile []byte
+	err := s.db.QueryRow(ctx, `
+		WITH clip AS (SELECT ST_MakeEnvelope($5, $6, $7, $8, 4326) AS box),
+		features AS (
+			SELECT p.id, p.name, p.geometry_type,
+			       ST_AsMVTGeom(
+			           ST_Transform(CASE WHEN p.geom @ clip.box THEN p.geom
+			                             ELSE ST_Intersection(p.geom, clip.box) END, 3857),
+			           ST_MakeEnvelope($1, $2, $3, $4, 3857), $9, $10, true
+			       ) AS geom
+			FROM placemarks p, clip
+			WHERE p.geom && clip.box
+		)
+		SELECT ST_AsMVT(features, $11, $9, 'geom', 'id')
+		FROM features
+		WHERE geom IS NOT NULL
+	`, env.MinX, env.MinY, env.MaxX, env.MaxY, clip.MinLon, clip.MinLat, clip.MaxLon, clip.MaxLat,
+		tileExtent, tileBuffer, TileLayer).Scan(&tile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render tile: %w", err)
+	}
+	return tile, nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTileBounds(t *testing.T) {
+	const w = webMercatorHalfWidth
+	tests := []struct {
+		name    string
+		z, x, y int
+		want    TileEnvelope
+		wantOK  bool
+	}{
+		{"world", 0, 0, 0, TileEnvelope{-w, -w, w, w}, true},
+		{"north west", 1, 0, 0, TileEnvelope{-w, 0, 0, w}, true},
+		{"south east", 1, 1, 1, TileEnvelope{0, -w, w, 0}, true},
+		{"x out of range", 1, 2, 0, TileEnvelope{}, false},
+		{"negative y", 3, 0, -1, TileEnvelope{}, false},
+		{"negative zoom", -1, 0, 0, TileEnvelope{}, false},
+		{"too deep", MaxTileZoom + 1, 0, 0, TileEnvelope{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := TileBounds(tt.z, tt.x, tt.y)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("TileBounds(%d, %d, %d) = %+v, %v; want %+v, %v", tt.z, tt.x, tt.y, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTileEnvelopeLonLat(t *testing.T) {
+	env, _ := TileBounds(1, 1, 0)
+	got := env.LonLat()
+	want := BoundingBox{MinLon: 0, MinLat: 0, MaxLon: 180, MaxLat: 85.0511287798}
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"MinLon", got.MinLon, want.MinLon},
+		{"MinLat", got.MinLat, want.MinLat},
+		{"MaxLon", got.MaxLon, want.MaxLon},
+		{"MaxLat", got.MaxLat, want.MaxLat},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}